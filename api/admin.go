@@ -0,0 +1,41 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"retl/inputs"
+	"retl/inputs/types"
+	"strings"
+)
+
+func isAdmin(r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(token)) == 1
+}
+
+// checkSQLMode rejects settings only admins may use: those that run
+// free-form SQL or reach arbitrary addresses, and local file paths, which
+// previews would read from the API host. Secrets are checked too, since
+// inputs read their settings from either.
+func checkSQLMode(r *http.Request, conf *types.ConfigType) error {
+	if conf == nil || isAdmin(r) {
+		return nil
+	}
+	lookup := configLookup(conf)
+	for _, key := range inputs.SQLModeSettings() {
+		if lookup(key) != "" {
+			return fmt.Errorf("%s can only be set by an admin", key)
+		}
+	}
+	for _, key := range inputs.LocalPathSettings() {
+		if v := lookup(key); v != "" && !strings.HasPrefix(v, "s3://") {
+			return fmt.Errorf("%s can only name s3:// paths unless set by an admin", key)
+		}
+	}
+	return nil
+}
@@ -100,6 +100,124 @@ func RegisterRoutes(router chi.Router) {
 		}
 	})
 
+	router.Get("/pipelines/{id}/dlq", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := getDeadLetters(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+
+	router.Post("/pipelines/{id}/dlq/replay", func(w http.ResponseWriter, r *http.Request) {
+		result, err := replayDeadLetters(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	router.Post("/pipelines/{id}/cursor/reset", func(w http.ResponseWriter, r *http.Request) {
+		err := resetCursor(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router.Get("/pipelines/{id}/drift", func(w http.ResponseWriter, r *http.Request) {
+		records, err := getSchemaDrift(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(records)
+	})
+
+	router.Post("/pipelines/{id}/schema/reset", func(w http.ResponseWriter, r *http.Request) {
+		err := resetSchema(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router.Post("/pipelines/{id}/mapping/validate", func(w http.ResponseWriter, r *http.Request) {
+		result, err := validateMapping(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	router.Post("/pipelines/{id}/transform/test", func(w http.ResponseWriter, r *http.Request) {
+		results, err := testTransforms(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+
+	router.Post("/inputs/{id}/test", func(w http.ResponseWriter, r *http.Request) {
+		result, err := testInput(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	router.Post("/inputs/{id}/preview", func(w http.ResponseWriter, r *http.Request) {
+		preview, err := previewInput(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+	})
+
+	router.Get("/inputs/{id}/schemas", func(w http.ResponseWriter, r *http.Request) {
+		result, err := getInputSchemas(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	router.Get("/inputs/{id}/tables", func(w http.ResponseWriter, r *http.Request) {
+		result, err := getInputTables(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	router.Get("/inputs/{id}/tables/{table}/columns", func(w http.ResponseWriter, r *http.Request) {
+		result, err := getInputColumns(dbClient, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
 	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 	})
@@ -148,7 +266,7 @@ func corsMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
         w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Admin-Token")
         
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusOK)
@@ -219,6 +337,14 @@ func createInput(dbClient *supabase.Client, w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(400)
 		return err
 	}
+	if err := checkSQLMode(r, reqBody.Config); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return err
+	}
+	if err := checkDriftPolicy(reqBody.ConnectorType, reqBody.ConnectorName, reqBody.Config); err != nil {
+		w.WriteHeader(400)
+		return err
+	}
 	id := uuid.New()
 	insertBody := CreateParams{
 		ID: id,
@@ -236,7 +362,6 @@ func createInput(dbClient *supabase.Client, w http.ResponseWriter, r *http.Reque
 	fmt.Println(result)
 	configStorageMap[id.String()] = reqBody.Config
 	log.Printf("Insert result: %s, Count: %d", result, count)
-	fmt.Println(configStorageMap)
 	return nil
 }
 
@@ -332,7 +457,6 @@ func createOutput(dbClient *supabase.Client, w http.ResponseWriter, r *http.Requ
 	}
 	configStorageMap[id.String()] = reqBody.Config
 	log.Printf("Insert result: %s, Count: %d", result, count)
-	fmt.Println(configStorageMap)
 	return nil
 }
 
@@ -351,9 +475,16 @@ func startComponent(w http.ResponseWriter, r *http.Request) error {
 		w.WriteHeader(400)
 		return err
 	}
+	if err := checkSQLMode(r, reqBody.Config); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return err
+	}
+	if err := checkDriftPolicy(reqBody.ConnectorType, reqBody.ConnectorName, reqBody.Config); err != nil {
+		w.WriteHeader(400)
+		return err
+	}
 	fmt.Println(reqBody.ConnectorName)
 	fmt.Println(reqBody.ConnectorType)
-	fmt.Println(reqBody.Config)
 	err := k8sorhcestration.RunOrchestration(reqBody.ConnectorType, reqBody.ConnectorName, reqBody.Config, reqBody.PipelineName)
 	if err != nil {
 		return err
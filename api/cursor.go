@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+	"retl/inputs/state"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+// resetCursor forgets a pipeline's incremental high-water mark so its next
+// run is a full refresh.
+func resetCursor(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) error {
+	return state.New(dbClient).Delete(chi.URLParam(r, "id"), state.CursorKey)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"retl/inputs/producer"
+	"retl/inputs/types"
+	"retl/outputs/deadletter"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+func getDeadLetters(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) ([]deadletter.Entry, error) {
+	pipelineID := chi.URLParam(r, "id")
+	includeReplayed := r.URL.Query().Get("include_replayed") == "true"
+	return deadletter.New(dbClient).List(pipelineID, includeReplayed)
+}
+
+type ReplayResult struct {
+	Replayed int `json:"replayed"`
+}
+
+// replayDeadLetters re-publishes a pipeline's pending dead letters onto the
+// pipeline topic with their original key and headers.
+func replayDeadLetters(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*ReplayResult, error) {
+	pipelineID := chi.URLParam(r, "id")
+	queue := deadletter.New(dbClient)
+	entries, err := queue.List(pipelineID, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return &ReplayResult{}, nil
+	}
+
+	p, err := producer.New(&types.ConfigType{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if err := p.Write(r.Context(), entry.Message()); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to replay dead letter %s: %v", entry.ID, err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if err := p.Close(); err != nil {
+		return nil, fmt.Errorf("failed to replay dead letters: %v", err)
+	}
+
+	if err := queue.MarkReplayed(ids); err != nil {
+		return nil, err
+	}
+	return &ReplayResult{Replayed: len(ids)}, nil
+}
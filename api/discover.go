@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"retl/inputs"
+	"retl/inputs/types"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+// discoveryTTL is how long discovered schemas, tables and columns are
+// served from the cache. Listing a warehouse can take seconds, and the UI
+// asks again on every step of building a pipeline.
+const discoveryTTL = 10 * time.Minute
+
+// Discovery is what an input's source contains at one level: its schemas,
+// the tables of a schema or the columns of a table.
+type Discovery struct {
+	Schemas     []string       `json:"schemas,omitempty"`
+	Tables      []string       `json:"tables,omitempty"`
+	Columns     []types.Column `json:"columns,omitempty"`
+	RefreshedAt time.Time      `json:"refreshed_at"`
+}
+
+var (
+	discoveryMutex sync.Mutex
+	discoveryCache = make(map[string]*Discovery)
+)
+
+// discover answers from the cache unless the entry is stale or the request
+// asks for ?refresh=true, in which case it asks the source through list.
+// Failures are not cached.
+func discover(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request, key string, list func(context.Context, inputs.SchemaDiscoverer, *Discovery) error) (*Discovery, error) {
+	key = chi.URLParam(r, "id") + "\x00" + key
+	if r.URL.Query().Get("refresh") != "true" {
+		discoveryMutex.Lock()
+		cached, ok := discoveryCache[key]
+		discoveryMutex.Unlock()
+		if ok && time.Since(cached.RefreshedAt) < discoveryTTL {
+			return cached, nil
+		}
+	}
+
+	input, err := inputFor(dbClient, w, r)
+	if err != nil {
+		return nil, err
+	}
+	discoverer, ok := input.(inputs.SchemaDiscoverer)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return nil, fmt.Errorf("input does not support schema discovery")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	result := &Discovery{RefreshedAt: time.Now().UTC()}
+	if err := list(ctx, discoverer, result); err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return nil, err
+	}
+
+	discoveryMutex.Lock()
+	discoveryCache[key] = result
+	discoveryMutex.Unlock()
+	return result, nil
+}
+
+// schemaParam reads the schema the tables and columns endpoints look in.
+func schemaParam(w http.ResponseWriter, r *http.Request) (string, error) {
+	schema := r.URL.Query().Get("schema")
+	if schema == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", fmt.Errorf("schema is required")
+	}
+	return schema, nil
+}
+
+func getInputSchemas(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*Discovery, error) {
+	return discover(dbClient, w, r, "schemas", func(ctx context.Context, d inputs.SchemaDiscoverer, result *Discovery) (err error) {
+		result.Schemas, err = d.Schemas(ctx)
+		return err
+	})
+}
+
+func getInputTables(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*Discovery, error) {
+	schema, err := schemaParam(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return discover(dbClient, w, r, "tables\x00"+schema, func(ctx context.Context, d inputs.SchemaDiscoverer, result *Discovery) (err error) {
+		result.Tables, err = d.Tables(ctx, schema)
+		return err
+	})
+}
+
+func getInputColumns(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*Discovery, error) {
+	schema, err := schemaParam(w, r)
+	if err != nil {
+		return nil, err
+	}
+	table := chi.URLParam(r, "table")
+	return discover(dbClient, w, r, "columns\x00"+schema+"\x00"+table, func(ctx context.Context, d inputs.SchemaDiscoverer, result *Discovery) (err error) {
+		result.Columns, err = d.Columns(ctx, schema, table)
+		return err
+	})
+}
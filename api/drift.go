@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"retl/inputs"
+	"retl/inputs/drift"
+	"retl/inputs/state"
+	"retl/inputs/types"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+func getSchemaDrift(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) ([]drift.Record, error) {
+	return drift.List(dbClient, chi.URLParam(r, "id"))
+}
+
+// resetSchema forgets the columns a pipeline was configured against, so
+// its next run accepts the source's current columns as the baseline.
+func resetSchema(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) error {
+	return state.New(dbClient).Delete(chi.URLParam(r, "id"), drift.SchemaKey)
+}
+
+// checkDriftPolicy refuses a schema drift policy on an input that cannot
+// detect drift.
+func checkDriftPolicy(connectorType, connectorName string, conf *types.ConfigType) error {
+	if connectorType != "input" || conf == nil {
+		return nil
+	}
+	return inputs.CheckDriftPolicy(connectorName, configLookup(conf))
+}
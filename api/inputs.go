@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"retl/inputs"
+	"retl/inputs/types"
+	"retl/outputs/mapping"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+// inputFor builds the connector of the stored input in the request path.
+func inputFor(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (inputs.Input, error) {
+	return inputByID(dbClient, w, chi.URLParam(r, "id"))
+}
+
+// inputByID builds the connector of a stored input from its config.
+func inputByID(dbClient *supabase.Client, w http.ResponseWriter, id string) (inputs.Input, error) {
+	var rows []InputInDB
+	if _, err := dbClient.From("Inputs").Select("*", "", false).Eq("id", id).ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	conf, ok := configStorageMap[id]
+	if len(rows) == 0 || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, fmt.Errorf("input %s not found", id)
+	}
+	input, err := inputs.New(rows[0].ConnectorName, configLookup(conf))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	return input, nil
+}
+
+// configLookup reads a stored config the way a pod reads its environment.
+func configLookup(conf *types.ConfigType) func(string) string {
+	return func(key string) string {
+		if conf == nil {
+			return ""
+		}
+		if v := conf.Setting(key); v != "" {
+			return v
+		}
+		return conf.Secret(key)
+	}
+}
+
+type TestResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// testInput checks that a stored input can reach its source. A failed
+// check is a normal result, not a server error.
+func testInput(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*TestResult, error) {
+	input, err := inputFor(dbClient, w, r)
+	if err != nil {
+		return nil, err
+	}
+	tester, ok := input.(inputs.ConnectionTester)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return nil, fmt.Errorf("input does not support connection tests")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := tester.TestConnection(ctx); err != nil {
+		return &TestResult{Error: err.Error()}, nil
+	}
+	return &TestResult{OK: true}, nil
+}
+
+const (
+	defaultPreviewRows = 20
+	maxPreviewRows     = 100
+	previewTimeout     = 30 * time.Second
+)
+
+type PreviewRequest struct {
+	Limit int `json:"limit"`
+	// Mapping, when set, is applied to the rows the way the output would.
+	Mapping []mapping.Field `json:"mapping"`
+}
+
+// previewInput reads a sample of what a stored input would write, at most
+// maxPreviewRows rows within previewTimeout, optionally through a field
+// mapping. Nothing is written to Kafka or any destination. The body is
+// optional.
+func previewInput(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*types.Preview, error) {
+	var reqBody PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("error parsing request body: %v", err)
+	}
+	limit := reqBody.Limit
+	if limit <= 0 {
+		limit = defaultPreviewRows
+	}
+	if limit > maxPreviewRows {
+		limit = maxPreviewRows
+	}
+
+	input, err := inputFor(dbClient, w, r)
+	if err != nil {
+		return nil, err
+	}
+	previewer, ok := input.(inputs.Previewer)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return nil, fmt.Errorf("input does not support previews")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), previewTimeout)
+	defer cancel()
+	preview, err := previewer.Preview(ctx, limit)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return nil, fmt.Errorf("preview did not finish within %v", previewTimeout)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return nil, err
+	}
+	if len(reqBody.Mapping) > 0 {
+		if err := applyMapping(preview, &mapping.Mapping{Fields: reqBody.Mapping}); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, err
+		}
+	}
+	return preview, nil
+}
+
+// applyMapping replaces the rows of a preview with their mapped records.
+func applyMapping(preview *types.Preview, m *mapping.Mapping) error {
+	if v := m.Validate(nil, nil); !v.Valid {
+		return fmt.Errorf("invalid field mapping: %s", v.Errors[0])
+	}
+	for i, value := range preview.Rows {
+		var row map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&row); err != nil {
+			return err
+		}
+		mapped, err := m.Apply(row)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i+1, err)
+		}
+		if preview.Rows[i], err = json.Marshal(mapped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"retl/inputs"
+	"retl/outputs"
+	"retl/outputs/mapping"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+// outputByID builds the connector of a stored output from its config.
+func outputByID(dbClient *supabase.Client, w http.ResponseWriter, id string) (outputs.Output, error) {
+	var rows []OutputInDB
+	if _, err := dbClient.From("Outputs").Select("*", "", false).Eq("id", id).ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	conf, ok := configStorageMap[id]
+	if len(rows) == 0 || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, fmt.Errorf("output %s not found", id)
+	}
+	output, err := outputs.New(rows[0].ConnectorName, configLookup(conf))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	return output, nil
+}
+
+// pipelineEnds is the source and destination of a stored pipeline.
+type pipelineEnds struct {
+	SourceID      string `json:"source"`
+	DestinationID string `json:"destination"`
+}
+
+func pipelineByID(dbClient *supabase.Client, w http.ResponseWriter, id string) (*pipelineEnds, error) {
+	var pipelines []pipelineEnds
+	if _, err := dbClient.From("Pipelines").Select("*", "", false).Eq("id", id).ExecuteTo(&pipelines); err != nil {
+		return nil, err
+	}
+	if len(pipelines) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, fmt.Errorf("pipeline %s not found", id)
+	}
+	return &pipelines[0], nil
+}
+
+type MappingRequest struct {
+	Mapping []mapping.Field `json:"mapping"`
+}
+
+// validateMapping checks a field mapping against the columns the
+// pipeline's source produces and the fields its destination knows. A
+// side that cannot be listed is skipped with a warning.
+func validateMapping(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) (*mapping.Validation, error) {
+	var reqBody MappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("error parsing request body: %v", err)
+	}
+	pipeline, err := pipelineByID(dbClient, w, chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err
+	}
+	input, err := inputByID(dbClient, w, pipeline.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	output, err := outputByID(dbClient, w, pipeline.DestinationID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	var warnings []string
+	var columns []string
+	if previewer, ok := input.(inputs.Previewer); ok {
+		preview, err := previewer.Preview(ctx, 0)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return nil, fmt.Errorf("failed to read the source columns: %v", err)
+		}
+		columns = []string{}
+		for _, col := range preview.Columns {
+			columns = append(columns, col.Name)
+		}
+	} else {
+		warnings = append(warnings, "the source does not list its columns, so mapped columns were not checked")
+	}
+	var catalogue *mapping.Catalogue
+	if cataloguer, ok := output.(outputs.Cataloguer); ok {
+		if catalogue, err = cataloguer.Catalogue(ctx); err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return nil, fmt.Errorf("failed to read the destination fields: %v", err)
+		}
+	} else {
+		warnings = append(warnings, "the destination does not list its fields, so mapped fields were not checked")
+	}
+
+	result := (&mapping.Mapping{Fields: reqBody.Mapping}).Validate(columns, catalogue)
+	result.Warnings = append(result.Warnings, warnings...)
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"retl/inputs"
+	"retl/transform"
+
+	"github.com/go-chi/chi"
+	"github.com/supabase-community/supabase-go"
+)
+
+type TransformTestRequest struct {
+	// Transforms, when set, are tried instead of the ones the pipeline's
+	// destination is configured with.
+	Transforms []transform.Step `json:"transforms"`
+	Limit      int              `json:"limit"`
+}
+
+// TransformedRow is a preview row before and after the transforms. Output
+// is left out when a filter dropped the row or a step failed on it.
+type TransformedRow struct {
+	Input    json.RawMessage        `json:"input"`
+	Output   map[string]interface{} `json:"output,omitempty"`
+	Filtered bool                   `json:"filtered"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// testTransforms runs a pipeline's transforms on preview rows of its
+// source. Rows that fail are reported on the row rather than failing the
+// request, the way the consumer would dead-letter them.
+func testTransforms(dbClient *supabase.Client, w http.ResponseWriter, r *http.Request) ([]TransformedRow, error) {
+	var reqBody TransformTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("error parsing request body: %v", err)
+	}
+	limit := reqBody.Limit
+	if limit <= 0 {
+		limit = defaultPreviewRows
+	}
+	if limit > maxPreviewRows {
+		limit = maxPreviewRows
+	}
+
+	pipeline, err := pipelineByID(dbClient, w, chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err
+	}
+	var t *transform.Transform
+	if reqBody.Transforms != nil {
+		t, err = transform.New(reqBody.Transforms)
+	} else {
+		t, err = transform.Parse(configLookup(configStorageMap[pipeline.DestinationID])("TRANSFORMS"))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if t == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("pipeline %s has no transforms", chi.URLParam(r, "id"))
+	}
+
+	input, err := inputByID(dbClient, w, pipeline.SourceID)
+	if err != nil {
+		return nil, err
+	}
+	previewer, ok := input.(inputs.Previewer)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return nil, fmt.Errorf("input does not support previews")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), previewTimeout)
+	defer cancel()
+	preview, err := previewer.Preview(ctx, limit)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return nil, fmt.Errorf("preview did not finish within %v", previewTimeout)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return nil, err
+	}
+
+	results := make([]TransformedRow, 0, len(preview.Rows))
+	for _, row := range preview.Rows {
+		result := TransformedRow{Input: row}
+		record, err := transform.Decode(row)
+		if err == nil {
+			var keep bool
+			if keep, err = t.Apply(record); keep {
+				result.Output = record
+			}
+			result.Filtered = !keep && err == nil
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,51 @@
+package envelope
+
+import "github.com/segmentio/kafka-go"
+
+// Headers describing what a message on the pipeline topic means. Messages
+// without an operation header are upserts, which is all inputs produced
+// before change detection existed.
+const (
+	OpHeader  = "retl-op"
+	KeyHeader = "retl-key"
+
+	// Change data capture inputs also record the source table and the
+	// kind of change (insert, update or delete) that produced the record.
+	TableHeader  = "retl-table"
+	ChangeHeader = "retl-change"
+
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+	// OpPatch updates only the fields of the record and leaves the
+	// others as they are, for changes that do not carry the whole row.
+	OpPatch = "patch"
+)
+
+// New builds a message for a record identified by key. The key is the
+// stable primary key of the source row, not the Kafka partition key.
+func New(pipelineID, op, key string, value []byte) kafka.Message {
+	return kafka.Message{
+		Key:   []byte(pipelineID),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: OpHeader, Value: []byte(op)},
+			{Key: KeyHeader, Value: []byte(key)},
+		},
+	}
+}
+
+func Header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func Op(msg kafka.Message) string {
+	if op := Header(msg, OpHeader); op != "" {
+		return op
+	}
+	return OpUpsert
+}
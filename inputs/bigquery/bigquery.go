@@ -0,0 +1,222 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"retl/inputs/producer"
+	"retl/inputs/types"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BigQuery reads a table or the result of a query from BigQuery. Rows are
+// read through the Storage Read API; queries run as query jobs through the
+// REST API, can be capped with max_bytes_billed, and are read from the
+// table holding their results once they complete.
+type BigQuery struct {
+	Conf *types.ConfigType
+}
+
+type jobReference struct {
+	JobID    string `json:"jobId,omitempty"`
+	Location string `json:"location,omitempty"`
+}
+
+type jobConfiguration struct {
+	DryRun bool               `json:"dryRun,omitempty"`
+	Labels map[string]string  `json:"labels,omitempty"`
+	Query  queryConfiguration `json:"query"`
+}
+
+type queryConfiguration struct {
+	Query              string    `json:"query"`
+	UseLegacySQL       bool      `json:"useLegacySql"`
+	MaximumBytesBilled string    `json:"maximumBytesBilled,omitempty"`
+	DestinationTable   *tableRef `json:"destinationTable,omitempty"`
+}
+
+// job is both the body of a jobs.insert request and the job it returns.
+type job struct {
+	JobReference  jobReference     `json:"jobReference"`
+	Configuration jobConfiguration `json:"configuration"`
+	Status        struct {
+		State       string `json:"state,omitempty"`
+		ErrorResult *struct {
+			Message string `json:"message"`
+		} `json:"errorResult,omitempty"`
+	} `json:"status"`
+	Statistics struct {
+		Query struct {
+			Schema tableSchema `json:"schema"`
+		} `json:"query"`
+	} `json:"statistics"`
+}
+
+// queryResults is the response of jobs.getQueryResults, which is only
+// used to wait for a job; its rows are never requested.
+type queryResults struct {
+	JobComplete bool         `json:"jobComplete"`
+	Schema      *tableSchema `json:"schema"`
+}
+
+type tableResponse struct {
+	Schema tableSchema `json:"schema"`
+}
+
+func (b *BigQuery) Run() error {
+	producer, err := producer.New(b.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	ctx := context.TODO()
+	c, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	pipelineID := os.Getenv("PIPELINE_NAME")
+	emit := func(fields []field, rows []map[string]interface{}) error {
+		msgs := make([]kafka.Message, 0, len(rows))
+		for _, row := range rows {
+			value, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, kafka.Message{Key: []byte(pipelineID), Value: value})
+		}
+		return producer.Write(ctx, msgs...)
+	}
+
+	if query := b.Conf.Setting("query"); query != "" {
+		err = b.runQuery(ctx, c, query, pipelineID, emit)
+	} else {
+		err = b.readTable(ctx, c, emit)
+	}
+	if err != nil {
+		return err
+	}
+	return producer.Close()
+}
+
+func (b *BigQuery) client(ctx context.Context) (*client, error) {
+	return newClient(ctx, b.Conf.Secret("credentials"), b.Conf.Setting("project"), b.Conf.Setting("endpoint"), b.Conf.Setting("storage_endpoint"))
+}
+
+// queryJob returns the job configuration of a query, capped by
+// max_bytes_billed.
+func (b *BigQuery) queryJob(query, pipelineID string) (job, error) {
+	var j job
+	j.JobReference.Location = b.Conf.Setting("location")
+	j.Configuration.Query.Query = query
+	if maxBytes := b.Conf.Setting("max_bytes_billed"); maxBytes != "" {
+		if _, err := strconv.ParseInt(maxBytes, 10, 64); err != nil {
+			return j, fmt.Errorf("invalid max_bytes_billed %q: %v", maxBytes, err)
+		}
+		j.Configuration.Query.MaximumBytesBilled = maxBytes
+	}
+	if label := labelValue(pipelineID); label != "" {
+		j.Configuration.Labels = map[string]string{"retl_pipeline": label}
+	}
+	return j, nil
+}
+
+// runQuery starts a query job, waits for it to complete and reads the
+// table it wrote its results to.
+func (b *BigQuery) runQuery(ctx context.Context, c *client, query, pipelineID string, emit func([]field, []map[string]interface{}) error) error {
+	req, err := b.queryJob(query, pipelineID)
+	if err != nil {
+		return err
+	}
+	var started job
+	if err := c.do(ctx, "POST", []string{"projects", c.project, "jobs"}, nil, req, &started); err != nil {
+		return err
+	}
+	jobID, location := started.JobReference.JobID, started.JobReference.Location
+	params := url.Values{"maxResults": {"0"}, "timeoutMs": {"10000"}}
+	if location != "" {
+		params.Set("location", location)
+	}
+
+	var results queryResults
+	for !results.JobComplete {
+		results = queryResults{}
+		if err := c.do(ctx, "GET", []string{"projects", c.project, "queries", jobID}, params, nil, &results); err != nil {
+			return err
+		}
+	}
+	if results.Schema == nil {
+		return fmt.Errorf("BigQuery returned results without a schema")
+	}
+
+	var done job
+	params.Del("maxResults")
+	params.Del("timeoutMs")
+	if err := c.do(ctx, "GET", []string{"projects", c.project, "jobs", jobID}, params, nil, &done); err != nil {
+		return err
+	}
+	if done.Status.ErrorResult != nil {
+		return fmt.Errorf("BigQuery query failed: %s", done.Status.ErrorResult.Message)
+	}
+	table := done.Configuration.Query.DestinationTable
+	if table == nil {
+		return fmt.Errorf("BigQuery query has no result table; only single statements are supported")
+	}
+	return b.readRows(ctx, c, *table, results.Schema.Fields, emit)
+}
+
+// readTable reads a table without running a query.
+func (b *BigQuery) readTable(ctx context.Context, c *client, emit func([]field, []map[string]interface{}) error) error {
+	table, err := b.table(c)
+	if err != nil {
+		return err
+	}
+	var resp tableResponse
+	if err := c.do(ctx, "GET", table.path(), nil, nil, &resp); err != nil {
+		return err
+	}
+	return b.readRows(ctx, c, table, resp.Schema.Fields, emit)
+}
+
+// table resolves the "table" setting, dataset.table or
+// project.dataset.table.
+func (b *BigQuery) table(c *client) (tableRef, error) {
+	table := b.Conf.Setting("table")
+	parts := strings.Split(table, ".")
+	switch len(parts) {
+	case 2:
+		parts = append([]string{c.project}, parts...)
+	case 3:
+	default:
+		if table == "" {
+			return tableRef{}, fmt.Errorf("bigquery input needs either a table or a query")
+		}
+		return tableRef{}, fmt.Errorf("invalid table reference %q, expected dataset.table or project.dataset.table", table)
+	}
+	return tableRef{ProjectID: parts[0], DatasetID: parts[1], TableID: parts[2]}, nil
+}
+
+// labelValue turns a pipeline id into a valid job label value: lower case
+// letters, digits, underscores and dashes, at most 63 characters.
+func labelValue(pipelineID string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, pipelineID)
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
@@ -0,0 +1,373 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"retl/inputs/types"
+
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"google.golang.org/grpc"
+)
+
+// fakeAPI serves the parts of the BigQuery REST API the input uses for
+// table t1 of dataset d in project p, and for query job j1, whose results
+// are in table r1 of dataset _anon. It counts the requests it gets by path.
+func fakeAPI(t *testing.T) (*httptest.Server, map[string]int) {
+	requests := map[string]int{}
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/bigquery/v2")
+		requests[r.Method+" "+path]++
+		var resp interface{}
+		switch r.Method + " " + path {
+		case "GET /projects/p/datasets/d/tables/t1":
+			resp = map[string]interface{}{"schema": fakeSchema}
+		case "POST /projects/p/jobs":
+			var j job
+			if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+				t.Errorf("invalid job: %v", err)
+			}
+			query = j.Configuration.Query.Query
+			if j.Configuration.DryRun {
+				resp = map[string]interface{}{"statistics": map[string]interface{}{"query": map[string]interface{}{"schema": fakeSchema}}}
+			} else {
+				resp = map[string]interface{}{"jobReference": map[string]string{"jobId": "j1", "location": "EU"}}
+			}
+		case "GET /projects/p/queries/j1":
+			if r.URL.Query().Get("location") != "EU" || r.URL.Query().Get("maxResults") != "0" {
+				t.Errorf("results requested without the job location or with rows: %s", r.URL)
+			}
+			// The job completes on the second poll.
+			if requests[r.Method+" "+path] == 1 {
+				resp = map[string]interface{}{"jobComplete": false}
+			} else {
+				resp = map[string]interface{}{"jobComplete": true, "schema": fakeSchema}
+			}
+		case "GET /projects/p/jobs/j1":
+			status := map[string]interface{}{"state": "DONE"}
+			if strings.Contains(query, "broken") {
+				status["errorResult"] = map[string]string{"message": "Syntax error"}
+			}
+			resp = map[string]interface{}{
+				"status":        status,
+				"configuration": map[string]interface{}{"query": map[string]interface{}{"destinationTable": map[string]string{"projectId": "p", "datasetId": "_anon", "tableId": "r1"}}},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			resp = map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "not found: " + path}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+var fakeSchema = map[string]interface{}{"fields": []map[string]interface{}{
+	{"name": "id", "type": "INTEGER", "mode": "REQUIRED"},
+	{"name": "tags", "type": "STRING", "mode": "REPEATED"},
+}}
+
+// fakeStorage serves the Storage Read API. Whatever the table, it has two
+// rows, sent one record batch at a time in a single stream.
+type fakeStorage struct {
+	storagepb.UnimplementedBigQueryReadServer
+	schema  []byte
+	batches [][]byte
+
+	mu     sync.Mutex
+	tables []string
+}
+
+func startStorage(t *testing.T) (string, *fakeStorage) {
+	s := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+	}, nil)
+	// The API sends the schema once and record batches without it, so
+	// the schema is cut from a stream holding no batches, before its end
+	// of stream marker.
+	var schema bytes.Buffer
+	w := ipc.NewWriter(&schema, ipc.WithSchema(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeStorage{schema: schema.Bytes()[:schema.Len()-8]}
+	for _, row := range []struct {
+		id   int64
+		tags []string
+	}{{1, []string{"a"}}, {2, nil}} {
+		b := array.NewRecordBuilder(memory.DefaultAllocator, s)
+		b.Field(0).(*array.Int64Builder).Append(row.id)
+		tags := b.Field(1).(*array.ListBuilder)
+		tags.Append(true)
+		tags.ValueBuilder().(*array.StringBuilder).AppendValues(row.tags, nil)
+		rec := b.NewRecord()
+		var stream bytes.Buffer
+		w := ipc.NewWriter(&stream, ipc.WithSchema(s))
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		fake.batches = append(fake.batches, stream.Bytes()[len(fake.schema):])
+		rec.Release()
+		b.Release()
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	storagepb.RegisterBigQueryReadServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), fake
+}
+
+func (f *fakeStorage) CreateReadSession(ctx context.Context, req *storagepb.CreateReadSessionRequest) (*storagepb.ReadSession, error) {
+	f.mu.Lock()
+	f.tables = append(f.tables, req.GetReadSession().GetTable())
+	f.mu.Unlock()
+	if req.GetParent() != "projects/p" || req.GetReadSession().GetDataFormat() != storagepb.DataFormat_ARROW {
+		return nil, fmt.Errorf("unexpected session request %v", req)
+	}
+	return &storagepb.ReadSession{
+		Name:    "sessions/s1",
+		Schema:  &storagepb.ReadSession_ArrowSchema{ArrowSchema: &storagepb.ArrowSchema{SerializedSchema: f.schema}},
+		Streams: []*storagepb.ReadStream{{Name: "sessions/s1/streams/0"}},
+	}, nil
+}
+
+func (f *fakeStorage) ReadRows(req *storagepb.ReadRowsRequest, stream storagepb.BigQueryRead_ReadRowsServer) error {
+	for _, batch := range f.batches {
+		err := stream.Send(&storagepb.ReadRowsResponse{
+			Rows:     &storagepb.ReadRowsResponse_ArrowRecordBatch{ArrowRecordBatch: &storagepb.ArrowRecordBatch{SerializedRecordBatch: batch, RowCount: 1}},
+			RowCount: 1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPreview(t *testing.T) {
+	columns := []types.Column{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "tags", Type: "ARRAY<STRING>", Nullable: true},
+	}
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		limit    int
+		rows     []string
+		requests map[string]int
+		tables   []string
+	}{
+		{
+			name:     "table",
+			settings: map[string]interface{}{"table": "d.t1"},
+			limit:    1,
+			rows:     []string{`{"id":1,"tags":["a"]}`},
+			requests: map[string]int{"GET /projects/p/datasets/d/tables/t1": 1},
+			tables:   []string{"projects/p/datasets/d/tables/t1"},
+		},
+		{
+			name:     "table columns only",
+			settings: map[string]interface{}{"table": "p.d.t1"},
+			requests: map[string]int{"GET /projects/p/datasets/d/tables/t1": 1},
+		},
+		{
+			name:     "query",
+			settings: map[string]interface{}{"query": "SELECT id, tags FROM d.t1"},
+			limit:    5,
+			rows:     []string{`{"id":1,"tags":["a"]}`, `{"id":2,"tags":[]}`},
+			requests: map[string]int{"POST /projects/p/jobs": 1, "GET /projects/p/queries/j1": 2, "GET /projects/p/jobs/j1": 1},
+			tables:   []string{"projects/p/datasets/_anon/tables/r1"},
+		},
+		{
+			name:     "query columns only is a dry run",
+			settings: map[string]interface{}{"query": "SELECT id, tags FROM d.t1"},
+			requests: map[string]int{"POST /projects/p/jobs": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := fakeAPI(t)
+			addr, storage := startStorage(t)
+			tt.settings["project"] = "p"
+			tt.settings["endpoint"] = server.URL
+			tt.settings["storage_endpoint"] = addr
+			b := &BigQuery{Conf: &types.ConfigType{Settings: tt.settings}}
+			preview, err := b.Preview(context.Background(), tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(preview.Columns, columns) {
+				t.Errorf("columns = %+v, want %+v", preview.Columns, columns)
+			}
+			var rows []string
+			for _, row := range preview.Rows {
+				rows = append(rows, string(row))
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("rows = %v, want %v", rows, tt.rows)
+			}
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("requests = %v, want %v", requests, tt.requests)
+			}
+			if !reflect.DeepEqual(storage.tables, tt.tables) {
+				t.Errorf("read sessions for %v, want %v", storage.tables, tt.tables)
+			}
+		})
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	server, _ := fakeAPI(t)
+	addr, _ := startStorage(t)
+	b := &BigQuery{Conf: &types.ConfigType{Settings: map[string]interface{}{"table": "d.t1"}}}
+	c, err := newClient(context.Background(), "", "p", server.URL, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var ids []string
+	err = b.readTable(context.Background(), c, func(fields []field, rows []map[string]interface{}) error {
+		for _, row := range rows {
+			ids = append(ids, string(row["id"].(json.Number)))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("read ids %v, want %v", ids, want)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	server, _ := fakeAPI(t)
+	addr, storage := startStorage(t)
+	b := &BigQuery{Conf: &types.ConfigType{Settings: map[string]interface{}{"project": "p", "endpoint": server.URL, "storage_endpoint": addr, "query": "SELECT broken"}}}
+	if _, err := b.Preview(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "Syntax error") {
+		t.Errorf("got error %v, want the job's error", err)
+	}
+	if len(storage.tables) != 0 {
+		t.Errorf("read %v after the query failed", storage.tables)
+	}
+}
+
+func TestQueryJob(t *testing.T) {
+	b := &BigQuery{Conf: &types.ConfigType{Settings: map[string]interface{}{"location": "EU", "max_bytes_billed": "1000000"}}}
+	j, err := b.queryJob("SELECT 1", "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.JobReference.Location != "EU" || j.Configuration.Query.MaximumBytesBilled != "1000000" || j.Configuration.Query.UseLegacySQL {
+		t.Errorf("got job %+v", j)
+	}
+	if !reflect.DeepEqual(j.Configuration.Labels, map[string]string{"retl_pipeline": "orders"}) {
+		t.Errorf("got labels %v", j.Configuration.Labels)
+	}
+
+	b.Conf.Settings["max_bytes_billed"] = "1e6"
+	if _, err := b.queryJob("SELECT 1", ""); err == nil || !strings.Contains(err.Error(), "invalid max_bytes_billed") {
+		t.Errorf("got error %v for an invalid max_bytes_billed", err)
+	}
+}
+
+func TestEmulatorWithoutStorageEndpoint(t *testing.T) {
+	c, err := newClient(context.Background(), "", "p", "http://localhost:9050", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.readClient(context.Background()); err == nil || !strings.Contains(err.Error(), "storage_endpoint") {
+		t.Errorf("got error %v, want storage_endpoint to be required", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	server, _ := fakeAPI(t)
+	b := &BigQuery{Conf: &types.ConfigType{Settings: map[string]interface{}{"project": "p", "endpoint": server.URL, "table": "d.missing"}}}
+	if _, err := b.Preview(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("got error %v, want the API message", err)
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"Orders-Sync_1", "orders-sync_1"},
+		{"a.b c", "a_b_c"},
+		{strings.Repeat("x", 70), strings.Repeat("x", 63)},
+	}
+	for _, tt := range tests {
+		if got := labelValue(tt.in); got != tt.want {
+			t.Errorf("labelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestEmulator runs against a BigQuery emulator such as
+// ghcr.io/goccy/bigquery-emulator when BIGQUERY_EMULATOR_HOST is set,
+// e.g. to http://localhost:9050 for one started with --project=test. Its
+// Storage Read API is expected on BIGQUERY_EMULATOR_GRPC_HOST, by default
+// localhost:9060.
+func TestEmulator(t *testing.T) {
+	endpoint := os.Getenv("BIGQUERY_EMULATOR_HOST")
+	if endpoint == "" {
+		t.Skip("BIGQUERY_EMULATOR_HOST is not set")
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	storageEndpoint := os.Getenv("BIGQUERY_EMULATOR_GRPC_HOST")
+	if storageEndpoint == "" {
+		storageEndpoint = "localhost:9060"
+	}
+	project := os.Getenv("BIGQUERY_EMULATOR_PROJECT")
+	if project == "" {
+		project = "test"
+	}
+	b := &BigQuery{Conf: &types.ConfigType{Settings: map[string]interface{}{
+		"project":          project,
+		"endpoint":         endpoint,
+		"storage_endpoint": storageEndpoint,
+		"query":            "SELECT 1 AS id, 'a' AS name, [1, 2] AS numbers",
+	}}}
+	ctx := context.Background()
+	if err := b.TestConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := b.Preview(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(preview.Rows))
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal(preview.Rows[0], &row); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": 1.0, "name": "a", "numbers": []interface{}{1.0, 2.0}}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("got %v, want %v", row, want)
+	}
+}
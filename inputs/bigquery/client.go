@@ -0,0 +1,147 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	bqstorage "cloud.google.com/go/bigquery/storage/apiv1"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultEndpoint = "https://bigquery.googleapis.com"
+	scope           = "https://www.googleapis.com/auth/bigquery"
+)
+
+// client talks to the BigQuery REST API for metadata and query jobs, and
+// to the Storage Read API for rows. The endpoints can point at a local
+// emulator, in which case credentials are optional.
+type client struct {
+	http            *http.Client
+	creds           *google.Credentials
+	endpoint        string
+	storageEndpoint string
+	project         string
+	read            *bqstorage.BigQueryReadClient
+}
+
+func newClient(ctx context.Context, credentials, project, endpoint, storageEndpoint string) (*client, error) {
+	c := &client{http: http.DefaultClient, endpoint: defaultEndpoint, storageEndpoint: storageEndpoint, project: project}
+	if endpoint != "" {
+		c.endpoint = strings.TrimRight(endpoint, "/")
+	}
+	if credentials != "" {
+		creds, err := google.CredentialsFromJSON(ctx, []byte(credentials), scope)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account credentials: %v", err)
+		}
+		c.creds = creds
+		c.http = oauth2.NewClient(context.Background(), creds.TokenSource)
+		if c.project == "" {
+			c.project = creds.ProjectID
+		}
+	} else if endpoint == "" {
+		return nil, fmt.Errorf("bigquery input needs service account credentials")
+	}
+	if c.project == "" {
+		return nil, fmt.Errorf("bigquery input needs a project")
+	}
+	return c, nil
+}
+
+// readClient connects to the Storage Read API on first use. Without
+// credentials, which is only allowed with a custom endpoint, it expects
+// an emulator listening without TLS on storage_endpoint.
+func (c *client) readClient(ctx context.Context) (*bqstorage.BigQueryReadClient, error) {
+	if c.read != nil {
+		return c.read, nil
+	}
+	var opts []option.ClientOption
+	if c.storageEndpoint != "" {
+		opts = append(opts, option.WithEndpoint(c.storageEndpoint))
+	}
+	if c.creds != nil {
+		opts = append(opts, option.WithCredentials(c.creds))
+	} else {
+		if c.storageEndpoint == "" {
+			return nil, fmt.Errorf("bigquery input needs a storage_endpoint to read from an emulator")
+		}
+		opts = append(opts,
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	}
+	read, err := bqstorage.NewBigQueryReadClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the BigQuery Storage API: %v", err)
+	}
+	c.read = read
+	return read, nil
+}
+
+func (c *client) Close() error {
+	if c.read == nil {
+		return nil
+	}
+	return c.read.Close()
+}
+
+// apiError is the error body returned by Google APIs.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// do sends a request to an API path, given as segments that are escaped
+// individually, and decodes the response into out.
+func (c *client) do(ctx context.Context, method string, path []string, query url.Values, body, out interface{}) error {
+	u := c.endpoint + "/bigquery/v2"
+	for _, segment := range path {
+		u += "/" + url.PathEscape(segment)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("BigQuery request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr apiError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("BigQuery returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("BigQuery returned %s", resp.Status)
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return dec.Decode(out)
+}
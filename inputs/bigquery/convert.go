@@ -0,0 +1,142 @@
+package bigquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"retl/inputs/record"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+)
+
+type tableSchema struct {
+	Fields []field `json:"fields"`
+}
+
+type field struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Mode   string  `json:"mode"`
+	Fields []field `json:"fields"`
+}
+
+// convertRow converts the i-th row of an Arrow record batch from the
+// Storage Read API. Columns are matched to fields by name.
+func convertRow(fields []field, rec arrow.Record, i int, decimalsAsStrings bool) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		indices := rec.Schema().FieldIndices(f.Name)
+		if len(indices) == 0 {
+			continue
+		}
+		v, err := convertValue(f, rec.Column(indices[0]), i, decimalsAsStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", f.Name, err)
+		}
+		row[f.Name] = v
+	}
+	return row, nil
+}
+
+// convertValue maps the i-th value of an Arrow column to its JSON form,
+// following the field's BigQuery type. INTEGER and NUMERIC stay exact,
+// TIMESTAMP is rendered as RFC 3339 in UTC and DATETIME without a zone,
+// JSON columns are embedded as documents, BYTES are base64 encoded,
+// RECORD becomes an object and REPEATED an array. DATE and TIME are
+// rendered as BigQuery renders them and GEOGRAPHY is passed through as WKT.
+func convertValue(f field, arr arrow.Array, i int, decimalsAsStrings bool) (interface{}, error) {
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	if f.Mode == "REPEATED" {
+		list, ok := arr.(*array.List)
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %s", arr.DataType())
+		}
+		element := f
+		element.Mode = ""
+		start, end := list.ValueOffsets(i)
+		values := make([]interface{}, 0, end-start)
+		for j := start; j < end; j++ {
+			v, err := convertValue(element, list.ListValues(), int(j), decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	switch f.Type {
+	case "RECORD", "STRUCT":
+		s, ok := arr.(*array.Struct)
+		if !ok {
+			return nil, fmt.Errorf("expected a record, got %s", arr.DataType())
+		}
+		st := s.DataType().(*arrow.StructType)
+		m := make(map[string]interface{}, len(f.Fields))
+		for _, child := range f.Fields {
+			j, ok := st.FieldIdx(child.Name)
+			if !ok {
+				continue
+			}
+			v, err := convertValue(child, s.Field(j), i, decimalsAsStrings)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s: %v", child.Name, err)
+			}
+			m[child.Name] = v
+		}
+		return m, nil
+	}
+
+	switch a := arr.(type) {
+	case *array.Int64:
+		return json.Number(strconv.FormatInt(a.Value(i), 10)), nil
+	case *array.Float64:
+		return record.Float(a.Value(i)), nil
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.Decimal128:
+		return numeric(a.Value(i).BigInt(), a.DataType().(*arrow.Decimal128Type).Scale, decimalsAsStrings), nil
+	case *array.Decimal256:
+		return numeric(a.Value(i).BigInt(), a.DataType().(*arrow.Decimal256Type).Scale, decimalsAsStrings), nil
+	case *array.Timestamp:
+		t := a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit).UTC()
+		if f.Type == "DATETIME" {
+			return t.Format("2006-01-02T15:04:05.999999"), nil
+		}
+		return t.Format(time.RFC3339Nano), nil
+	case *array.Date32:
+		return a.Value(i).ToTime().Format(time.DateOnly), nil
+	case *array.Time64:
+		return a.Value(i).ToTime(a.DataType().(*arrow.Time64Type).Unit).Format("15:04:05.999999"), nil
+	case *array.Binary:
+		return base64.StdEncoding.EncodeToString(a.Value(i)), nil
+	case *array.String:
+		s := a.Value(i)
+		if f.Type == "JSON" && json.Valid([]byte(s)) {
+			return json.RawMessage(s), nil
+		}
+		return s, nil
+	}
+	return arr.GetOneForMarshal(i), nil
+}
+
+// numeric renders NUMERIC and BIGNUMERIC values, which Arrow carries at
+// the full scale of their type, without trailing zeros.
+func numeric(unscaled *big.Int, scale int32, asString bool) interface{} {
+	text := record.Decimal(unscaled, int(scale), true).(string)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	if asString {
+		return text
+	}
+	return json.Number(text)
+}
@@ -0,0 +1,194 @@
+package bigquery
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/decimal128"
+	"github.com/apache/arrow/go/v17/arrow/decimal256"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+)
+
+// column builds a single-value array of type dt with append.
+func column(dt arrow.DataType, append func(array.Builder)) arrow.Array {
+	b := array.NewBuilder(memory.DefaultAllocator, dt)
+	defer b.Release()
+	append(b)
+	return b.NewArray()
+}
+
+func TestConvertValue(t *testing.T) {
+	bigNumeric, _ := new(big.Int).SetString("12345678901234567890123456750000000000000000000000000000000000000", 10)
+	timestampUS := &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	datetimeUS := &arrow.TimestampType{Unit: arrow.Microsecond}
+	record := arrow.StructOf(arrow.Field{Name: "n", Type: arrow.PrimitiveTypes.Int64, Nullable: true}, arrow.Field{Name: "s", Type: arrow.BinaryTypes.String, Nullable: true})
+	flag := arrow.StructOf(arrow.Field{Name: "b", Type: arrow.FixedWidthTypes.Boolean, Nullable: true})
+	tests := []struct {
+		name     string
+		field    field
+		value    arrow.Array
+		decimals bool
+		want     interface{}
+		err      string
+	}{
+		{name: "null", field: field{Type: "STRING"}, value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.AppendNull() }), want: nil},
+		{name: "string", field: field{Type: "STRING"}, value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append("a") }), want: "a"},
+		{
+			name:  "large integer stays exact",
+			field: field{Type: "INTEGER"},
+			value: column(arrow.PrimitiveTypes.Int64, func(b array.Builder) { b.(*array.Int64Builder).Append(9007199254740993) }),
+			want:  json.Number("9007199254740993"),
+		},
+		{name: "float", field: field{Type: "FLOAT"}, value: column(arrow.PrimitiveTypes.Float64, func(b array.Builder) { b.(*array.Float64Builder).Append(1.25) }), want: 1.25},
+		{name: "float NaN", field: field{Type: "FLOAT64"}, value: column(arrow.PrimitiveTypes.Float64, func(b array.Builder) { b.(*array.Float64Builder).Append(math.NaN()) }), want: "NaN"},
+		{name: "float infinity", field: field{Type: "FLOAT"}, value: column(arrow.PrimitiveTypes.Float64, func(b array.Builder) { b.(*array.Float64Builder).Append(math.Inf(-1)) }), want: "-Inf"},
+		{
+			name:  "numeric",
+			field: field{Type: "NUMERIC"},
+			value: column(&arrow.Decimal128Type{Precision: 38, Scale: 9}, func(b array.Builder) { b.(*array.Decimal128Builder).Append(decimal128.FromI64(1500000000)) }),
+			want:  json.Number("1.5"),
+		},
+		{
+			name:  "whole numeric",
+			field: field{Type: "NUMERIC"},
+			value: column(&arrow.Decimal128Type{Precision: 38, Scale: 9}, func(b array.Builder) { b.(*array.Decimal128Builder).Append(decimal128.FromI64(-20000000000)) }),
+			want:  json.Number("-20"),
+		},
+		{
+			name:  "big numeric",
+			field: field{Type: "BIGNUMERIC"},
+			value: column(&arrow.Decimal256Type{Precision: 76, Scale: 38}, func(b array.Builder) { b.(*array.Decimal256Builder).Append(decimal256.FromBigInt(bigNumeric)) }),
+			want:  json.Number("123456789012345678901234567.5"),
+		},
+		{
+			name:     "numeric as string",
+			field:    field{Type: "NUMERIC"},
+			value:    column(&arrow.Decimal128Type{Precision: 38, Scale: 9}, func(b array.Builder) { b.(*array.Decimal128Builder).Append(decimal128.FromI64(1500000000)) }),
+			decimals: true,
+			want:     "1.5",
+		},
+		{name: "bool", field: field{Type: "BOOLEAN"}, value: column(arrow.FixedWidthTypes.Boolean, func(b array.Builder) { b.(*array.BooleanBuilder).Append(true) }), want: true},
+		{
+			name:  "timestamp",
+			field: field{Type: "TIMESTAMP"},
+			value: column(timestampUS, func(b array.Builder) { b.(*array.TimestampBuilder).Append(1709288430500000) }),
+			want:  "2024-03-01T10:20:30.5Z",
+		},
+		{
+			name:  "datetime has no zone",
+			field: field{Type: "DATETIME"},
+			value: column(datetimeUS, func(b array.Builder) { b.(*array.TimestampBuilder).Append(1709288430500000) }),
+			want:  "2024-03-01T10:20:30.5",
+		},
+		{name: "date", field: field{Type: "DATE"}, value: column(arrow.FixedWidthTypes.Date32, func(b array.Builder) { b.(*array.Date32Builder).Append(19783) }), want: "2024-03-01"},
+		{
+			name:  "time",
+			field: field{Type: "TIME"},
+			value: column(arrow.FixedWidthTypes.Time64us, func(b array.Builder) { b.(*array.Time64Builder).Append(37230500000) }),
+			want:  "10:20:30.5",
+		},
+		{name: "bytes", field: field{Type: "BYTES"}, value: column(arrow.BinaryTypes.Binary, func(b array.Builder) { b.(*array.BinaryBuilder).Append([]byte{0xff, 0}) }), want: "/wA="},
+		{name: "json document", field: field{Type: "JSON"}, value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append(`{"a":1}`) }), want: json.RawMessage(`{"a":1}`)},
+		{name: "invalid json stays a string", field: field{Type: "JSON"}, value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append(`{"a"`) }), want: `{"a"`},
+		{
+			name:  "geography passes through",
+			field: field{Type: "GEOGRAPHY"},
+			value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append("POINT(1 2)") }),
+			want:  "POINT(1 2)",
+		},
+		{
+			name:  "repeated",
+			field: field{Type: "INTEGER", Mode: "REPEATED"},
+			value: column(arrow.ListOf(arrow.PrimitiveTypes.Int64), func(b array.Builder) {
+				b.(*array.ListBuilder).Append(true)
+				b.(*array.ListBuilder).ValueBuilder().(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+			}),
+			want: []interface{}{json.Number("1"), json.Number("2")},
+		},
+		{
+			name:  "repeated that is not a list",
+			field: field{Type: "INTEGER", Mode: "REPEATED"},
+			value: column(arrow.PrimitiveTypes.Int64, func(b array.Builder) { b.(*array.Int64Builder).Append(1) }),
+			err:   "expected a list",
+		},
+		{
+			name:  "record",
+			field: field{Type: "RECORD", Fields: []field{{Name: "n", Type: "INTEGER"}, {Name: "s", Type: "STRING"}}},
+			value: column(record, func(b array.Builder) {
+				b.(*array.StructBuilder).Append(true)
+				b.(*array.StructBuilder).FieldBuilder(0).(*array.Int64Builder).Append(3)
+				b.(*array.StructBuilder).FieldBuilder(1).AppendNull()
+			}),
+			want: map[string]interface{}{"n": json.Number("3"), "s": nil},
+		},
+		{
+			name:  "repeated record",
+			field: field{Type: "RECORD", Mode: "REPEATED", Fields: []field{{Name: "b", Type: "BOOL"}}},
+			value: column(arrow.ListOf(flag), func(b array.Builder) {
+				b.(*array.ListBuilder).Append(true)
+				records := b.(*array.ListBuilder).ValueBuilder().(*array.StructBuilder)
+				records.Append(true)
+				records.FieldBuilder(0).(*array.BooleanBuilder).Append(false)
+			}),
+			want: []interface{}{map[string]interface{}{"b": false}},
+		},
+		{
+			name:  "record that is not a struct",
+			field: field{Type: "RECORD", Fields: []field{{Name: "b", Type: "BOOL"}}},
+			value: column(arrow.BinaryTypes.String, func(b array.Builder) { b.(*array.StringBuilder).Append("x") }),
+			err:   "expected a record",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.value.Release()
+			got, err := convertValue(tt.field, tt.value, 0, tt.decimals)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRow(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).Append("a")
+	b.Field(1).(*array.Int64Builder).Append(1)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	// Columns are matched by name, and fields the batch lacks are left out.
+	fields := []field{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "STRING"}, {Name: "missing", Type: "STRING"}}
+	got, err := convertRow(fields, rec, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": json.Number("1"), "name": "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	if _, err := convertRow([]field{{Name: "id", Type: "INTEGER", Mode: "REPEATED"}}, rec, 0, false); err == nil || !strings.Contains(err.Error(), "invalid value of id") {
+		t.Errorf("got error %v, want the column named", err)
+	}
+}
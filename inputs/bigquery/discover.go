@@ -0,0 +1,184 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+func (b *BigQuery) TestConnection(ctx context.Context) error {
+	c, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+	var resp struct{}
+	return c.do(ctx, "GET", []string{"projects", c.project, "datasets"}, url.Values{"maxResults": {"1"}}, nil, &resp)
+}
+
+// Schemas lists the datasets of the project.
+func (b *BigQuery) Schemas(ctx context.Context) ([]string, error) {
+	c, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	params := url.Values{}
+	for {
+		var resp struct {
+			Datasets []struct {
+				DatasetReference struct {
+					DatasetID string `json:"datasetId"`
+				} `json:"datasetReference"`
+			} `json:"datasets"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, "GET", []string{"projects", c.project, "datasets"}, params, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, d := range resp.Datasets {
+			names = append(names, d.DatasetReference.DatasetID)
+		}
+		if resp.NextPageToken == "" {
+			return names, nil
+		}
+		params.Set("pageToken", resp.NextPageToken)
+	}
+}
+
+func (b *BigQuery) Tables(ctx context.Context, dataset string) ([]string, error) {
+	c, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	params := url.Values{}
+	for {
+		var resp struct {
+			Tables []struct {
+				TableReference struct {
+					TableID string `json:"tableId"`
+				} `json:"tableReference"`
+			} `json:"tables"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, "GET", []string{"projects", c.project, "datasets", dataset, "tables"}, params, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Tables {
+			names = append(names, t.TableReference.TableID)
+		}
+		if resp.NextPageToken == "" {
+			return names, nil
+		}
+		params.Set("pageToken", resp.NextPageToken)
+	}
+}
+
+// Columns lists the top-level fields of a table. Repeated fields are
+// reported as ARRAY<type>.
+func (b *BigQuery) Columns(ctx context.Context, dataset, table string) ([]types.Column, error) {
+	c, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp tableResponse
+	if err := c.do(ctx, "GET", []string{"projects", c.project, "datasets", dataset, "tables", table}, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return columnsOf(resp.Schema.Fields), nil
+}
+
+func columnsOf(fields []field) []types.Column {
+	columns := make([]types.Column, 0, len(fields))
+	for _, f := range fields {
+		col := types.Column{Name: f.Name, Type: f.Type, Nullable: f.Mode != "REQUIRED"}
+		if f.Mode == "REPEATED" {
+			col.Type = "ARRAY<" + f.Type + ">"
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// errPreviewFull stops reading once a preview has its rows.
+var errPreviewFull = errors.New("preview is full")
+
+// Preview reads the first rows of the configured table or query through
+// the Storage Read API. Queries run as a job capped by max_bytes_billed
+// like a run, except that a preview of no rows, which only needs the
+// columns, is a free dry run.
+func (b *BigQuery) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	c, err := b.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	preview := &types.Preview{Rows: []json.RawMessage{}}
+	w := &record.Writer{}
+	emit := func(fields []field, rows []map[string]interface{}) error {
+		if preview.Columns == nil {
+			preview.Columns = columnsOf(fields)
+		}
+		for _, row := range rows {
+			if len(preview.Rows) >= limit {
+				break
+			}
+			if err := w.Sample(preview, row); err != nil {
+				return err
+			}
+		}
+		if len(preview.Rows) >= limit {
+			return errPreviewFull
+		}
+		return nil
+	}
+
+	query := b.Conf.Setting("query")
+	switch {
+	case query != "" && limit <= 0:
+		fields, err := b.dryRun(ctx, c, query)
+		if err != nil {
+			return nil, err
+		}
+		preview.Columns = columnsOf(fields)
+		return preview, nil
+	case query != "":
+		err = b.runQuery(ctx, c, query, "", emit)
+	case limit <= 0:
+		table, err := b.table(c)
+		if err != nil {
+			return nil, err
+		}
+		var resp tableResponse
+		if err := c.do(ctx, "GET", table.path(), nil, nil, &resp); err != nil {
+			return nil, err
+		}
+		preview.Columns = columnsOf(resp.Schema.Fields)
+		return preview, nil
+	default:
+		err = b.readTable(ctx, c, emit)
+	}
+	if err != nil && err != errPreviewFull {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// dryRun validates a query and returns the fields of its result without
+// running it.
+func (b *BigQuery) dryRun(ctx context.Context, c *client, query string) ([]field, error) {
+	req, err := b.queryJob(query, "")
+	if err != nil {
+		return nil, err
+	}
+	req.Configuration.DryRun = true
+	var resp job
+	if err := c.do(ctx, "POST", []string{"projects", c.project, "jobs"}, nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Statistics.Query.Schema.Fields, nil
+}
@@ -0,0 +1,113 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+)
+
+// tableRef names a table, as the REST API spells table references.
+type tableRef struct {
+	ProjectID string `json:"projectId"`
+	DatasetID string `json:"datasetId"`
+	TableID   string `json:"tableId"`
+}
+
+// path is the REST API path of the table.
+func (t tableRef) path() []string {
+	return []string{"projects", t.ProjectID, "datasets", t.DatasetID, "tables", t.TableID}
+}
+
+// name is the resource name the Storage Read API knows the table by.
+func (t tableRef) name() string {
+	return fmt.Sprintf("projects/%s/datasets/%s/tables/%s", t.ProjectID, t.DatasetID, t.TableID)
+}
+
+// readRows reads a table through the Storage Read API in Arrow format,
+// passing the rows of each record batch to emit, which is called at least
+// once so an empty table still yields its fields. The session has a single
+// stream, so rows arrive in the table's order. Sessions are billed to the
+// configured project, whichever project the table is in.
+func (b *BigQuery) readRows(ctx context.Context, c *client, table tableRef, fields []field, emit func([]field, []map[string]interface{}) error) error {
+	read, err := c.readClient(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session, err := read.CreateReadSession(ctx, &storagepb.CreateReadSessionRequest{
+		Parent: "projects/" + c.project,
+		ReadSession: &storagepb.ReadSession{
+			Table:      table.name(),
+			DataFormat: storagepb.DataFormat_ARROW,
+		},
+		MaxStreamCount: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create a BigQuery read session: %v", err)
+	}
+	schema := session.GetArrowSchema().GetSerializedSchema()
+	decimalsAsStrings := b.Conf.Setting("decimals_as_strings") == "true"
+	emitted := false
+	for _, stream := range session.GetStreams() {
+		rows, err := read.ReadRows(ctx, &storagepb.ReadRowsRequest{ReadStream: stream.GetName()})
+		if err != nil {
+			return fmt.Errorf("failed to read BigQuery rows: %v", err)
+		}
+		for {
+			resp, err := rows.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read BigQuery rows: %v", err)
+			}
+			batch := resp.GetArrowRecordBatch()
+			if batch == nil {
+				continue
+			}
+			records, err := decodeBatch(schema, batch.GetSerializedRecordBatch(), fields, decimalsAsStrings)
+			if err != nil {
+				return err
+			}
+			if err := emit(fields, records); err != nil {
+				return err
+			}
+			emitted = true
+		}
+	}
+	if !emitted {
+		return emit(fields, nil)
+	}
+	return nil
+}
+
+// decodeBatch converts a serialized Arrow record batch, which the API
+// sends without its schema, into rows.
+func decodeBatch(schema, batch []byte, fields []field, decimalsAsStrings bool) ([]map[string]interface{}, error) {
+	r, err := ipc.NewReader(io.MultiReader(bytes.NewReader(schema), bytes.NewReader(batch)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Arrow schema from BigQuery: %v", err)
+	}
+	defer r.Release()
+	var rows []map[string]interface{}
+	for r.Next() {
+		rec := r.Record()
+		for i := 0; i < int(rec.NumRows()); i++ {
+			row, err := convertRow(fields, rec, i, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("invalid Arrow record batch from BigQuery: %v", err)
+	}
+	return rows, nil
+}
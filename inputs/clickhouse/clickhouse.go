@@ -0,0 +1,133 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	retldb "retl/db"
+	"retl/inputs/producer"
+	"retl/inputs/state"
+	"retl/inputs/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/ch-go"
+	"github.com/segmentio/kafka-go"
+)
+
+// ClickHouse reads a table or a query from ClickHouse over its native
+// protocol, streaming rows block by block as the server produces them.
+type ClickHouse struct {
+	Conf *types.ConfigType
+}
+
+func (c *ClickHouse) Run() error {
+	producer, err := producer.New(c.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	ctx := context.TODO()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pipelineID := os.Getenv("PIPELINE_NAME")
+	var cursor *state.Cursor
+	if column := c.Conf.Setting("cursor_column"); column != "" {
+		dbClient, err := retldb.NewClient()
+		if err != nil {
+			return err
+		}
+		cursor, err = state.NewCursor(state.New(dbClient), pipelineID, column, c.Conf.Setting("cursor_lookback"))
+		if err != nil {
+			return err
+		}
+	}
+
+	query, params, err := c.buildQuery(cursor)
+	if err != nil {
+		return err
+	}
+	_, err = c.query(ctx, conn, query, params, func(r *result, values []interface{}) error {
+		row := r.row(values)
+		if cursor != nil {
+			cursor.Observe(row[cursor.Column])
+		}
+		value, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if err := producer.Write(ctx, kafka.Message{Key: []byte(pipelineID), Value: value}); err != nil {
+			return fmt.Errorf("failed to write message to Kafka: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := producer.Close(); err != nil {
+		return err
+	}
+	if cursor != nil {
+		return cursor.Commit()
+	}
+	return nil
+}
+
+func (c *ClickHouse) dial(ctx context.Context) (*ch.Client, error) {
+	return connect(ctx, c.Conf.Setting("host"), c.Conf.Setting("port"), c.Conf.Setting("database"),
+		c.Conf.Secret("username"), c.Conf.Secret("password"), c.Conf.Setting("tls") == "true", c.Conf.Secret("ca_cert"))
+}
+
+// buildQuery returns the configured query, or selects the configured
+// table, restricted to new rows when cursor is set.
+func (c *ClickHouse) buildQuery(cursor *state.Cursor) (string, map[string]string, error) {
+	if query := c.Conf.Setting("query"); query != "" {
+		if cursor != nil {
+			return "", nil, fmt.Errorf("incremental syncs are only supported for tables, not queries")
+		}
+		return query, nil, nil
+	}
+
+	table := c.Conf.Setting("table")
+	if table == "" {
+		return "", nil, fmt.Errorf("clickhouse input needs either a table or a query")
+	}
+	var parts []string
+	for _, part := range strings.Split(table, ".") {
+		parts = append(parts, quoteIdentifier(part))
+	}
+	query := "SELECT * FROM " + strings.Join(parts, ".")
+	if cursor == nil {
+		return query, nil, nil
+	}
+	params := map[string]string{}
+	query, err := cursor.Apply(query, quoteIdentifier, func(since string) string {
+		// The mark is passed as a query parameter whose type follows its
+		// form, since ClickHouse does not compare strings with times or
+		// numbers.
+		params["since"] = since
+		if _, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			return "parseDateTime64BestEffort({since:String}, 9, 'UTC')"
+		} else if _, err := strconv.ParseInt(since, 10, 64); err == nil {
+			return "{since:Int64}"
+		} else if _, err := strconv.ParseUint(since, 10, 64); err == nil {
+			return "{since:UInt64}"
+		} else if _, err := strconv.ParseFloat(since, 64); err == nil {
+			return "{since:Float64}"
+		}
+		return "{since:String}"
+	})
+	return query, params, err
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
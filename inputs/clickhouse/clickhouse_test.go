@@ -0,0 +1,177 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/ch-go/proto"
+
+	"retl/inputs/types"
+)
+
+// block encodes the columns of a block as the server sends them.
+func block(t *testing.T, rows int, columns ...interface{}) []byte {
+	t.Helper()
+	var b proto.Buffer
+	for i := 0; i < len(columns); i += 3 {
+		b.PutString(columns[i].(string))
+		b.PutString(columns[i+1].(string))
+		b.PutBool(false) // no custom serialization
+		if rows > 0 {
+			b.PutRaw(native(t, columns[i+2].(proto.ColInput)))
+		}
+	}
+	return b.Buf
+}
+
+func TestDecodeResult(t *testing.T) {
+	r := &result{}
+	decode := func(rows int, data []byte) {
+		t.Helper()
+		b := proto.Block{Columns: 2, Rows: rows}
+		if err := r.DecodeResult(proto.NewReader(bytes.NewReader(data)), int(proto.FeatureCustomSerialization), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The server names the columns in a block without rows first.
+	decode(0, block(t, 0, "id", "UInt64", nil, "name", "LowCardinality(String)", nil))
+	if !reflect.DeepEqual(r.names, []string{"id", "name"}) || !reflect.DeepEqual(r.types, []string{"UInt64", "LowCardinality(String)"}) {
+		t.Fatalf("got columns %q of types %q", r.names, r.types)
+	}
+	if len(r.rows) != 0 {
+		t.Fatalf("got %d rows from the header block", len(r.rows))
+	}
+
+	for _, want := range [][]map[string]interface{}{
+		{{"id": json.Number("1"), "name": "a"}, {"id": json.Number("2"), "name": "b"}},
+		{{"id": json.Number("3"), "name": "a"}},
+	} {
+		ids, names := &proto.ColUInt64{}, (&proto.ColStr{}).LowCardinality()
+		for _, row := range want {
+			id, _ := row["id"].(json.Number).Int64()
+			ids.Append(uint64(id))
+			names.Append(row["name"].(string))
+		}
+		decode(len(want), block(t, len(want), "id", "UInt64", ids, "name", "LowCardinality(String)", names))
+		var got []map[string]interface{}
+		for _, values := range r.rows {
+			got = append(got, r.row(values))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	err := r.DecodeResult(proto.NewReader(bytes.NewReader(nil)), 0, proto.Block{Columns: 1})
+	if err == nil || !strings.Contains(err.Error(), "expected 2") {
+		t.Errorf("got error %v for a block with another number of columns", err)
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     string
+		err      string
+	}{
+		{name: "table", settings: map[string]interface{}{"table": "events"}, want: "SELECT * FROM `events`"},
+		{name: "table in a database", settings: map[string]interface{}{"table": "db.a`b"}, want: "SELECT * FROM `db`.`a\\`b`"},
+		{name: "query", settings: map[string]interface{}{"query": "SELECT 1", "table": "events"}, want: "SELECT 1"},
+		{name: "neither", settings: map[string]interface{}{}, err: "either a table or a query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClickHouse{Conf: &types.ConfigType{Settings: tt.settings}}
+			got, params, err := c.buildQuery(nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || params != nil {
+				t.Errorf("got %q with %v, want %q", got, params, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteParameter(t *testing.T) {
+	if got, want := quoteParameter(`it's a \ path`), `'it\'s a \\ path'`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestServer runs against a ClickHouse server when CLICKHOUSE_HOST is set,
+// for example one started with
+// docker run -p 9000:9000 -e CLICKHOUSE_PASSWORD=test clickhouse/clickhouse-server.
+func TestServer(t *testing.T) {
+	host := os.Getenv("CLICKHOUSE_HOST")
+	if host == "" {
+		t.Skip("CLICKHOUSE_HOST is not set")
+	}
+	c := &ClickHouse{Conf: &types.ConfigType{
+		Settings: map[string]interface{}{
+			"host": host,
+			"port": os.Getenv("CLICKHOUSE_PORT"),
+			"query": `SELECT toUInt64(number) AS id,
+				if(number = 1, NULL, toString(number)) AS name,
+				toLowCardinality(toString(number % 2)) AS parity,
+				toDateTime64('2024-03-01 10:20:30.5', 3, 'UTC') + number AS at,
+				[number, number + 1] AS numbers,
+				map('n', toDecimal64(number, 2)) AS amounts
+				FROM numbers(3)`,
+		},
+		Secrets: map[string]interface{}{
+			"username": os.Getenv("CLICKHOUSE_USERNAME"),
+			"password": os.Getenv("CLICKHOUSE_PASSWORD"),
+		},
+	}}
+	ctx := context.Background()
+	if err := c.TestConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := c.Tables(ctx, "system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) == 0 {
+		t.Fatal("found no tables in the system database")
+	}
+	columns, err := c.Columns(ctx, "system", "numbers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(columns, []types.Column{{Name: "number", Type: "UInt64"}}) {
+		t.Errorf("got columns %+v", columns)
+	}
+
+	preview, err := c.Preview(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range preview.Rows {
+		got = append(got, string(row))
+	}
+	want := []string{
+		`{"amounts":{"n":0.00},"at":"2024-03-01T10:20:30.5Z","id":0,"name":"0","numbers":[0,1],"parity":"0"}`,
+		`{"amounts":{"n":1.00},"at":"2024-03-01T10:20:31.5Z","id":1,"name":null,"numbers":[1,2],"parity":"1"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(preview.Columns) != 6 || preview.Columns[1].Type != "Nullable(String)" || !preview.Columns[1].Nullable {
+		t.Errorf("got columns %+v", preview.Columns)
+	}
+}
@@ -0,0 +1,166 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/ClickHouse/ch-go"
+	"github.com/ClickHouse/ch-go/proto"
+)
+
+// connect connects to ClickHouse over its native protocol, on port 9000, or
+// 9440 with TLS.
+func connect(ctx context.Context, host, port, database, user, password string, useTLS bool, caCert string) (*ch.Client, error) {
+	if host == "" {
+		return nil, fmt.Errorf("clickhouse input needs a host")
+	}
+	if port == "" {
+		port = "9000"
+		if useTLS {
+			port = "9440"
+		}
+	}
+	opts := ch.Options{
+		Address:     net.JoinHostPort(host, port),
+		Database:    database,
+		User:        user,
+		Password:    password,
+		Compression: ch.CompressionLZ4,
+		ClientName:  "retl",
+	}
+	if useTLS {
+		opts.TLS = &tls.Config{ServerName: host}
+		if caCert != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(caCert)) {
+				return nil, fmt.Errorf("failed to parse ClickHouse CA certificate")
+			}
+			opts.TLS.RootCAs = pool
+		}
+	}
+	conn, err := ch.Dial(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ClickHouse: %v", err)
+	}
+	return conn, nil
+}
+
+// result decodes the blocks of a query as the server sends them, so a
+// result set is never held in memory beyond a block. The server sends a
+// block without rows first, which names the columns even when the result
+// is empty.
+type result struct {
+	names             []string
+	types             []string
+	columns           []column
+	decimalsAsStrings bool
+
+	// rows are the rows of the last block.
+	rows [][]interface{}
+}
+
+func (r *result) DecodeResult(rd *proto.Reader, version int, b proto.Block) error {
+	if r.columns != nil && b.Columns != len(r.columns) {
+		return fmt.Errorf("ClickHouse sent a block with %d columns, expected %d", b.Columns, len(r.columns))
+	}
+	values := make([][]interface{}, b.Columns)
+	for i := 0; i < b.Columns; i++ {
+		name, err := rd.Str()
+		if err != nil {
+			return fmt.Errorf("failed to read ClickHouse column name: %v", err)
+		}
+		typ, err := rd.Str()
+		if err != nil {
+			return fmt.Errorf("failed to read ClickHouse type of %s: %v", name, err)
+		}
+		if proto.FeatureCustomSerialization.In(version) {
+			custom, err := rd.Bool()
+			if err != nil {
+				return fmt.Errorf("failed to read ClickHouse serialization of %s: %v", name, err)
+			}
+			if custom {
+				return fmt.Errorf("column %s has a custom serialization, which is not supported", name)
+			}
+		}
+		if len(r.columns) == i {
+			col, err := newColumn(typ, r.decimalsAsStrings)
+			if err != nil {
+				return fmt.Errorf("column %s: %v", name, err)
+			}
+			r.names, r.types, r.columns = append(r.names, name), append(r.types, typ), append(r.columns, col)
+		}
+		if b.Rows == 0 {
+			continue
+		}
+		if err := r.columns[i].prefix(rd); err != nil {
+			return fmt.Errorf("failed to read ClickHouse column %s: %v", name, err)
+		}
+		if values[i], err = r.columns[i].decode(rd, b.Rows); err != nil {
+			return fmt.Errorf("failed to read ClickHouse column %s: %v", name, err)
+		}
+	}
+
+	r.rows = r.rows[:0]
+	for row := 0; row < b.Rows; row++ {
+		r.rows = append(r.rows, make([]interface{}, b.Columns))
+		for i := range values {
+			r.rows[row][i] = values[i][row]
+		}
+	}
+	return nil
+}
+
+// row names the values of a row by their columns.
+func (r *result) row(values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(values))
+	for i, name := range r.names {
+		row[name] = values[i]
+	}
+	return row
+}
+
+// query runs sql with the given query parameters, which the statement
+// refers to as {name:Type}, and calls emit with the values of each row as
+// its block arrives.
+func (c *ClickHouse) query(ctx context.Context, conn *ch.Client, sql string, params map[string]string, emit func(r *result, values []interface{}) error) (*result, error) {
+	r := &result{decimalsAsStrings: c.Conf.Setting("decimals_as_strings") == "true"}
+	var emitErr error
+	q := ch.Query{
+		Body:   sql,
+		Result: r,
+		OnResult: func(ctx context.Context, b proto.Block) error {
+			for _, values := range r.rows {
+				if emitErr = emit(r, values); emitErr != nil {
+					return emitErr
+				}
+			}
+			return nil
+		},
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		q.Parameters = append(q.Parameters, proto.Parameter{Key: name, Value: quoteParameter(params[name])})
+	}
+	if err := conn.Do(ctx, q); err != nil {
+		if emitErr != nil {
+			return nil, emitErr
+		}
+		return nil, fmt.Errorf("ClickHouse query failed: %v", err)
+	}
+	return r, nil
+}
+
+// quoteParameter quotes a query parameter as the server parses it, like a
+// string literal.
+func quoteParameter(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,632 @@
+package clickhouse
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/google/uuid"
+
+	"retl/inputs/record"
+)
+
+// column decodes a column of a ClickHouse type from the native format into
+// record values. Nullable and LowCardinality become plain values or nil,
+// 64-bit and wider integers and decimals become exact numbers, DateTime
+// and DateTime64 become RFC 3339 in UTC, and Array, Map and Tuple are
+// decoded element by element.
+type column interface {
+	// prefix reads the state sent ahead of the column's data, which only
+	// LowCardinality has, but which nests with the type.
+	prefix(r *proto.Reader) error
+	decode(r *proto.Reader, rows int) ([]interface{}, error)
+}
+
+// geoTypes are the aliases the geo types are sent as.
+var geoTypes = map[string]string{
+	"Point":           "Tuple(Float64, Float64)",
+	"Ring":            "Array(Tuple(Float64, Float64))",
+	"LineString":      "Array(Tuple(Float64, Float64))",
+	"MultiLineString": "Array(Array(Tuple(Float64, Float64)))",
+	"Polygon":         "Array(Array(Tuple(Float64, Float64)))",
+	"MultiPolygon":    "Array(Array(Array(Tuple(Float64, Float64))))",
+}
+
+func newColumn(typ string, decimalsAsStrings bool) (column, error) {
+	typ = strings.TrimSpace(typ)
+	if alias, ok := geoTypes[typ]; ok {
+		typ = alias
+	}
+	name, args := typ, ""
+	if i := strings.Index(typ, "("); i >= 0 && strings.HasSuffix(typ, ")") {
+		name, args = typ[:i], typ[i+1:len(typ)-1]
+	}
+
+	switch name {
+	case "Nullable":
+		inner, err := newColumn(args, decimalsAsStrings)
+		if err != nil {
+			return nil, err
+		}
+		return nullableColumn{inner}, nil
+	case "LowCardinality":
+		inner, nullable := args, false
+		if strings.HasPrefix(inner, "Nullable(") && strings.HasSuffix(inner, ")") {
+			inner, nullable = inner[len("Nullable("):len(inner)-1], true
+		}
+		dictionary, err := newColumn(inner, decimalsAsStrings)
+		if err != nil {
+			return nil, err
+		}
+		return lowCardinalityColumn{dictionary, nullable}, nil
+	case "Array":
+		inner, err := newColumn(args, decimalsAsStrings)
+		if err != nil {
+			return nil, err
+		}
+		return arrayColumn{inner}, nil
+	case "Map":
+		parts := splitArgs(args)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s", typ)
+		}
+		key, err := newColumn(parts[0], decimalsAsStrings)
+		if err != nil {
+			return nil, err
+		}
+		value, err := newColumn(parts[1], decimalsAsStrings)
+		if err != nil {
+			return nil, err
+		}
+		return mapColumn{key, value}, nil
+	case "Tuple":
+		var tuple tupleColumn
+		for i, part := range splitArgs(args) {
+			elementName, elementType := tupleElement(part)
+			element, err := newColumn(elementType, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			// A tuple is named when all of its elements are.
+			if elementName != "" && (i == 0 || tuple.names != nil) {
+				tuple.names = append(tuple.names, elementName)
+			} else {
+				tuple.names = nil
+			}
+			tuple.elements = append(tuple.elements, element)
+		}
+		return tuple, nil
+	case "SimpleAggregateFunction":
+		parts := splitArgs(args)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s", typ)
+		}
+		return newColumn(parts[1], decimalsAsStrings)
+	case "Nothing":
+		return nothingColumn{}, nil
+	case "String":
+		return stringColumn{}, nil
+	case "FixedString":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s", typ)
+		}
+		return fixedColumn{n, func(b []byte) interface{} { return string(b) }}, nil
+	case "Bool":
+		return fixedColumn{1, func(b []byte) interface{} { return b[0] != 0 }}, nil
+	case "Int8":
+		return fixedColumn{1, func(b []byte) interface{} { return int64(int8(b[0])) }}, nil
+	case "Int16":
+		return fixedColumn{2, func(b []byte) interface{} { return int64(int16(binary.LittleEndian.Uint16(b))) }}, nil
+	case "Int32":
+		return fixedColumn{4, func(b []byte) interface{} { return int64(int32(binary.LittleEndian.Uint32(b))) }}, nil
+	case "Int64", "IntervalNanosecond", "IntervalMicrosecond", "IntervalMillisecond", "IntervalSecond",
+		"IntervalMinute", "IntervalHour", "IntervalDay", "IntervalWeek", "IntervalMonth", "IntervalQuarter", "IntervalYear":
+		return fixedColumn{8, func(b []byte) interface{} {
+			return json.Number(strconv.FormatInt(int64(binary.LittleEndian.Uint64(b)), 10))
+		}}, nil
+	case "UInt8":
+		return fixedColumn{1, func(b []byte) interface{} { return int64(b[0]) }}, nil
+	case "UInt16":
+		return fixedColumn{2, func(b []byte) interface{} { return int64(binary.LittleEndian.Uint16(b)) }}, nil
+	case "UInt32":
+		return fixedColumn{4, func(b []byte) interface{} { return int64(binary.LittleEndian.Uint32(b)) }}, nil
+	case "UInt64":
+		return fixedColumn{8, func(b []byte) interface{} {
+			return json.Number(strconv.FormatUint(binary.LittleEndian.Uint64(b), 10))
+		}}, nil
+	case "Int128", "Int256", "UInt128", "UInt256":
+		size, signed := 16, strings.HasPrefix(name, "Int")
+		if strings.HasSuffix(name, "256") {
+			size = 32
+		}
+		return fixedColumn{size, func(b []byte) interface{} { return json.Number(littleEndianInt(b, signed).String()) }}, nil
+	case "Float32":
+		return fixedColumn{4, func(b []byte) interface{} {
+			// Go through the shortest text of the float32, so 0.1 does
+			// not become 0.10000000149011612.
+			f := math.Float32frombits(binary.LittleEndian.Uint32(b))
+			v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+			return record.Float(v)
+		}}, nil
+	case "Float64":
+		return fixedColumn{8, func(b []byte) interface{} { return record.Float(math.Float64frombits(binary.LittleEndian.Uint64(b))) }}, nil
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		return decimalColumn(name, args, decimalsAsStrings)
+	case "Date":
+		return fixedColumn{2, func(b []byte) interface{} { return formatDate(int64(binary.LittleEndian.Uint16(b))) }}, nil
+	case "Date32":
+		return fixedColumn{4, func(b []byte) interface{} { return formatDate(int64(int32(binary.LittleEndian.Uint32(b)))) }}, nil
+	case "DateTime":
+		// The time zone only changes how the server renders the value,
+		// which is sent as seconds since the epoch.
+		return fixedColumn{4, func(b []byte) interface{} {
+			return time.Unix(int64(binary.LittleEndian.Uint32(b)), 0).UTC().Format(time.RFC3339Nano)
+		}}, nil
+	case "DateTime64":
+		precision, err := strconv.Atoi(splitArgs(args)[0])
+		if err != nil || precision < 0 || precision > 9 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s", typ)
+		}
+		scale := int64(math.Pow10(precision))
+		return fixedColumn{8, func(b []byte) interface{} {
+			ticks := int64(binary.LittleEndian.Uint64(b))
+			return time.Unix(ticks/scale, ticks%scale*(1e9/scale)).UTC().Format(time.RFC3339Nano)
+		}}, nil
+	case "Enum8", "Enum16":
+		return enumColumn(name, args)
+	case "UUID":
+		return fixedColumn{16, func(b []byte) interface{} {
+			// A UUID is sent as its two halves, each a little-endian
+			// UInt64.
+			var id uuid.UUID
+			for i := 0; i < 8; i++ {
+				id[i], id[8+i] = b[7-i], b[15-i]
+			}
+			return id.String()
+		}}, nil
+	case "IPv4":
+		return fixedColumn{4, func(b []byte) interface{} { return net.IPv4(b[3], b[2], b[1], b[0]).String() }}, nil
+	case "IPv6":
+		return fixedColumn{16, func(b []byte) interface{} { return net.IP(append([]byte(nil), b...)).String() }}, nil
+	}
+	return nil, fmt.Errorf("unsupported ClickHouse type %s", typ)
+}
+
+func decimalColumn(name, args string, decimalsAsStrings bool) (column, error) {
+	parts := splitArgs(args)
+	precision, scale := 0, 0
+	var err error
+	switch name {
+	case "Decimal":
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s(%s)", name, args)
+		}
+		if precision, err = strconv.Atoi(parts[0]); err == nil {
+			scale, err = strconv.Atoi(parts[1])
+		}
+	default:
+		precision = map[string]int{"Decimal32": 9, "Decimal64": 18, "Decimal128": 38, "Decimal256": 76}[name]
+		scale, err = strconv.Atoi(args)
+	}
+	if err != nil || scale < 0 || scale > precision {
+		return nil, fmt.Errorf("invalid ClickHouse type %s(%s)", name, args)
+	}
+
+	// The precision decides the width of the unscaled integer.
+	size := 32
+	switch {
+	case precision <= 9:
+		size = 4
+	case precision <= 18:
+		size = 8
+	case precision <= 38:
+		size = 16
+	}
+	return fixedColumn{size, func(b []byte) interface{} {
+		return record.Decimal(littleEndianInt(b, true), scale, decimalsAsStrings)
+	}}, nil
+}
+
+// enumColumn maps the values of an enum to their names, which the type
+// lists as in Enum8('a' = 1, 'b' = 2).
+func enumColumn(name, args string) (column, error) {
+	names := map[int64]string{}
+	for _, part := range splitArgs(args) {
+		i := strings.LastIndex(part, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid ClickHouse type %s(%s)", name, args)
+		}
+		label := strings.TrimSpace(part[:i])
+		value, err := strconv.ParseInt(strings.TrimSpace(part[i+1:]), 10, 64)
+		if err != nil || len(label) < 2 || label[0] != '\'' || label[len(label)-1] != '\'' {
+			return nil, fmt.Errorf("invalid ClickHouse type %s(%s)", name, args)
+		}
+		names[value] = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(label[1 : len(label)-1])
+	}
+	size := 1
+	if name == "Enum16" {
+		size = 2
+	}
+	return fixedColumn{size, func(b []byte) interface{} {
+		value := int64(int8(b[0]))
+		if size == 2 {
+			value = int64(int16(binary.LittleEndian.Uint16(b)))
+		}
+		if label, ok := names[value]; ok {
+			return label
+		}
+		return value
+	}}, nil
+}
+
+// fixedColumn decodes types whose values all have the same size.
+type fixedColumn struct {
+	size  int
+	value func(b []byte) interface{}
+}
+
+func (c fixedColumn) prefix(r *proto.Reader) error { return nil }
+
+func (c fixedColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	values := make([]interface{}, rows)
+	if rows == 0 || c.size == 0 {
+		for i := range values {
+			values[i] = c.value(nil)
+		}
+		return values, nil
+	}
+	data, err := r.ReadRaw(rows * c.size)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = c.value(data[i*c.size : (i+1)*c.size])
+	}
+	return values, nil
+}
+
+type stringColumn struct{}
+
+func (stringColumn) prefix(r *proto.Reader) error { return nil }
+
+func (stringColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	values := make([]interface{}, rows)
+	for i := range values {
+		s, err := r.Str()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// nothingColumn is the type of NULL literals, sent as one byte per row.
+type nothingColumn struct{}
+
+func (nothingColumn) prefix(r *proto.Reader) error { return nil }
+
+func (nothingColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	if rows > 0 {
+		if _, err := r.ReadRaw(rows); err != nil {
+			return nil, err
+		}
+	}
+	return make([]interface{}, rows), nil
+}
+
+// nullableColumn is sent as a byte per row, set for nulls, followed by
+// the values, which hold a default where the row is null.
+type nullableColumn struct {
+	inner column
+}
+
+func (c nullableColumn) prefix(r *proto.Reader) error { return c.inner.prefix(r) }
+
+func (c nullableColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	nulls := make([]byte, rows)
+	if err := r.ReadFull(nulls); err != nil {
+		return nil, err
+	}
+	values, err := c.inner.decode(r, rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, null := range nulls {
+		if null != 0 {
+			values[i] = nil
+		}
+	}
+	return values, nil
+}
+
+// arrayColumn is sent as the offset where each row's elements end,
+// followed by the elements of all rows.
+type arrayColumn struct {
+	inner column
+}
+
+func (c arrayColumn) prefix(r *proto.Reader) error { return c.inner.prefix(r) }
+
+func (c arrayColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	offsets, err := readOffsets(r, rows)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := c.inner.decode(r, total(offsets))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, rows)
+	start := 0
+	for i, end := range offsets {
+		values[i] = elements[start:end:end]
+		start = end
+	}
+	return values, nil
+}
+
+// mapColumn is sent like an array of key and value tuples, whose keys
+// become the names of an object.
+type mapColumn struct {
+	key, value column
+}
+
+func (c mapColumn) prefix(r *proto.Reader) error {
+	if err := c.key.prefix(r); err != nil {
+		return err
+	}
+	return c.value.prefix(r)
+}
+
+func (c mapColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	offsets, err := readOffsets(r, rows)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.key.decode(r, total(offsets))
+	if err != nil {
+		return nil, err
+	}
+	elements, err := c.value.decode(r, total(offsets))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, rows)
+	start := 0
+	for i, end := range offsets {
+		entries := make(map[string]interface{}, end-start)
+		for j := start; j < end; j++ {
+			entries[mapKey(keys[j])] = elements[j]
+		}
+		values[i] = entries
+		start = end
+	}
+	return values, nil
+}
+
+func mapKey(key interface{}) string {
+	switch key := key.(type) {
+	case string:
+		return key
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(key)
+}
+
+// tupleColumn is sent as one column per element. Named tuples become
+// objects, and unnamed ones arrays.
+type tupleColumn struct {
+	names    []string
+	elements []column
+}
+
+func (c tupleColumn) prefix(r *proto.Reader) error {
+	for _, element := range c.elements {
+		if err := element.prefix(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c tupleColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	columns := make([][]interface{}, len(c.elements))
+	for i, element := range c.elements {
+		values, err := element.decode(r, rows)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = values
+	}
+	values := make([]interface{}, rows)
+	for row := range values {
+		if c.names != nil {
+			object := make(map[string]interface{}, len(c.names))
+			for i, name := range c.names {
+				object[name] = columns[i][row]
+			}
+			values[row] = object
+			continue
+		}
+		items := make([]interface{}, len(columns))
+		for i := range columns {
+			items[i] = columns[i][row]
+		}
+		values[row] = items
+	}
+	return values, nil
+}
+
+// LowCardinality sends a dictionary of the block's values followed by
+// each row's index into it. For LowCardinality(Nullable(T)) the
+// dictionary holds T, and index 0 stands for null.
+const (
+	lowCardinalityVersion = 1 // shared dictionaries with additional keys
+	lowCardinalityGlobal  = 1 << 8
+	lowCardinalityKeys    = 1 << 9
+)
+
+type lowCardinalityColumn struct {
+	dictionary column
+	nullable   bool
+}
+
+func (c lowCardinalityColumn) prefix(r *proto.Reader) error {
+	version, err := r.Int64()
+	if err != nil {
+		return err
+	}
+	if version != lowCardinalityVersion {
+		return fmt.Errorf("unsupported LowCardinality serialization version %d", version)
+	}
+	return nil
+}
+
+func (c lowCardinalityColumn) decode(r *proto.Reader, rows int) ([]interface{}, error) {
+	if rows == 0 {
+		return []interface{}{}, nil
+	}
+	meta, err := r.Int64()
+	if err != nil {
+		return nil, err
+	}
+	if meta&lowCardinalityGlobal != 0 || meta&lowCardinalityKeys == 0 {
+		return nil, fmt.Errorf("unsupported LowCardinality dictionary %#x", meta)
+	}
+	size := 1 << (meta & 0xff)
+	if size > 8 {
+		return nil, fmt.Errorf("invalid LowCardinality index type %d", meta&0xff)
+	}
+
+	dictionaryRows, err := r.Int64()
+	if err != nil {
+		return nil, err
+	}
+	if dictionaryRows < 0 || dictionaryRows > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid LowCardinality dictionary size %d", dictionaryRows)
+	}
+	dictionary, err := c.dictionary.decode(r, int(dictionaryRows))
+	if err != nil {
+		return nil, err
+	}
+	keyRows, err := r.Int64()
+	if err != nil {
+		return nil, err
+	}
+	if keyRows != int64(rows) {
+		return nil, fmt.Errorf("LowCardinality column has %d rows, expected %d", keyRows, rows)
+	}
+	data, err := r.ReadRaw(rows * size)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, rows)
+	for i := range values {
+		var key uint64
+		for j := size - 1; j >= 0; j-- {
+			key = key<<8 | uint64(data[i*size+j])
+		}
+		if key >= uint64(len(dictionary)) {
+			return nil, fmt.Errorf("LowCardinality index %d out of range of %d values", key, len(dictionary))
+		}
+		if !(c.nullable && key == 0) {
+			values[i] = dictionary[key]
+		}
+	}
+	return values, nil
+}
+
+// readOffsets reads the end offsets of the rows of an array or map.
+func readOffsets(r *proto.Reader, rows int) ([]int, error) {
+	offsets := make([]int, rows)
+	if rows == 0 {
+		return offsets, nil
+	}
+	data, err := r.ReadRaw(rows * 8)
+	if err != nil {
+		return nil, err
+	}
+	previous := uint64(0)
+	for i := range offsets {
+		offset := binary.LittleEndian.Uint64(data[i*8:])
+		if offset < previous || offset > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid array offset %d", offset)
+		}
+		offsets[i], previous = int(offset), offset
+	}
+	return offsets, nil
+}
+
+func total(offsets []int) int {
+	if len(offsets) == 0 {
+		return 0
+	}
+	return offsets[len(offsets)-1]
+}
+
+// littleEndianInt reads an integer of any width, stored little-endian.
+func littleEndianInt(b []byte, signed bool) *big.Int {
+	bigEndian := make([]byte, len(b))
+	for i := range b {
+		bigEndian[len(b)-1-i] = b[i]
+	}
+	n := new(big.Int).SetBytes(bigEndian)
+	if signed && len(b) > 0 && b[len(b)-1]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return n
+}
+
+func formatDate(days int64) string {
+	return time.Unix(days*24*60*60, 0).UTC().Format("2006-01-02")
+}
+
+// splitArgs splits type arguments at top-level commas, so
+// "String, Array(Tuple(Int8, String))" yields two arguments.
+func splitArgs(args string) []string {
+	var parts []string
+	depth, start, quoted, escaped := 0, 0, false, false
+	for i, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(args[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(args[start:]))
+}
+
+// tupleElement splits the name off an element of a named tuple, as in
+// "id UInt64", which may be quoted as in "`user id` UInt64".
+func tupleElement(element string) (string, string) {
+	if strings.HasPrefix(element, "`") {
+		if i := strings.Index(element[1:], "` "); i >= 0 {
+			return element[1 : i+1], strings.TrimSpace(element[i+3:])
+		}
+	}
+	if i := strings.Index(element, " "); i >= 0 && !strings.Contains(element[:i], "(") {
+		return element[:i], strings.TrimSpace(element[i+1:])
+	}
+	return "", element
+}
@@ -0,0 +1,344 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/google/uuid"
+)
+
+// native encodes a column the way the server sends it, with its state
+// prefix ahead of its data.
+func native(t *testing.T, col proto.ColInput) []byte {
+	t.Helper()
+	if p, ok := col.(proto.Preparable); ok {
+		if err := p.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b proto.Buffer
+	if s, ok := col.(proto.StateEncoder); ok {
+		s.EncodeState(&b)
+	}
+	col.EncodeColumn(&b)
+	return b.Buf
+}
+
+func TestDecodeColumn(t *testing.T) {
+	ints := func(vs ...int64) *proto.ColInt64 {
+		c := proto.ColInt64(vs)
+		return &c
+	}
+	strs := func(vs ...string) *proto.ColStr {
+		c := &proto.ColStr{}
+		c.AppendArr(vs)
+		return c
+	}
+	at := time.Date(2024, 3, 1, 10, 20, 30, 500000000, time.UTC)
+	id := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+
+	tests := []struct {
+		name     string
+		typ      string
+		rows     int
+		data     func(t *testing.T) []byte
+		decimals bool
+		want     []interface{}
+		err      string
+	}{
+		{
+			name: "string", typ: "String", rows: 2,
+			data: func(t *testing.T) []byte { return native(t, strs("a", "")) },
+			want: []interface{}{"a", ""},
+		},
+		{
+			name: "fixed string", typ: "FixedString(2)", rows: 2,
+			data: func(t *testing.T) []byte { return []byte("abcd") },
+			want: []interface{}{"ab", "cd"},
+		},
+		{
+			name: "small integers", typ: "Int16", rows: 2,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColInt16{-2, 300}) },
+			want: []interface{}{int64(-2), int64(300)},
+		},
+		{
+			name: "64-bit integers stay exact", typ: "Int64", rows: 2,
+			data: func(t *testing.T) []byte { return native(t, ints(-1, 9007199254740993)) },
+			want: []interface{}{json.Number("-1"), json.Number("9007199254740993")},
+		},
+		{
+			name: "unsigned 64-bit integer", typ: "UInt64", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColUInt64{18446744073709551615}) },
+			want: []interface{}{json.Number("18446744073709551615")},
+		},
+		{
+			name: "128-bit integer", typ: "Int128", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColInt128{proto.Int128FromInt(-5)}) },
+			want: []interface{}{json.Number("-5")},
+		},
+		{
+			name: "float32 keeps its shortest form", typ: "Float32", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColFloat32{0.1}) },
+			want: []interface{}{0.1},
+		},
+		{
+			name: "float64", typ: "Float64", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColFloat64{1.25}) },
+			want: []interface{}{1.25},
+		},
+		{
+			name: "bool", typ: "Bool", rows: 2,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColBool{true, false}) },
+			want: []interface{}{true, false},
+		},
+		{
+			name: "decimal", typ: "Decimal(18, 2)", rows: 2,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColDecimal64{12345, -5}) },
+			want: []interface{}{json.Number("123.45"), json.Number("-0.05")},
+		},
+		{
+			name: "decimal as string", typ: "Decimal32(3)", rows: 1, decimals: true,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColDecimal32{1500}) },
+			want: []interface{}{"1.500"},
+		},
+		{
+			name: "wide decimal", typ: "Decimal(38, 10)", rows: 1,
+			data: func(t *testing.T) []byte {
+				return native(t, &proto.ColDecimal128{proto.Decimal128(proto.Int128FromInt(-12345678901))})
+			},
+			want: []interface{}{json.Number("-1.2345678901")},
+		},
+		{
+			name: "date", typ: "Date", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColDate{proto.ToDate(at)}) },
+			want: []interface{}{"2024-03-01"},
+		},
+		{
+			name: "date before the epoch", typ: "Date32", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColDate32{-1}) },
+			want: []interface{}{"1969-12-31"},
+		},
+		{
+			name: "datetime in another time zone", typ: "DateTime('Europe/Berlin')", rows: 1,
+			data: func(t *testing.T) []byte {
+				return native(t, &proto.ColDateTime{Data: []proto.DateTime{proto.ToDateTime(at)}})
+			},
+			want: []interface{}{"2024-03-01T10:20:30Z"},
+		},
+		{
+			name: "datetime64", typ: "DateTime64(3, 'UTC')", rows: 2,
+			data: func(t *testing.T) []byte {
+				c := (&proto.ColDateTime64{}).WithPrecision(proto.PrecisionMilli)
+				c.Append(at)
+				c.Append(time.Date(1969, 12, 31, 23, 59, 59, 250000000, time.UTC))
+				return native(t, c)
+			},
+			want: []interface{}{"2024-03-01T10:20:30.5Z", "1969-12-31T23:59:59.25Z"},
+		},
+		{
+			name: "enum", typ: "Enum8('a' = 1, 'it\\'s, b' = -2)", rows: 3,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColEnum8{1, -2, 3}) },
+			want: []interface{}{"a", "it's, b", int64(3)},
+		},
+		{
+			name: "uuid", typ: "UUID", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColUUID{id}) },
+			want: []interface{}{id.String()},
+		},
+		{
+			name: "ip addresses", typ: "Tuple(IPv4, IPv6)", rows: 1,
+			data: func(t *testing.T) []byte {
+				return native(t, proto.ColTuple{
+					&proto.ColIPv4{proto.ToIPv4(netip.MustParseAddr("10.0.0.1"))},
+					&proto.ColIPv6{proto.ToIPv6(netip.MustParseAddr("2001:db8::1"))},
+				})
+			},
+			want: []interface{}{[]interface{}{"10.0.0.1", "2001:db8::1"}},
+		},
+		{
+			name: "nullable", typ: "Nullable(Int64)", rows: 2,
+			data: func(t *testing.T) []byte {
+				c := ints().Nullable()
+				c.Append(proto.NewNullable[int64](7))
+				c.Append(proto.Null[int64]())
+				return native(t, c)
+			},
+			want: []interface{}{json.Number("7"), nil},
+		},
+		{
+			name: "low cardinality", typ: "LowCardinality(String)", rows: 3,
+			data: func(t *testing.T) []byte {
+				c := strs().LowCardinality()
+				c.AppendArr([]string{"x", "y", "x"})
+				return native(t, c)
+			},
+			want: []interface{}{"x", "y", "x"},
+		},
+		{
+			name: "low cardinality of nullable", typ: "LowCardinality(Nullable(String))", rows: 3,
+			data: func(t *testing.T) []byte {
+				b := &proto.Buffer{}
+				b.PutInt64(1)      // version
+				b.PutInt64(1 << 9) // additional keys, UInt8 indexes
+				b.PutInt64(2)      // dictionary rows
+				b.PutString("")    // null, which comes first
+				b.PutString("x")
+				b.PutInt64(3)             // rows
+				b.PutRaw([]byte{1, 0, 1}) // indexes
+				return b.Buf
+			},
+			want: []interface{}{"x", nil, "x"},
+		},
+		{
+			name: "array of nullable", typ: "Array(Nullable(Int64))", rows: 3,
+			data: func(t *testing.T) []byte {
+				c := proto.NewArray[proto.Nullable[int64]](ints().Nullable())
+				c.Append([]proto.Nullable[int64]{proto.NewNullable[int64](1), proto.Null[int64]()})
+				c.Append(nil)
+				c.Append([]proto.Nullable[int64]{proto.NewNullable[int64](3)})
+				return native(t, c)
+			},
+			want: []interface{}{
+				[]interface{}{json.Number("1"), nil},
+				[]interface{}{},
+				[]interface{}{json.Number("3")},
+			},
+		},
+		{
+			name: "array of low cardinality", typ: "Array(LowCardinality(String))", rows: 2,
+			data: func(t *testing.T) []byte {
+				c := proto.NewArray[string](strs().LowCardinality())
+				c.Append([]string{"a", "b"})
+				c.Append([]string{"a"})
+				return native(t, c)
+			},
+			want: []interface{}{[]interface{}{"a", "b"}, []interface{}{"a"}},
+		},
+		{
+			name: "empty arrays of low cardinality", typ: "Array(LowCardinality(String))", rows: 1,
+			data: func(t *testing.T) []byte {
+				b := &proto.Buffer{}
+				b.PutInt64(1) // version
+				b.PutUInt64(0)
+				return b.Buf
+			},
+			want: []interface{}{[]interface{}{}},
+		},
+		{
+			name: "map", typ: "Map(String, Int64)", rows: 2,
+			data: func(t *testing.T) []byte {
+				c := proto.NewMap[string, int64](strs(), ints())
+				c.Append(map[string]int64{"a": 1})
+				c.Append(map[string]int64{})
+				return native(t, c)
+			},
+			want: []interface{}{map[string]interface{}{"a": json.Number("1")}, map[string]interface{}{}},
+		},
+		{
+			name: "map with integer keys", typ: "Map(UInt8, String)", rows: 1,
+			data: func(t *testing.T) []byte {
+				c := proto.NewMap[uint8, string](&proto.ColUInt8{}, strs())
+				c.Append(map[uint8]string{2: "b"})
+				return native(t, c)
+			},
+			want: []interface{}{map[string]interface{}{"2": "b"}},
+		},
+		{
+			name: "named tuple", typ: "Tuple(id Int64, `user name` LowCardinality(String))", rows: 1,
+			data: func(t *testing.T) []byte {
+				lc := strs().LowCardinality()
+				lc.Append("ann")
+				return native(t, proto.ColTuple{ints(1), lc})
+			},
+			want: []interface{}{map[string]interface{}{"id": json.Number("1"), "user name": "ann"}},
+		},
+		{
+			name: "point", typ: "Point", rows: 1,
+			data: func(t *testing.T) []byte {
+				return native(t, proto.ColTuple{&proto.ColFloat64{1.5}, &proto.ColFloat64{-2}})
+			},
+			want: []interface{}{[]interface{}{1.5, -2.0}},
+		},
+		{
+			name: "simple aggregate function", typ: "SimpleAggregateFunction(sum, UInt64)", rows: 1,
+			data: func(t *testing.T) []byte { return native(t, &proto.ColUInt64{3}) },
+			want: []interface{}{json.Number("3")},
+		},
+		{
+			name: "null literal", typ: "Nullable(Nothing)", rows: 2,
+			data: func(t *testing.T) []byte { return []byte{1, 1, 0, 0} },
+			want: []interface{}{nil, nil},
+		},
+		{
+			name: "truncated column", typ: "Int32", rows: 2,
+			data: func(t *testing.T) []byte { return []byte{1, 0, 0, 0} },
+			err:  "EOF",
+		},
+		{
+			name: "unsupported type", typ: "AggregateFunction(uniq, String)",
+			err: "unsupported ClickHouse type",
+		},
+		{
+			name: "global dictionary", typ: "LowCardinality(String)", rows: 1,
+			data: func(t *testing.T) []byte {
+				b := &proto.Buffer{}
+				b.PutInt64(1)
+				b.PutInt64(1<<8 | 1<<9)
+				return b.Buf
+			},
+			err: "unsupported LowCardinality dictionary",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeColumn(tt.typ, tt.rows, tt.data, tt.decimals, t)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func decodeColumn(typ string, rows int, data func(t *testing.T) []byte, decimals bool, t *testing.T) ([]interface{}, error) {
+	col, err := newColumn(typ, decimals)
+	if err != nil {
+		return nil, err
+	}
+	r := proto.NewReader(bytes.NewReader(data(t)))
+	if err := col.prefix(r); err != nil {
+		return nil, err
+	}
+	return col.decode(r, rows)
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"String", []string{"String"}},
+		{"String, Array(Tuple(Int8, String))", []string{"String", "Array(Tuple(Int8, String))"}},
+		{"'a,b' = 1, 'c' = 2", []string{"'a,b' = 1", "'c' = 2"}},
+		{`'it\'s, (' = 1, 'd' = 2`, []string{`'it\'s, (' = 1`, "'d' = 2"}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
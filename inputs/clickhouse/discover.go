@@ -0,0 +1,111 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+func (c *ClickHouse) TestConnection(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Ping(ctx)
+}
+
+// Schemas lists the databases, leaving out the server's own.
+func (c *ClickHouse) Schemas(ctx context.Context) ([]string, error) {
+	return c.list(ctx, `SELECT name FROM system.databases
+		WHERE name NOT IN ('system', 'information_schema', 'INFORMATION_SCHEMA') ORDER BY name`, nil)
+}
+
+func (c *ClickHouse) Tables(ctx context.Context, database string) ([]string, error) {
+	return c.list(ctx, "SELECT name FROM system.tables WHERE database = {database:String} ORDER BY name",
+		map[string]string{"database": database})
+}
+
+func (c *ClickHouse) Columns(ctx context.Context, database, table string) ([]types.Column, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var columns []types.Column
+	_, err = c.query(ctx, conn, `SELECT name, type, is_in_primary_key FROM system.columns
+		WHERE database = {database:String} AND table = {table:String} ORDER BY position`,
+		map[string]string{"database": database, "table": table},
+		func(r *result, row []interface{}) error {
+			name, typ := fmt.Sprint(row[0]), fmt.Sprint(row[1])
+			columns = append(columns, types.Column{
+				Name:       name,
+				Type:       typ,
+				Nullable:   nullable(typ),
+				PrimaryKey: fmt.Sprint(row[2]) == "1",
+			})
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+func (c *ClickHouse) list(ctx context.Context, query string, params map[string]string) ([]string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var names []string
+	_, err = c.query(ctx, conn, query, params, func(r *result, row []interface{}) error {
+		names = append(names, fmt.Sprint(row[0]))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Preview reads the first rows of the configured table or query. It
+// selects the whole table, not just the rows new since the last
+// incremental sync.
+func (c *ClickHouse) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	query, params, err := c.buildQuery(nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	preview := &types.Preview{Rows: []json.RawMessage{}}
+	w := &record.Writer{}
+	result, err := c.query(ctx, conn, record.LimitQuery(query, limit), params, func(r *result, values []interface{}) error {
+		if len(preview.Rows) >= limit {
+			return nil
+		}
+		return w.Sample(preview, r.row(values))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range result.names {
+		preview.Columns = append(preview.Columns, types.Column{Name: name, Type: result.types[i], Nullable: nullable(result.types[i])})
+	}
+	return preview, nil
+}
+
+func nullable(typ string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(typ, "LowCardinality("), "Nullable(")
+}
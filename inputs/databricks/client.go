@@ -0,0 +1,255 @@
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pollInterval = time.Second
+
+// client runs statements on a SQL warehouse through the Statement
+// Execution API.
+type client struct {
+	http        *http.Client
+	host        string
+	token       string
+	warehouseID string
+	catalog     string
+	schema      string
+	// externalLinks fetches results from cloud storage instead of inline,
+	// which lifts the 25 MiB limit on inline results.
+	externalLinks bool
+}
+
+func newClient(host, token, warehouseID, catalog, schema string, externalLinks bool) (*client, error) {
+	if host == "" || warehouseID == "" {
+		return nil, fmt.Errorf("databricks input needs a host and a warehouse id")
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return &client{
+		http:          &http.Client{Timeout: 5 * time.Minute},
+		host:          strings.TrimRight(host, "/"),
+		token:         token,
+		warehouseID:   warehouseID,
+		catalog:       catalog,
+		schema:        schema,
+		externalLinks: externalLinks,
+	}, nil
+}
+
+type parameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type statementRequest struct {
+	Statement     string      `json:"statement"`
+	WarehouseID   string      `json:"warehouse_id"`
+	Catalog       string      `json:"catalog,omitempty"`
+	Schema        string      `json:"schema,omitempty"`
+	Parameters    []parameter `json:"parameters,omitempty"`
+	Disposition   string      `json:"disposition"`
+	Format        string      `json:"format"`
+	WaitTimeout   string      `json:"wait_timeout"`
+	OnWaitTimeout string      `json:"on_wait_timeout"`
+}
+
+type statementResponse struct {
+	StatementID string `json:"statement_id"`
+	Status      struct {
+		State string `json:"state"`
+		Error *struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		} `json:"error"`
+	} `json:"status"`
+	Manifest struct {
+		Schema struct {
+			Columns []column `json:"columns"`
+		} `json:"schema"`
+	} `json:"manifest"`
+	Result *chunk `json:"result"`
+}
+
+type column struct {
+	Name     string `json:"name"`
+	TypeName string `json:"type_name"`
+}
+
+// chunk is one part of a result. Values come as strings, or null; inline
+// chunks carry them in DataArray, external ones behind a link.
+type chunk struct {
+	DataArray      [][]*string `json:"data_array"`
+	NextChunkIndex *int        `json:"next_chunk_index"`
+	ExternalLinks  []struct {
+		ExternalLink   string `json:"external_link"`
+		NextChunkIndex *int   `json:"next_chunk_index"`
+	} `json:"external_links"`
+}
+
+// execute runs a statement and waits for it to finish. Parameters are
+// referred to as :name in the statement.
+func (c *client) execute(ctx context.Context, statement string, params map[string]string) (*result, error) {
+	req := statementRequest{
+		Statement:     statement,
+		WarehouseID:   c.warehouseID,
+		Catalog:       c.catalog,
+		Schema:        c.schema,
+		Disposition:   "INLINE",
+		Format:        "JSON_ARRAY",
+		WaitTimeout:   "30s",
+		OnWaitTimeout: "CONTINUE",
+	}
+	if c.externalLinks {
+		req.Disposition = "EXTERNAL_LINKS"
+	}
+	for name, value := range params {
+		req.Parameters = append(req.Parameters, parameter{Name: name, Value: value})
+	}
+	var resp statementResponse
+	if err := c.do(ctx, "POST", "/api/2.0/sql/statements/", req, &resp); err != nil {
+		return nil, err
+	}
+
+	for resp.Status.State == "PENDING" || resp.Status.State == "RUNNING" {
+		select {
+		case <-ctx.Done():
+			// Don't leave the statement running on the warehouse.
+			c.do(context.Background(), "POST", "/api/2.0/sql/statements/"+url.PathEscape(resp.StatementID)+"/cancel", nil, nil)
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		if err := c.do(ctx, "GET", "/api/2.0/sql/statements/"+url.PathEscape(resp.StatementID), nil, &resp); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Status.State != "SUCCEEDED" {
+		if e := resp.Status.Error; e != nil {
+			return nil, fmt.Errorf("Databricks statement %s: %s: %s", strings.ToLower(resp.Status.State), e.ErrorCode, e.Message)
+		}
+		return nil, fmt.Errorf("Databricks statement %s", strings.ToLower(resp.Status.State))
+	}
+	return &result{client: c, statementID: resp.StatementID, columns: resp.Manifest.Schema.Columns, chunk: resp.Result}, nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("Databricks request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &e) == nil && e.Message != "" {
+			return fmt.Errorf("Databricks returned %s: %s: %s", resp.Status, e.ErrorCode, e.Message)
+		}
+		return fmt.Errorf("Databricks returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// result walks the rows of a finished statement, fetching its chunks one
+// at a time.
+type result struct {
+	client      *client
+	statementID string
+	columns     []column
+	chunk       *chunk
+	rows        [][]*string
+	loaded      bool
+}
+
+// next returns the next row, or nil at the end of the result.
+func (r *result) next(ctx context.Context) ([]*string, error) {
+	for len(r.rows) == 0 {
+		if r.chunk == nil {
+			return nil, nil
+		}
+		if !r.loaded {
+			rows, err := r.load(ctx)
+			if err != nil {
+				return nil, err
+			}
+			r.rows, r.loaded = rows, true
+			continue
+		}
+		next := r.chunk.NextChunkIndex
+		if len(r.chunk.ExternalLinks) > 0 {
+			next = r.chunk.ExternalLinks[0].NextChunkIndex
+		}
+		r.chunk, r.loaded = nil, false
+		if next == nil {
+			return nil, nil
+		}
+		var c chunk
+		path := "/api/2.0/sql/statements/" + url.PathEscape(r.statementID) + "/result/chunks/" + strconv.Itoa(*next)
+		if err := r.client.do(ctx, "GET", path, nil, &c); err != nil {
+			return nil, err
+		}
+		r.chunk = &c
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	if len(row) != len(r.columns) {
+		return nil, fmt.Errorf("Databricks returned a row with %d columns, expected %d", len(row), len(r.columns))
+	}
+	return row, nil
+}
+
+// load returns the rows of the current chunk. External links are
+// presigned, so they are fetched without the workspace token.
+func (r *result) load(ctx context.Context) ([][]*string, error) {
+	if len(r.chunk.ExternalLinks) == 0 {
+		return r.chunk.DataArray, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.chunk.ExternalLinks[0].ExternalLink, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Databricks result chunk: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch Databricks result chunk: %s", resp.Status)
+	}
+	var rows [][]*string
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to read Databricks result chunk: %v", err)
+	}
+	return rows, nil
+}
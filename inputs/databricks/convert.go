@@ -0,0 +1,53 @@
+package databricks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// convertValue turns a value of the JSON_ARRAY format, which renders
+// everything as a string, into its JSON representation. Numbers keep
+// their literal (decimals optionally as strings), complex types are
+// parsed into nested JSON and timestamps are normalized to RFC3339 in UTC.
+func convertValue(col column, v *string, decimalsAsStrings bool) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s := *v
+	switch col.TypeName {
+	case "BOOLEAN":
+		return strconv.ParseBool(s)
+	case "BYTE", "SHORT", "INT", "LONG", "FLOAT", "DOUBLE":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value in column %s: %v", col.TypeName, col.Name, err)
+		}
+		// JSON has no NaN or infinities.
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return s, nil
+		}
+		return json.Number(s), nil
+	case "DECIMAL":
+		if decimalsAsStrings {
+			return s, nil
+		}
+		return json.Number(s), nil
+	case "ARRAY", "MAP", "STRUCT":
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var parsed interface{}
+		if err := decoder.Decode(&parsed); err != nil {
+			return nil, fmt.Errorf("invalid %s value in column %s: %v", col.TypeName, col.Name, err)
+		}
+		return parsed, nil
+	case "TIMESTAMP":
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,82 @@
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"retl/inputs/producer"
+	"retl/inputs/record"
+	"retl/inputs/types"
+	"strings"
+)
+
+// Databricks reads a table or a query from a Databricks SQL warehouse.
+type Databricks struct {
+	Conf *types.ConfigType
+}
+
+func (d *Databricks) Run() error {
+	producer, err := producer.New(d.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	client, err := d.client()
+	if err != nil {
+		return err
+	}
+	query, err := d.buildQuery()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	result, err := client.execute(ctx, query, nil)
+	if err != nil {
+		return err
+	}
+
+	w := &record.Writer{Producer: producer, PipelineID: os.Getenv("PIPELINE_NAME")}
+	decimalsAsStrings := d.Conf.Setting("decimals_as_strings") == "true"
+	for {
+		values, err := result.next(ctx)
+		if err != nil {
+			return err
+		}
+		if values == nil {
+			break
+		}
+		row := make(map[string]interface{}, len(values))
+		for i, col := range result.columns {
+			if row[col.Name], err = convertValue(col, values[i], decimalsAsStrings); err != nil {
+				return err
+			}
+		}
+		if err := w.Write(ctx, row); err != nil {
+			return err
+		}
+	}
+	return producer.Close()
+}
+
+func (d *Databricks) client() (*client, error) {
+	return newClient(d.Conf.Setting("host"), d.Conf.Secret("token"), d.Conf.Setting("warehouse_id"),
+		d.Conf.Setting("catalog"), d.Conf.Setting("schema"), d.Conf.Setting("external_links") == "true")
+}
+
+// buildQuery returns the configured query, or selects the configured
+// table, which may be qualified with its catalog and schema.
+func (d *Databricks) buildQuery() (string, error) {
+	if query := d.Conf.Setting("query"); query != "" {
+		return query, nil
+	}
+	table := d.Conf.Setting("table")
+	if table == "" {
+		return "", fmt.Errorf("databricks input needs either a table or a query")
+	}
+	var parts []string
+	for _, part := range strings.Split(table, ".") {
+		parts = append(parts, "`"+strings.ReplaceAll(part, "`", "``")+"`")
+	}
+	return "SELECT * FROM " + strings.Join(parts, "."), nil
+}
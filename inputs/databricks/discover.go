@@ -0,0 +1,124 @@
+package databricks
+
+import (
+	"context"
+	"encoding/json"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+func (d *Databricks) TestConnection(ctx context.Context) error {
+	_, err := d.list(ctx, "SELECT 'ok'", nil)
+	return err
+}
+
+// Schemas lists the schemas of the configured catalog, or of the
+// warehouse's default one.
+func (d *Databricks) Schemas(ctx context.Context) ([]string, error) {
+	return d.list(ctx, `SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name <> 'information_schema' ORDER BY schema_name`, nil)
+}
+
+func (d *Databricks) Tables(ctx context.Context, schema string) ([]string, error) {
+	return d.list(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = :schema ORDER BY table_name",
+		map[string]string{"schema": schema})
+}
+
+func (d *Databricks) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	rows, err := d.query(ctx, `SELECT column_name, full_data_type, is_nullable FROM information_schema.columns
+		WHERE table_schema = :schema AND table_name = :table ORDER BY ordinal_position`,
+		map[string]string{"schema": schema, "table": table})
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]types.Column, 0, len(rows))
+	for _, row := range rows {
+		columns = append(columns, types.Column{Name: row[0], Type: row[1], Nullable: row[2] == "YES"})
+	}
+	return columns, nil
+}
+
+func (d *Databricks) list(ctx context.Context, query string, params map[string]string) ([]string, error) {
+	rows, err := d.query(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, row[0])
+	}
+	return names, nil
+}
+
+// query runs a statement and returns its rows as text, nulls as "".
+func (d *Databricks) query(ctx context.Context, statement string, params map[string]string) ([][]string, error) {
+	client, err := d.client()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.execute(ctx, statement, params)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for {
+		values, err := result.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			return rows, nil
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			if v != nil {
+				row[i] = *v
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Preview reads the first rows of the configured query or table.
+func (d *Databricks) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	query, err := d.buildQuery()
+	if err != nil {
+		return nil, err
+	}
+	client, err := d.client()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.execute(ctx, record.LimitQuery(query, limit), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The API does not report nullability, so every column may be null.
+	preview := &types.Preview{Rows: []json.RawMessage{}}
+	for _, col := range result.columns {
+		preview.Columns = append(preview.Columns, types.Column{Name: col.Name, Type: col.TypeName, Nullable: true})
+	}
+	w := &record.Writer{}
+	decimalsAsStrings := d.Conf.Setting("decimals_as_strings") == "true"
+	for len(preview.Rows) < limit {
+		values, err := result.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			break
+		}
+		row := make(map[string]interface{}, len(values))
+		for i, col := range result.columns {
+			if row[col.Name], err = convertValue(col, values[i], decimalsAsStrings); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Sample(preview, row); err != nil {
+			return nil, err
+		}
+	}
+	return preview, nil
+}
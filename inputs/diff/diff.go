@@ -0,0 +1,210 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"retl/envelope"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+)
+
+const (
+	table = "RowSnapshots"
+
+	pageSize   = 1000
+	writeBatch = 500
+	// Keys are deleted with an IN filter in the query string, so keep
+	// batches small enough for the URL.
+	deleteBatch = 100
+)
+
+// snapshotRow is stored per source row. RowKey is a digest of the primary
+// key so it can be used in filters regardless of the key's content;
+// KeyValues keeps the key itself to describe deleted rows.
+type snapshotRow struct {
+	PipelineID string `json:"pipeline_id"`
+	RowKey     string `json:"row_key"`
+	KeyValues  string `json:"key_values"`
+	Hash       string `json:"hash"`
+}
+
+// Differ compares the rows of a run against the snapshot of hashes stored
+// by the previous successful run, so only added, changed and removed rows
+// are sent downstream.
+type Differ struct {
+	client     *supabase.Client
+	pipelineID string
+	keyColumns []string
+
+	previous map[string]string
+	changed  map[string]string
+	seen     map[string]struct{}
+}
+
+// ParseKey splits a comma separated primary key setting.
+func ParseKey(setting string) []string {
+	var columns []string
+	for _, col := range strings.Split(setting, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+func New(client *supabase.Client, pipelineID string, keyColumns []string) (*Differ, error) {
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("change detection requires a primary key")
+	}
+	d := &Differ{
+		client:     client,
+		pipelineID: pipelineID,
+		keyColumns: keyColumns,
+		previous:   make(map[string]string),
+		changed:    make(map[string]string),
+		seen:       make(map[string]struct{}),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Differ) load() error {
+	for from := 0; ; from += pageSize {
+		var page []snapshotRow
+		_, err := d.client.From(table).Select("row_key,key_values,hash", "", false).
+			Eq("pipeline_id", d.pipelineID).
+			Order("row_key", &postgrest.OrderOpts{Ascending: true}).
+			Range(from, from+pageSize-1, "").
+			ExecuteTo(&page)
+		if err != nil {
+			return fmt.Errorf("failed to load row snapshot: %v", err)
+		}
+		for _, row := range page {
+			d.previous[row.KeyValues] = row.Hash
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+	}
+}
+
+// Compare returns the row's key and whether it is new or changed since the
+// previous run.
+func (d *Differ) Compare(row map[string]interface{}) (string, bool, error) {
+	keyValues := make([]interface{}, len(d.keyColumns))
+	for i, col := range d.keyColumns {
+		v, ok := row[col]
+		if !ok {
+			return "", false, fmt.Errorf("primary key column %q is missing from the row", col)
+		}
+		keyValues[i] = v
+	}
+	key, err := json.Marshal(keyValues)
+	if err != nil {
+		return "", false, err
+	}
+	// Maps are marshalled with sorted keys, so equal rows hash equally.
+	body, err := json.Marshal(row)
+	if err != nil {
+		return "", false, err
+	}
+	hash := digest(body)
+
+	k := string(key)
+	if _, dup := d.seen[k]; dup {
+		return "", false, fmt.Errorf("duplicate primary key %s", k)
+	}
+	d.seen[k] = struct{}{}
+	if d.previous[k] == hash {
+		return k, false, nil
+	}
+	d.changed[k] = hash
+	return k, true, nil
+}
+
+// DeleteEvents builds a delete event for every row of the previous snapshot
+// that was not seen in this run. The event's value holds the row's primary
+// key columns. It must be called after every row has been compared.
+func (d *Differ) DeleteEvents(pipelineID string) ([]kafka.Message, error) {
+	var events []kafka.Message
+	for k := range d.previous {
+		if _, ok := d.seen[k]; ok {
+			continue
+		}
+		var keyValues []interface{}
+		if err := json.Unmarshal([]byte(k), &keyValues); err != nil {
+			return nil, fmt.Errorf("invalid snapshot key %s: %v", k, err)
+		}
+		record := make(map[string]interface{}, len(d.keyColumns))
+		for i, col := range d.keyColumns {
+			if i < len(keyValues) {
+				record[col] = keyValues[i]
+			}
+		}
+		value, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, envelope.New(pipelineID, envelope.OpDelete, k, value))
+	}
+	return events, nil
+}
+
+// Commit replaces the stored snapshot with this run's rows. It must only be
+// called once every change has been delivered, otherwise a failed run
+// would hide those changes from the next one.
+func (d *Differ) Commit() error {
+	rows := make([]snapshotRow, 0, writeBatch)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		_, _, err := d.client.From(table).Upsert(rows, "pipeline_id,row_key", "minimal", "").Execute()
+		rows = rows[:0]
+		if err != nil {
+			return fmt.Errorf("failed to save row snapshot: %v", err)
+		}
+		return nil
+	}
+	for k, hash := range d.changed {
+		rows = append(rows, snapshotRow{PipelineID: d.pipelineID, RowKey: digest([]byte(k)), KeyValues: k, Hash: hash})
+		if len(rows) == writeBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	var removed []string
+	for k := range d.previous {
+		if _, ok := d.seen[k]; !ok {
+			removed = append(removed, digest([]byte(k)))
+		}
+	}
+	for start := 0; start < len(removed); start += deleteBatch {
+		end := min(start+deleteBatch, len(removed))
+		_, _, err := d.client.From(table).Delete("minimal", "").
+			Eq("pipeline_id", d.pipelineID).
+			In("row_key", removed[start:end]).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to prune row snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"retl/envelope"
+)
+
+func differ(key []string, previous map[string]string) *Differ {
+	return &Differ{
+		pipelineID: "p",
+		keyColumns: key,
+		previous:   previous,
+		changed:    make(map[string]string),
+		seen:       make(map[string]struct{}),
+	}
+}
+
+func hashOf(t *testing.T, row map[string]interface{}) string {
+	body, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest(body)
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "id", want: []string{"id"}},
+		{in: " a , b ,", want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := ParseKey(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	unchanged := map[string]interface{}{"id": 1.0, "name": "a"}
+	tests := []struct {
+		name    string
+		key     []string
+		row     map[string]interface{}
+		wantKey string
+		changed bool
+		err     string
+	}{
+		{name: "unchanged row", key: []string{"id"}, row: unchanged, wantKey: "[1]"},
+		{name: "changed row", key: []string{"id"}, row: map[string]interface{}{"id": 1.0, "name": "b"}, wantKey: "[1]", changed: true},
+		{name: "new row", key: []string{"id"}, row: map[string]interface{}{"id": 2.0}, wantKey: "[2]", changed: true},
+		{name: "composite key", key: []string{"id", "name"}, row: unchanged, wantKey: `[1,"a"]`, changed: true},
+		{name: "missing key column", key: []string{"ID"}, row: unchanged, err: `primary key column "ID" is missing`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := differ(tt.key, map[string]string{"[1]": hashOf(t, unchanged)})
+			key, changed, err := d.Compare(tt.row)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != tt.wantKey || changed != tt.changed {
+				t.Errorf("got %s %v, want %s %v", key, changed, tt.wantKey, tt.changed)
+			}
+			if _, ok := d.changed[key]; ok != tt.changed {
+				t.Errorf("changed rows = %v", d.changed)
+			}
+		})
+	}
+}
+
+func TestCompareRejectsDuplicateKeys(t *testing.T) {
+	d := differ([]string{"id"}, map[string]string{})
+	if _, _, err := d.Compare(map[string]interface{}{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Compare(map[string]interface{}{"id": 1.0, "v": 2.0}); err == nil {
+		t.Error("a second row with the same key was accepted")
+	}
+}
+
+func TestDeleteEvents(t *testing.T) {
+	d := differ([]string{"id", "region"}, map[string]string{
+		`[1,"eu"]`: "h1",
+		`[2,"us"]`: "h2",
+		`[3,"eu"]`: "h3",
+	})
+	if _, _, err := d.Compare(map[string]interface{}{"id": 2.0, "region": "us"}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := d.DeleteEvents("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range events {
+		if op := envelope.Op(msg); op != envelope.OpDelete {
+			t.Errorf("event has op %s", op)
+		}
+		got = append(got, envelope.Header(msg, envelope.KeyHeader)+" "+string(msg.Value))
+	}
+	sort.Strings(got)
+	want := []string{
+		`[1,"eu"] {"id":1,"region":"eu"}`,
+		`[3,"eu"] {"id":3,"region":"eu"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"retl/inputs/state"
+	"retl/inputs/types"
+
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+)
+
+const table = "SchemaDrift"
+
+// SchemaKey holds the columns a pipeline was configured against.
+const SchemaKey = "schema"
+
+// Policies decide what a run does when the source no longer has the
+// baseline's columns.
+const (
+	// Fail stops the run before anything is written.
+	Fail = "fail"
+	// Ignore leaves added columns out of the records. Removed or retyped
+	// columns cannot be ignored and fail the run.
+	Ignore = "ignore"
+	// Propagate writes the records as they are and makes the current
+	// columns the new baseline.
+	Propagate = "propagate"
+	// Notify writes the records as they are and calls the webhook, on
+	// every run until the new columns are accepted by resetting the
+	// baseline.
+	Notify = "notify"
+)
+
+// Change is a column whose type changed.
+type Change struct {
+	Column string `json:"column"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// Drift is how the current columns differ from the baseline.
+type Drift struct {
+	Added   []types.Column `json:"added"`
+	Removed []types.Column `json:"removed"`
+	Changed []Change       `json:"changed"`
+}
+
+// Compare lists the columns added to, removed from or retyped in current
+// relative to baseline.
+func Compare(baseline, current []types.Column) Drift {
+	d := Drift{Added: []types.Column{}, Removed: []types.Column{}, Changed: []Change{}}
+	before := make(map[string]types.Column, len(baseline))
+	for _, col := range baseline {
+		before[col.Name] = col
+	}
+	after := make(map[string]bool, len(current))
+	for _, col := range current {
+		after[col.Name] = true
+		old, ok := before[col.Name]
+		if !ok {
+			d.Added = append(d.Added, col)
+		} else if old.Type != col.Type {
+			d.Changed = append(d.Changed, Change{Column: col.Name, From: old.Type, To: col.Type})
+		}
+	}
+	for _, col := range baseline {
+		if !after[col.Name] {
+			d.Removed = append(d.Removed, col)
+		}
+	}
+	return d
+}
+
+func (d Drift) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Record is drift found at the start of a run and what the policy did
+// about it: failed, ignored, propagated or notified.
+type Record struct {
+	ID         string `json:"id,omitempty"`
+	PipelineID string `json:"pipeline_id"`
+	RunID      string `json:"run_id"`
+	Policy     string `json:"policy"`
+	Action     string `json:"action"`
+	Drift
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Checker applies a pipeline's drift policy at the start of a run.
+type Checker struct {
+	client     *supabase.Client
+	store      *state.Store
+	PipelineID string
+	RunID      string
+	Policy     string
+	// Webhook receives the record as JSON under the notify policy.
+	Webhook string
+}
+
+func New(client *supabase.Client, pipelineID, runID, policy string) (*Checker, error) {
+	if err := CheckPolicy(policy); err != nil {
+		return nil, err
+	}
+	return &Checker{client: client, store: state.New(client), PipelineID: pipelineID, RunID: runID, Policy: policy}, nil
+}
+
+// CheckPolicy returns an error for anything but a known policy.
+func CheckPolicy(policy string) error {
+	switch policy {
+	case Fail, Ignore, Propagate, Notify:
+		return nil
+	}
+	return fmt.Errorf("invalid schema drift policy %q, expected fail, ignore, propagate or notify", policy)
+}
+
+// Check compares current with the pipeline's baseline, which the first
+// checked run records, applies the policy and records any drift on the
+// run. It returns the columns to leave out of this run's records.
+func (c *Checker) Check(ctx context.Context, current []types.Column) ([]string, error) {
+	value, ok, err := c.store.Get(c.PipelineID, SchemaKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, c.save(current)
+	}
+	var baseline []types.Column
+	if err := json.Unmarshal([]byte(value), &baseline); err != nil {
+		return nil, fmt.Errorf("invalid schema baseline of pipeline %s: %v", c.PipelineID, err)
+	}
+	d := Compare(baseline, current)
+	if d.Empty() {
+		return nil, nil
+	}
+
+	rec := Record{PipelineID: c.PipelineID, RunID: c.RunID, Policy: c.Policy, Drift: d, DetectedAt: time.Now().UTC()}
+	var dropped []string
+	switch {
+	case c.Policy == Fail, c.Policy == Ignore && (len(d.Removed) > 0 || len(d.Changed) > 0):
+		rec.Action = "failed"
+	case c.Policy == Ignore:
+		rec.Action = "ignored"
+		for _, col := range d.Added {
+			dropped = append(dropped, col.Name)
+		}
+	case c.Policy == Propagate:
+		rec.Action = "propagated"
+		if err := c.save(current); err != nil {
+			return nil, err
+		}
+	case c.Policy == Notify:
+		rec.Action = "notified"
+	}
+	if _, _, err := c.client.From(table).Insert(rec, false, "", "minimal", "").Execute(); err != nil {
+		return nil, fmt.Errorf("failed to record schema drift: %v", err)
+	}
+	if rec.Action == "notified" {
+		c.notify(ctx, rec)
+	}
+	if rec.Action == "failed" {
+		return nil, fmt.Errorf("source schema drifted: %d columns added, %d removed and %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+	}
+	return dropped, nil
+}
+
+func (c *Checker) save(columns []types.Column) error {
+	value, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(c.PipelineID, SchemaKey, string(value))
+}
+
+// notify posts rec to the webhook. A failed notification is logged rather
+// than failing a run the policy lets through.
+func (c *Checker) notify(ctx context.Context, rec Record) {
+	if c.Webhook == "" {
+		log.Printf("source schema of pipeline %s drifted and no webhook is configured", c.PipelineID)
+		return
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("failed to encode schema drift notification: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("failed to notify about schema drift: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("failed to notify about schema drift: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("schema drift webhook answered %s", resp.Status)
+	}
+}
+
+// List returns the drift recorded on a pipeline's runs, newest first.
+func List(client *supabase.Client, pipelineID string) ([]Record, error) {
+	var records []Record
+	_, err := client.From(table).Select("*", "", false).Eq("pipeline_id", pipelineID).
+		Order("detected_at", &postgrest.OrderOpts{Ascending: false}).ExecuteTo(&records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema drift: %v", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,86 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"retl/inputs/types"
+)
+
+func TestCompare(t *testing.T) {
+	id := types.Column{Name: "id", Type: "integer"}
+	name := types.Column{Name: "name", Type: "string"}
+	tests := []struct {
+		name     string
+		baseline []types.Column
+		current  []types.Column
+		want     Drift
+	}{
+		{
+			name:     "same columns in another order",
+			baseline: []types.Column{id, name},
+			current:  []types.Column{name, id},
+			want:     Drift{Added: []types.Column{}, Removed: []types.Column{}, Changed: []Change{}},
+		},
+		{
+			name:     "added column",
+			baseline: []types.Column{id},
+			current:  []types.Column{id, name},
+			want:     Drift{Added: []types.Column{name}, Removed: []types.Column{}, Changed: []Change{}},
+		},
+		{
+			name:     "removed column",
+			baseline: []types.Column{id, name},
+			current:  []types.Column{id},
+			want:     Drift{Added: []types.Column{}, Removed: []types.Column{name}, Changed: []Change{}},
+		},
+		{
+			name:     "retyped column",
+			baseline: []types.Column{id, name},
+			current:  []types.Column{{Name: "id", Type: "string"}, name},
+			want: Drift{Added: []types.Column{}, Removed: []types.Column{}, Changed: []Change{
+				{Column: "id", From: "integer", To: "string"},
+			}},
+		},
+		{
+			name:     "renamed column is a removal and an addition",
+			baseline: []types.Column{id, name},
+			current:  []types.Column{id, {Name: "full_name", Type: "string"}},
+			want: Drift{
+				Added:   []types.Column{{Name: "full_name", Type: "string"}},
+				Removed: []types.Column{name},
+				Changed: []Change{},
+			},
+		},
+		{
+			name:    "empty baseline",
+			current: []types.Column{id},
+			want:    Drift{Added: []types.Column{id}, Removed: []types.Column{}, Changed: []Change{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(tt.baseline, tt.current)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			wantEmpty := len(tt.want.Added)+len(tt.want.Removed)+len(tt.want.Changed) == 0
+			if got.Empty() != wantEmpty {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), wantEmpty)
+			}
+		})
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	for _, policy := range []string{Fail, Ignore, Propagate, Notify} {
+		if err := CheckPolicy(policy); err != nil {
+			t.Errorf("CheckPolicy(%q) = %v", policy, err)
+		}
+	}
+	for _, policy := range []string{"", "FAIL", "warn"} {
+		if err := CheckPolicy(policy); err == nil {
+			t.Errorf("CheckPolicy(%q) accepted an unknown policy", policy)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package duckdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"retl/inputs/record"
+)
+
+// convertValue turns a scanned value into its JSON representation, with
+// the same conventions as the warehouse inputs: exact decimals (or
+// strings when decimalsAsStrings is set), RFC3339 timestamps, dates and
+// times as text, JSON parsed into nested values and binary as base64.
+// Values of the driver's own types go through convertDriverValue.
+func convertValue(dbType string, v interface{}, decimalsAsStrings bool) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if converted, ok, err := convertDriverValue(v, decimalsAsStrings); ok || err != nil {
+		return converted, err
+	}
+	switch n := v.(type) {
+	case time.Time:
+		switch dbType {
+		case "DATE":
+			return n.Format(time.DateOnly), nil
+		case "TIME":
+			return n.Format("15:04:05.999999"), nil
+		}
+		return n.UTC().Format(time.RFC3339Nano), nil
+	case *big.Int:
+		return record.Decimal(n, 0, decimalsAsStrings), nil
+	case float32:
+		return record.Float(float64(n)), nil
+	case float64:
+		return record.Float(n), nil
+	case []byte:
+		if dbType == "UUID" && len(n) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", n[0:4], n[4:6], n[6:8], n[8:10], n[10:16]), nil
+		}
+		return base64.StdEncoding.EncodeToString(n), nil
+	case string:
+		if dbType == "JSON" {
+			decoder := json.NewDecoder(strings.NewReader(n))
+			decoder.UseNumber()
+			var parsed interface{}
+			if err := decoder.Decode(&parsed); err != nil {
+				return nil, fmt.Errorf("invalid JSON value: %v", err)
+			}
+			return parsed, nil
+		}
+	case []interface{}:
+		for i := range n {
+			var err error
+			if n[i], err = convertValue("", n[i], decimalsAsStrings); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key, value := range n {
+			var err error
+			if n[key], err = convertValue("", value, decimalsAsStrings); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,11 @@
+//go:build !duckdb
+
+package duckdb
+
+// Available reports whether the build includes the DuckDB driver, which
+// needs cgo and the duckdb build tag.
+const Available = false
+
+func convertDriverValue(v interface{}, decimalsAsStrings bool) (interface{}, bool, error) {
+	return nil, false, nil
+}
@@ -0,0 +1,34 @@
+//go:build duckdb
+
+package duckdb
+
+import (
+	"fmt"
+	"retl/inputs/record"
+
+	goduckdb "github.com/marcboeker/go-duckdb"
+)
+
+const Available = true
+
+// convertDriverValue converts the values the driver returns in its own
+// types: decimals, intervals and maps, whose keys JSON needs as strings.
+func convertDriverValue(v interface{}, decimalsAsStrings bool) (interface{}, bool, error) {
+	switch n := v.(type) {
+	case goduckdb.Decimal:
+		return record.Decimal(n.Value, int(n.Scale), decimalsAsStrings), true, nil
+	case goduckdb.Interval:
+		return map[string]interface{}{"months": n.Months, "days": n.Days, "micros": n.Micros}, true, nil
+	case goduckdb.Map:
+		m := make(map[string]interface{}, len(n))
+		for key, value := range n {
+			converted, err := convertValue("", value, decimalsAsStrings)
+			if err != nil {
+				return nil, true, err
+			}
+			m[fmt.Sprint(key)] = converted
+		}
+		return m, true, nil
+	}
+	return nil, false, nil
+}
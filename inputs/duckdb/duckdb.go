@@ -0,0 +1,202 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"retl/inputs/producer"
+	"retl/inputs/record"
+	"retl/inputs/types"
+	"strings"
+)
+
+// DuckDB runs a model query in an embedded, in-memory DuckDB, over files on
+// disk or in S3 that the input attaches first.
+//
+// The DuckDB driver uses cgo and is only compiled in with the duckdb build
+// tag; other builds do not register the input.
+type DuckDB struct {
+	Conf *types.ConfigType
+}
+
+func (d *DuckDB) Run() error {
+	producer, err := producer.New(d.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	query, err := d.query()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	db, err := d.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to run DuckDB query: %v", err)
+	}
+	defer rows.Close()
+	columns, convert, err := d.converter(rows)
+	if err != nil {
+		return err
+	}
+
+	w := &record.Writer{Producer: producer, PipelineID: os.Getenv("PIPELINE_NAME")}
+	if err := w.Copy(ctx, rows, columns, convert); err != nil {
+		return err
+	}
+	return producer.Close()
+}
+
+// Preview reads the first rows of the query.
+func (d *DuckDB) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	query, err := d.query()
+	if err != nil {
+		return nil, err
+	}
+	db, err := d.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, record.LimitQuery(query, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run DuckDB query: %v", err)
+	}
+	defer rows.Close()
+	columns, convert, err := d.converter(rows)
+	if err != nil {
+		return nil, err
+	}
+	return (&record.Writer{}).Preview(rows, columns, convert, limit)
+}
+
+// query returns the configured query. DuckDB queries can read any file
+// the pod can, so they are treated as free-form SQL.
+func (d *DuckDB) query() (string, error) {
+	query := d.Conf.Setting("query")
+	if query == "" {
+		return "", fmt.Errorf("duckdb input needs a query")
+	}
+	if d.Conf.Setting("allow_sql") != "true" {
+		return "", fmt.Errorf("free-form SQL is only allowed when SQL mode is enabled by an admin")
+	}
+	return query, nil
+}
+
+// converter returns the column names of rows and the conversion of their
+// values for record.Scan.
+func (d *DuckDB) converter(rows *sql.Rows) ([]string, record.Convert, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(columnTypes))
+	for i, t := range columnTypes {
+		columns[i] = t.Name()
+	}
+	decimalsAsStrings := d.Conf.Setting("decimals_as_strings") == "true"
+	return columns, func(i int, v interface{}) (interface{}, error) {
+		return convertValue(columnTypes[i].DatabaseTypeName(), v, decimalsAsStrings)
+	}, nil
+}
+
+// open starts an in-memory database on a single connection, so the
+// secrets and views created here are visible to the query, sets up S3
+// access and attaches the configured files. The configuration is then
+// locked so the query cannot change it.
+func (d *DuckDB) open(ctx context.Context) (*sql.DB, error) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	statements, err := d.setup()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, statement := range append(statements, "SET lock_configuration = true") {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set up DuckDB: %v", err)
+		}
+	}
+	return db, nil
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// setup returns the statements that prepare the database. Attachments are
+// a comma separated list of name=path entries: DuckDB database files are
+// attached read-only, any other path, which may be a glob, becomes a view
+// over the files DuckDB reads for it.
+func (d *DuckDB) setup() ([]string, error) {
+	var statements []string
+	attach := d.Conf.Setting("attach")
+	if strings.Contains(attach, "s3://") || d.Conf.Setting("s3_endpoint") != "" {
+		secret, err := d.s3Secret()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, "INSTALL httpfs", "LOAD httpfs", secret)
+	}
+
+	for _, entry := range strings.Split(attach, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, location, ok := strings.Cut(entry, "=")
+		name, location = strings.TrimSpace(name), strings.TrimSpace(location)
+		if !ok || !namePattern.MatchString(name) || location == "" {
+			return nil, fmt.Errorf("invalid attachment %q, expected name=path", entry)
+		}
+		switch path.Ext(location) {
+		case ".duckdb", ".db":
+			statements = append(statements, fmt.Sprintf("ATTACH %s AS %s (READ_ONLY)", quoteLiteral(location), name))
+		default:
+			statements = append(statements, fmt.Sprintf("CREATE VIEW %s AS SELECT * FROM %s", name, quoteLiteral(location)))
+		}
+	}
+	return statements, nil
+}
+
+// s3Secret returns the statement that gives DuckDB access to S3, or to the
+// S3 compatible store at the configured endpoint.
+func (d *DuckDB) s3Secret() (string, error) {
+	options := []string{"TYPE S3"}
+	if id := d.Conf.Secret("aws_access_key_id"); id != "" {
+		options = append(options,
+			"KEY_ID "+quoteLiteral(id),
+			"SECRET "+quoteLiteral(d.Conf.Secret("aws_secret_access_key")))
+	}
+	if region := d.Conf.Setting("aws_region"); region != "" {
+		options = append(options, "REGION "+quoteLiteral(region))
+	}
+	if endpoint := d.Conf.Setting("s3_endpoint"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		options = append(options,
+			"ENDPOINT "+quoteLiteral(u.Host),
+			"URL_STYLE 'path'",
+			fmt.Sprintf("USE_SSL %t", u.Scheme == "https"))
+	}
+	return "CREATE SECRET (" + strings.Join(options, ", ") + ")", nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
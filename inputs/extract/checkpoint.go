@@ -0,0 +1,59 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"retl/inputs/state"
+)
+
+// ProgressKey holds the position of an extraction that is still running.
+const ProgressKey = "progress"
+
+// Checkpoints stores extraction progress in the pipeline state. Progress
+// is tagged with the run id, so only a restarted pod of the same run picks
+// it up and a new run always starts from the beginning.
+type Checkpoints struct {
+	store      *state.Store
+	pipelineID string
+	runID      string
+}
+
+type checkpoint struct {
+	RunID  string           `json:"run_id"`
+	Ranges []*rangeProgress `json:"ranges"`
+}
+
+func NewCheckpoints(store *state.Store, pipelineID, runID string) *Checkpoints {
+	return &Checkpoints{store: store, pipelineID: pipelineID, runID: runID}
+}
+
+func (c *Checkpoints) load() ([]*rangeProgress, bool, error) {
+	value, ok, err := c.store.Get(c.pipelineID, ProgressKey)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var saved checkpoint
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.UseNumber()
+	if err := dec.Decode(&saved); err != nil {
+		return nil, false, fmt.Errorf("invalid extraction checkpoint: %v", err)
+	}
+	if saved.RunID != c.runID || len(saved.Ranges) == 0 {
+		return nil, false, nil
+	}
+	return saved.Ranges, true, nil
+}
+
+func (c *Checkpoints) save(ranges []*rangeProgress) error {
+	value, err := json.Marshal(checkpoint{RunID: c.runID, Ranges: ranges})
+	if err != nil {
+		return err
+	}
+	return c.store.Set(c.pipelineID, ProgressKey, string(value))
+}
+
+func (c *Checkpoints) clear() error {
+	return c.store.Delete(c.pipelineID, ProgressKey)
+}
@@ -0,0 +1,215 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"retl/inputs/producer"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/sync/errgroup"
+)
+
+type Row = map[string]interface{}
+
+// Range restricts a reader to rows whose leading key column lies in
+// [Lower, Upper). A nil bound leaves that side open.
+type Range struct {
+	Lower *int64 `json:"lower,omitempty"`
+	Upper *int64 `json:"upper,omitempty"`
+}
+
+// Reader reads a table one page at a time in key order.
+type Reader interface {
+	// ReadPage returns up to limit rows of r whose key sorts after after,
+	// or from the start of r when after is nil.
+	ReadPage(ctx context.Context, r Range, after []interface{}, limit int) ([]Row, error)
+	// Bounds returns the smallest and largest value of the leading key
+	// column, which must be an integer for the table to be split. ok is
+	// false for an empty table.
+	Bounds(ctx context.Context) (min, max int64, ok bool, err error)
+}
+
+// Extractor streams a table to Kafka in pages of ChunkSize rows using
+// keyset pagination, so memory use is bounded by the chunk size and the
+// producer's in-flight window no matter how large the table is. With
+// Parallelism above one the leading key column is split into that many
+// ranges which are read concurrently.
+type Extractor struct {
+	Reader      Reader
+	Key         []string
+	ChunkSize   int
+	Parallelism int
+	Producer    *producer.Producer
+	// Messages turns a page of rows into the messages to write. Calls are
+	// serialized, so it may keep state such as a change detector.
+	Messages func(rows []Row) ([]kafka.Message, error)
+	// Checkpoints, when set, records the position of every range after
+	// each delivered page so a restarted pod resumes where it stopped.
+	Checkpoints *Checkpoints
+
+	mu       sync.Mutex
+	progress []*rangeProgress
+}
+
+type rangeProgress struct {
+	Range Range         `json:"range"`
+	After []interface{} `json:"after,omitempty"`
+	Done  bool          `json:"done"`
+}
+
+func (e *Extractor) Run(ctx context.Context) error {
+	if len(e.Key) == 0 {
+		return fmt.Errorf("paginated extraction needs a primary key")
+	}
+	if e.ChunkSize <= 0 {
+		return fmt.Errorf("chunk size must be positive")
+	}
+
+	if e.Checkpoints != nil {
+		saved, ok, err := e.Checkpoints.load()
+		if err != nil {
+			return err
+		}
+		if ok {
+			log.Printf("resuming extraction from checkpoint of run %s", e.Checkpoints.runID)
+			e.progress = saved
+		}
+	}
+	if e.progress == nil {
+		ranges, err := e.split(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			e.progress = append(e.progress, &rangeProgress{Range: r})
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, p := range e.progress {
+		p := p
+		g.Go(func() error { return e.extract(ctx, p) })
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if e.Checkpoints != nil {
+		return e.Checkpoints.clear()
+	}
+	return nil
+}
+
+// Last returns the key of the last row extracted from the first range,
+// including rows extracted before a resume.
+func (e *Extractor) Last() []interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.progress) == 0 {
+		return nil
+	}
+	return e.progress[0].After
+}
+
+func (e *Extractor) split(ctx context.Context) ([]Range, error) {
+	if e.Parallelism <= 1 {
+		return []Range{{}}, nil
+	}
+	min, max, ok, err := e.Reader.Bounds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("parallel extraction needs an integer leading key column: %v", err)
+	}
+	if !ok {
+		return []Range{{}}, nil
+	}
+	width := (max - min + 1) / int64(e.Parallelism)
+	if width < 1 {
+		width = 1
+	}
+	var ranges []Range
+	for lower := min; lower <= max; lower += width {
+		lo, hi := lower, lower+width
+		r := Range{Lower: &lo, Upper: &hi}
+		if len(ranges) == 0 {
+			r.Lower = nil
+		}
+		if hi > max || len(ranges) == e.Parallelism-1 {
+			r.Upper = nil
+			ranges = append(ranges, r)
+			break
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func (e *Extractor) extract(ctx context.Context, p *rangeProgress) error {
+	for !p.Done {
+		rows, err := e.Reader.ReadPage(ctx, p.Range, p.After, e.ChunkSize)
+		if err != nil {
+			return err
+		}
+		var after []interface{}
+		if len(rows) > 0 {
+			if after, err = keyOf(rows[len(rows)-1], e.Key); err != nil {
+				return err
+			}
+			if err := e.deliver(ctx, rows); err != nil {
+				return err
+			}
+		}
+
+		e.mu.Lock()
+		if after != nil {
+			p.After = after
+		}
+		p.Done = len(rows) < e.ChunkSize
+		e.mu.Unlock()
+		if err := e.checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver writes a page and waits for it to be acknowledged, so the
+// checkpoint that follows never covers rows Kafka has not stored.
+func (e *Extractor) deliver(ctx context.Context, rows []Row) error {
+	e.mu.Lock()
+	msgs, err := e.Messages(rows)
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	batch, err := e.Producer.WriteBatch(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+	return batch.Wait(ctx)
+}
+
+func (e *Extractor) checkpoint() error {
+	if e.Checkpoints == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.Checkpoints.save(e.progress)
+}
+
+// keyOf returns the key of a row. A key column missing from the row would
+// restart the next page from the beginning of the range, so it is an
+// error rather than a nil value.
+func keyOf(row Row, key []string) ([]interface{}, error) {
+	values := make([]interface{}, len(key))
+	for i, col := range key {
+		v, ok := row[col]
+		if !ok {
+			return nil, fmt.Errorf("primary key column %q is missing from the row", col)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,160 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyOf(t *testing.T) {
+	tests := []struct {
+		name string
+		row  Row
+		key  []string
+		want []interface{}
+		err  string
+	}{
+		{
+			name: "single column",
+			row:  Row{"id": int64(3), "name": "a"},
+			key:  []string{"id"},
+			want: []interface{}{int64(3)},
+		},
+		{
+			name: "composite key in key order",
+			row:  Row{"a": "x", "b": int64(2)},
+			key:  []string{"b", "a"},
+			want: []interface{}{int64(2), "x"},
+		},
+		{
+			name: "null key value",
+			row:  Row{"id": nil},
+			key:  []string{"id"},
+			want: []interface{}{nil},
+		},
+		{
+			name: "column named in another case",
+			row:  Row{"ID": int64(3)},
+			key:  []string{"id"},
+			err:  `primary key column "id" is missing`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyOf(tt.row, tt.key)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type boundsReader struct {
+	min, max int64
+	ok       bool
+	pages    [][]Row
+}
+
+func (r *boundsReader) ReadPage(ctx context.Context, rng Range, after []interface{}, limit int) ([]Row, error) {
+	if len(r.pages) == 0 {
+		return nil, nil
+	}
+	page := r.pages[0]
+	r.pages = r.pages[1:]
+	return page, nil
+}
+
+func (r *boundsReader) Bounds(ctx context.Context) (int64, int64, bool, error) {
+	return r.min, r.max, r.ok, nil
+}
+
+func TestSplit(t *testing.T) {
+	bound := func(v int64) *int64 { return &v }
+	tests := []struct {
+		name        string
+		parallelism int
+		reader      *boundsReader
+		want        []Range
+	}{
+		{
+			name:        "sequential",
+			parallelism: 1,
+			reader:      &boundsReader{min: 1, max: 100, ok: true},
+			want:        []Range{{}},
+		},
+		{
+			name:        "empty table",
+			parallelism: 4,
+			reader:      &boundsReader{},
+			want:        []Range{{}},
+		},
+		{
+			name:        "even split",
+			parallelism: 2,
+			reader:      &boundsReader{min: 1, max: 10, ok: true},
+			want:        []Range{{Upper: bound(6)}, {Lower: bound(6)}},
+		},
+		{
+			name:        "remainder goes to the last range",
+			parallelism: 3,
+			reader:      &boundsReader{min: 0, max: 9, ok: true},
+			want:        []Range{{Upper: bound(3)}, {Lower: bound(3), Upper: bound(6)}, {Lower: bound(6)}},
+		},
+		{
+			name:        "more ranges than keys",
+			parallelism: 8,
+			reader:      &boundsReader{min: 5, max: 6, ok: true},
+			want:        []Range{{Upper: bound(6)}, {Lower: bound(6)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Extractor{Reader: tt.reader, Parallelism: tt.parallelism}
+			got, err := e.split(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", ranges(got), ranges(tt.want))
+			}
+		})
+	}
+}
+
+func ranges(rs []Range) string {
+	var parts []string
+	for _, r := range rs {
+		lower, upper := "-inf", "+inf"
+		if r.Lower != nil {
+			lower = fmt.Sprint(*r.Lower)
+		}
+		if r.Upper != nil {
+			upper = fmt.Sprint(*r.Upper)
+		}
+		parts = append(parts, "["+lower+", "+upper+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestExtractRejectsRowsWithoutKey(t *testing.T) {
+	e := &Extractor{
+		Reader:    &boundsReader{pages: [][]Row{{{"ID": int64(1)}}}},
+		Key:       []string{"id"},
+		ChunkSize: 1,
+	}
+	err := e.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `primary key column "id" is missing`) {
+		t.Fatalf("got %v, want a missing key column error", err)
+	}
+}
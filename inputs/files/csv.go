@@ -0,0 +1,81 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvReader reads delimited records. Unlike encoding/csv it takes any
+// quote character, or none at all. Quoted fields may contain delimiters,
+// line breaks and doubled quotes; blank lines are skipped.
+type csvReader struct {
+	r         *bufio.Reader
+	delimiter rune
+	quote     rune // 0 disables quoting
+	line      int
+}
+
+func newCSVReader(r io.Reader, delimiter, quote rune) *csvReader {
+	return &csvReader{r: bufio.NewReader(r), delimiter: delimiter, quote: quote, line: 1}
+}
+
+// read returns the next record, or io.EOF after the last one.
+func (c *csvReader) read() ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted, sawQuote := false, false
+	start := c.line
+	for {
+		ch, _, err := c.r.ReadRune()
+		if err == io.EOF {
+			if quoted {
+				return nil, fmt.Errorf("line %d: unterminated quoted field", start)
+			}
+			if len(fields) == 0 && field.Len() == 0 && !sawQuote {
+				return nil, io.EOF
+			}
+			return append(fields, strings.TrimSuffix(field.String(), "\r")), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quoted:
+			if ch == c.quote {
+				next, _, err := c.r.ReadRune()
+				if err == nil && next == c.quote {
+					field.WriteRune(ch)
+					continue
+				}
+				if err == nil {
+					c.r.UnreadRune()
+				}
+				quoted = false
+				continue
+			}
+			if ch == '\n' {
+				c.line++
+			}
+			field.WriteRune(ch)
+		case c.quote != 0 && ch == c.quote && field.Len() == 0:
+			quoted, sawQuote = true, true
+		case ch == c.delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+		case ch == '\n':
+			c.line++
+			record := strings.TrimSuffix(field.String(), "\r")
+			if len(fields) == 0 && record == "" && !sawQuote {
+				field.Reset()
+				start = c.line
+				continue
+			}
+			return append(fields, record), nil
+		default:
+			field.WriteRune(ch)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+// describeRows is how many JSON Lines records are sampled to describe a
+// file, which has no header to read its columns from.
+const describeRows = 100
+
+// errEnough stops reading a file once enough of it was read.
+var errEnough = errors.New("read enough")
+
+// TestConnection lists the files matching the path, which for S3 checks
+// the bucket can be read with the credentials.
+func (f *Files) TestConnection(ctx context.Context) error {
+	src, err := f.source()
+	if err != nil {
+		return err
+	}
+	_, err = src.list(ctx)
+	return err
+}
+
+// Schemas has a single schema, the configured path, whose tables are the
+// files it matches.
+func (f *Files) Schemas(ctx context.Context) ([]string, error) {
+	if _, err := f.source(); err != nil {
+		return nil, err
+	}
+	return []string{f.Conf.Setting("path")}, nil
+}
+
+func (f *Files) Tables(ctx context.Context, schema string) ([]string, error) {
+	_, objects, err := f.list(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objects))
+	for i, o := range objects {
+		names[i] = o.name
+	}
+	return names, nil
+}
+
+func (f *Files) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	src, objects, err := f.list(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objects {
+		if o.name == table {
+			return f.describe(ctx, src, o)
+		}
+	}
+	return nil, fmt.Errorf("no file %s matches %s", table, schema)
+}
+
+func (f *Files) list(ctx context.Context, schema string) (source, []object, error) {
+	if path := f.Conf.Setting("path"); schema != path {
+		return nil, nil, fmt.Errorf("unknown schema %q, the files input only has its path %q", schema, path)
+	}
+	src, err := f.source()
+	if err != nil {
+		return nil, nil, err
+	}
+	objects, err := src.list(ctx)
+	return src, objects, err
+}
+
+// Preview reads the first rows of the matching files, in the order a run
+// reads them, and describes the columns of the first file.
+func (f *Files) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	src, objects, err := f.list(ctx, f.Conf.Setting("path"))
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no files match %s", f.Conf.Setting("path"))
+	}
+	preview := &types.Preview{Rows: []json.RawMessage{}}
+	if preview.Columns, err = f.describe(ctx, src, objects[0]); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", objects[0].name, err)
+	}
+
+	w := &record.Writer{}
+	sample := func(row map[string]interface{}) error {
+		if err := w.Sample(preview, row); err != nil {
+			return err
+		}
+		if len(preview.Rows) >= limit {
+			return errEnough
+		}
+		return nil
+	}
+	for _, o := range objects {
+		if len(preview.Rows) >= limit {
+			break
+		}
+		if err := f.read(ctx, src, o, nil, sample); err != nil && err != errEnough {
+			return nil, fmt.Errorf("failed to read %s: %v", o.name, err)
+		}
+	}
+	return preview, nil
+}
+
+// describe returns the columns of a file: the header of a CSV file, the
+// schema of a Parquet file, and for JSON Lines the fields of its first
+// records.
+func (f *Files) describe(ctx context.Context, src source, o object) ([]types.Column, error) {
+	var columns []types.Column
+	var sample []map[string]interface{}
+	err := f.read(ctx, src, o, func(cols []types.Column) error {
+		columns = cols
+		return errEnough
+	}, func(row map[string]interface{}) error {
+		if sample = append(sample, row); len(sample) >= describeRows {
+			return errEnough
+		}
+		return nil
+	})
+	if err != nil && err != errEnough {
+		return nil, err
+	}
+	if columns == nil {
+		columns = jsonColumns(sample)
+	}
+	return columns, nil
+}
+
+// jsonColumns describes JSON records by the fields they have, sorted by
+// name and typed after their first non-null value.
+func jsonColumns(rows []map[string]interface{}) []types.Column {
+	var columns []types.Column
+	index := map[string]int{}
+	for _, row := range rows {
+		for name, v := range row {
+			i, ok := index[name]
+			if !ok {
+				i = len(columns)
+				index[name] = i
+				columns = append(columns, types.Column{Name: name, Type: "NULL", Nullable: true})
+			}
+			if columns[i].Type == "NULL" {
+				columns[i].Type = jsonType(v)
+			}
+		}
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Name < columns[j].Name })
+	return columns
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "STRING"
+	case json.Number:
+		return "NUMBER"
+	case bool:
+		return "BOOLEAN"
+	case map[string]interface{}:
+		return "OBJECT"
+	case []interface{}:
+		return "ARRAY"
+	}
+	return "NULL"
+}
@@ -0,0 +1,288 @@
+package files
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	retldb "retl/db"
+	"retl/inputs/producer"
+	"retl/inputs/record"
+	"retl/inputs/state"
+	"retl/inputs/types"
+	"strings"
+	"unicode/utf8"
+)
+
+// ProcessedKey holds the files already read, with their versions.
+const ProcessedKey = "files"
+
+// Files reads CSV, JSON Lines and Parquet files from a local path or an
+// S3 compatible bucket, one record per row. Each run only reads the files
+// that are new, or were rewritten, since the previous run.
+type Files struct {
+	Conf *types.ConfigType
+}
+
+func (f *Files) Run() error {
+	producer, err := producer.New(f.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	src, err := f.source()
+	if err != nil {
+		return err
+	}
+	dbClient, err := retldb.NewClient()
+	if err != nil {
+		return err
+	}
+	store := state.New(dbClient)
+	pipelineID := os.Getenv("PIPELINE_NAME")
+	processed := map[string]string{}
+	if value, ok, err := store.Get(pipelineID, ProcessedKey); err != nil {
+		return err
+	} else if ok {
+		if err := json.Unmarshal([]byte(value), &processed); err != nil {
+			return fmt.Errorf("invalid %s state: %v", ProcessedKey, err)
+		}
+	}
+
+	ctx := context.TODO()
+	objects, err := src.list(ctx)
+	if err != nil {
+		return err
+	}
+	w := &record.Writer{Producer: producer, PipelineID: pipelineID}
+	emit := func(row map[string]interface{}) error {
+		return w.Write(ctx, row)
+	}
+	current := make(map[string]string, len(objects))
+	for _, o := range objects {
+		current[o.name] = o.version
+		if processed[o.name] == o.version {
+			continue
+		}
+		if err := f.read(ctx, src, o, nil, emit); err != nil {
+			return fmt.Errorf("failed to read %s: %v", o.name, err)
+		}
+		// A file is only marked once all its rows are delivered. One that
+		// fails halfway is read again in full by the next run.
+		if err := producer.Flush(ctx); err != nil {
+			return err
+		}
+		processed[o.name] = o.version
+		if err := saveProcessed(store, pipelineID, processed); err != nil {
+			return err
+		}
+	}
+	if err := producer.Close(); err != nil {
+		return err
+	}
+
+	// Forget files that no longer match, so the state does not grow
+	// without bound.
+	if len(processed) != len(current) {
+		for name, version := range processed {
+			if current[name] != version {
+				delete(processed, name)
+			}
+		}
+		return saveProcessed(store, pipelineID, processed)
+	}
+	return nil
+}
+
+func saveProcessed(store *state.Store, pipelineID string, processed map[string]string) error {
+	value, err := json.Marshal(processed)
+	if err != nil {
+		return err
+	}
+	return store.Set(pipelineID, ProcessedKey, string(value))
+}
+
+// format returns the configured format, or guesses it from the file name.
+func (f *Files) format(name string) (string, error) {
+	if format := f.Conf.Setting("format"); format != "" {
+		return format, nil
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, ".gz"))
+	switch {
+	case strings.HasSuffix(name, ".csv"), strings.HasSuffix(name, ".tsv"):
+		return "csv", nil
+	case strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".json"):
+		return "jsonl", nil
+	case strings.HasSuffix(name, ".parquet"):
+		return "parquet", nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %s, set one of csv, jsonl or parquet", name)
+}
+
+// read passes the rows of a file to emit. columns, when set, is first
+// given the columns of a CSV or Parquet file.
+func (f *Files) read(ctx context.Context, src source, o object, columns func([]types.Column) error, emit func(map[string]interface{}) error) error {
+	format, err := f.format(o.name)
+	if err != nil {
+		return err
+	}
+	body, err := src.open(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if format == "parquet" {
+		return f.readParquet(ctx, body, columns, emit)
+	}
+	var r io.Reader = body
+	if strings.HasSuffix(o.name, ".gz") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	switch format {
+	case "csv":
+		return f.readCSV(r, columns, emit)
+	case "jsonl":
+		return readJSONLines(r, emit)
+	}
+	return fmt.Errorf("unknown format %q, expected csv, jsonl or parquet", format)
+}
+
+// readCSV reads the records as strings, named after the header unless
+// csv_header is false, in which case columns are column_1, column_2 and so
+// on.
+func (f *Files) readCSV(r io.Reader, columns func([]types.Column) error, emit func(map[string]interface{}) error) error {
+	delimiter, err := f.rune("csv_delimiter", ',')
+	if err != nil {
+		return err
+	}
+	quote, err := f.rune("csv_quote", '"')
+	if err != nil {
+		return err
+	}
+	reader := newCSVReader(r, delimiter, quote)
+
+	var header []string
+	if f.Conf.Setting("csv_header") != "false" {
+		if header, err = reader.read(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := csvColumns(header, columns); err != nil {
+			return err
+		}
+	}
+	for n := 1; ; n++ {
+		fields, err := reader.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			for i := range fields {
+				header = append(header, fmt.Sprintf("column_%d", i+1))
+			}
+			if err := csvColumns(header, columns); err != nil {
+				return err
+			}
+		}
+		if len(fields) != len(header) {
+			return fmt.Errorf("record %d has %d fields, expected %d", n, len(fields), len(header))
+		}
+		row := make(map[string]interface{}, len(fields))
+		for i, name := range header {
+			row[name] = fields[i]
+		}
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+}
+
+// csvColumns describes a CSV header: every field is a string, empty at
+// worst.
+func csvColumns(header []string, columns func([]types.Column) error) error {
+	if columns == nil {
+		return nil
+	}
+	cols := make([]types.Column, len(header))
+	for i, name := range header {
+		cols[i] = types.Column{Name: name, Type: "STRING"}
+	}
+	return columns(cols)
+}
+
+// rune reads a single character setting. "tab" stands for a tab, and
+// "none" disables the character.
+func (f *Files) rune(key string, def rune) (rune, error) {
+	switch value := f.Conf.Setting(key); value {
+	case "":
+		return def, nil
+	case "tab", `\t`:
+		return '\t', nil
+	case "none":
+		return 0, nil
+	default:
+		if utf8.RuneCountInString(value) != 1 {
+			return 0, fmt.Errorf("%s must be a single character", key)
+		}
+		r, _ := utf8.DecodeRuneInString(value)
+		return r, nil
+	}
+}
+
+func readJSONLines(r io.Reader, emit func(map[string]interface{}) error) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	for n := 1; ; n++ {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("record %d: %v", n, err)
+		}
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+}
+
+// readParquet reads the file through Arrow. Parquet needs random access,
+// so files from S3 are first copied to a temporary file.
+func (f *Files) readParquet(ctx context.Context, body io.Reader, columns func([]types.Column) error, emit func(map[string]interface{}) error) error {
+	file, ok := body.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp("", "retl-*.parquet")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, body); err != nil {
+			return err
+		}
+		file = tmp
+	}
+	pf, err := openParquet(file)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+	if columns != nil {
+		if err := columns(pf.describe()); err != nil {
+			return err
+		}
+	}
+	return pf.read(ctx, f.Conf.Setting("decimals_as_strings") == "true", emit)
+}
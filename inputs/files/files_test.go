@@ -0,0 +1,229 @@
+package files
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"retl/inputs/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		limit    int
+		columns  []types.Column
+		rows     []string
+	}{
+		{
+			name:     "csv",
+			settings: map[string]interface{}{"path": "testdata/*.csv", "csv_delimiter": ";"},
+			limit:    10,
+			columns:  []types.Column{{Name: "id", Type: "STRING"}, {Name: "name", Type: "STRING"}, {Name: "note", Type: "STRING"}},
+			rows:     []string{`{"id":"1","name":"Ada","note":"semi;colon"}`, `{"id":"2","name":"Grace","note":""}`},
+		},
+		{
+			name:     "csv without header",
+			settings: map[string]interface{}{"path": "testdata/users.csv", "csv_delimiter": ";", "csv_header": "false"},
+			limit:    1,
+			columns:  []types.Column{{Name: "column_1", Type: "STRING"}, {Name: "column_2", Type: "STRING"}, {Name: "column_3", Type: "STRING"}},
+			rows:     []string{`{"column_1":"id","column_2":"name","column_3":"note"}`},
+		},
+		{
+			name:     "json lines",
+			settings: map[string]interface{}{"path": "testdata/events.jsonl"},
+			limit:    10,
+			columns: []types.Column{
+				{Name: "id", Type: "NUMBER", Nullable: true},
+				{Name: "props", Type: "OBJECT", Nullable: true},
+				{Name: "tags", Type: "ARRAY", Nullable: true},
+				{Name: "type", Type: "STRING", Nullable: true},
+			},
+			rows: []string{`{"id":1,"props":{"plan":"pro"},"type":"signup"}`, `{"id":2,"tags":["a"],"type":null}`},
+		},
+		{
+			name:     "parquet",
+			settings: map[string]interface{}{"path": "testdata/*.parquet"},
+			limit:    2,
+			columns: []types.Column{
+				{Name: "registration_dttm", Type: "TIMESTAMP", Nullable: true},
+				{Name: "id", Type: "INT32", Nullable: true},
+				{Name: "first_name", Type: "STRING", Nullable: true},
+				{Name: "last_name", Type: "STRING", Nullable: true},
+				{Name: "email", Type: "STRING", Nullable: true},
+				{Name: "gender", Type: "STRING", Nullable: true},
+				{Name: "ip_address", Type: "STRING", Nullable: true},
+				{Name: "cc", Type: "STRING", Nullable: true},
+				{Name: "country", Type: "STRING", Nullable: true},
+				{Name: "birthdate", Type: "STRING", Nullable: true},
+				{Name: "salary", Type: "DOUBLE", Nullable: true},
+				{Name: "title", Type: "STRING", Nullable: true},
+				{Name: "comments", Type: "STRING", Nullable: true},
+			},
+			rows: []string{
+				`{"birthdate":"3/8/1971","cc":"6759521864920116","comments":"1E+02","country":"Indonesia","email":"ajordan0@com.com","first_name":"Amanda","gender":"Female","id":1,"ip_address":"1.197.201.2","last_name":"Jordan","registration_dttm":"2016-02-03T07:55:29Z","salary":49756.53,"title":"Internal Auditor"}`,
+				`{"birthdate":"1/16/1968","cc":"","comments":"","country":"Canada","email":"afreeman1@is.gd","first_name":"Albert","gender":"Male","id":2,"ip_address":"218.111.175.34","last_name":"Freeman","registration_dttm":"2016-02-03T17:04:03Z","salary":150280.17,"title":"Accountant IV"}`,
+			},
+		},
+		{
+			name:     "columns only",
+			settings: map[string]interface{}{"path": "testdata/users.csv", "csv_delimiter": ";"},
+			columns:  []types.Column{{Name: "id", Type: "STRING"}, {Name: "name", Type: "STRING"}, {Name: "note", Type: "STRING"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Files{Conf: &types.ConfigType{Settings: tt.settings}}
+			preview, err := f.Preview(context.Background(), tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(preview.Columns, tt.columns) {
+				t.Errorf("columns = %+v, want %+v", preview.Columns, tt.columns)
+			}
+			var rows []string
+			for _, row := range preview.Rows {
+				rows = append(rows, string(row))
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("rows = %v, want %v", rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestPreviewWithoutFiles(t *testing.T) {
+	f := &Files{Conf: &types.ConfigType{Settings: map[string]interface{}{"path": "testdata/*.xlsx"}}}
+	if _, err := f.Preview(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("got error %v, want no files match", err)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	path := filepath.Join("testdata", "*")
+	f := &Files{Conf: &types.ConfigType{Settings: map[string]interface{}{"path": path}}}
+	ctx := context.Background()
+	if err := f.TestConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := f.Schemas(ctx)
+	if err != nil || !reflect.DeepEqual(schemas, []string{path}) {
+		t.Fatalf("schemas = %v, %v", schemas, err)
+	}
+	tables, err := f.Tables(ctx, path)
+	want := []string{"testdata/events.jsonl", "testdata/userdata1.parquet", "testdata/users.csv"}
+	if err != nil || !reflect.DeepEqual(tables, want) {
+		t.Fatalf("tables = %v, %v, want %v", tables, err, want)
+	}
+	columns, err := f.Columns(ctx, path, "testdata/users.csv")
+	if err != nil || len(columns) != 1 || columns[0].Name != "id;name;note" {
+		t.Errorf("columns = %+v, %v", columns, err)
+	}
+	if _, err := f.Columns(ctx, path, "testdata/missing.csv"); err == nil {
+		t.Error("columns of a file that does not match were read")
+	}
+	if _, err := f.Tables(ctx, "elsewhere"); err == nil {
+		t.Error("tables of an unknown schema were listed")
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		delimiter rune
+		quote     rune
+		want      [][]string
+		err       string
+	}{
+		{name: "quoted fields", input: "a,\"b,\"\"c\"\"\"\n", delimiter: ',', quote: '"', want: [][]string{{"a", `b,"c"`}}},
+		{name: "line break in a quoted field", input: "'x\ny'|z\r\n", delimiter: '|', quote: '\'', want: [][]string{{"x\ny", "z"}}},
+		{name: "blank lines and no final newline", input: "a\n\nb", delimiter: ',', quote: '"', want: [][]string{{"a"}, {"b"}}},
+		{name: "quoting disabled", input: "\"a\"\tb\n", delimiter: '\t', want: [][]string{{`"a"`, "b"}}},
+		{name: "empty quoted field", input: "\"\"\n", delimiter: ',', quote: '"', want: [][]string{{""}}},
+		{name: "unterminated quote", input: "a\n\"b\n", delimiter: ',', quote: '"', err: "line 2: unterminated quoted field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newCSVReader(strings.NewReader(tt.input), tt.delimiter, tt.quote)
+			var got [][]string
+			for {
+				fields, err := r.read()
+				if err != nil {
+					if err != io.EOF && (tt.err == "" || err.Error() != tt.err) {
+						t.Fatalf("got error %v, want %q", err, tt.err)
+					}
+					break
+				}
+				got = append(got, fields)
+			}
+			if tt.err == "" && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMinIO previews the test files from an S3 compatible store when
+// MINIO_ENDPOINT is set, with MINIO_ACCESS_KEY, MINIO_SECRET_KEY and
+// MINIO_BUCKET, which is created when missing. For a local server:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	MINIO_ENDPOINT=http://localhost:9000 MINIO_ACCESS_KEY=minioadmin \
+//	MINIO_SECRET_KEY=minioadmin MINIO_BUCKET=retl-test go test ./inputs/files
+func TestMinIO(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	f := &Files{Conf: &types.ConfigType{
+		Settings: map[string]interface{}{
+			"path":        "s3://" + bucket + "/retl-test/*.parquet",
+			"s3_endpoint": endpoint,
+			"aws_region":  "us-east-1",
+		},
+		Secrets: map[string]interface{}{
+			"aws_access_key_id":     os.Getenv("MINIO_ACCESS_KEY"),
+			"aws_secret_access_key": os.Getenv("MINIO_SECRET_KEY"),
+		},
+	}}
+	src, err := f.source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := src.(*s3Source).client
+	ctx := context.Background()
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, err := os.Open("testdata/userdata1.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String("retl-test/userdata1.parquet"), Body: file}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.TestConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := f.Preview(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Columns) != 13 || len(preview.Rows) != 3 {
+		t.Errorf("got %d columns and %d rows, want 13 and 3", len(preview.Columns), len(preview.Rows))
+	}
+}
@@ -0,0 +1,238 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"github.com/apache/arrow/go/v17/parquet/schema"
+)
+
+// parquetBatchSize is the number of rows decoded at a time.
+const parquetBatchSize = 1024
+
+// parquetFile reads a Parquet file as Arrow records. Nested columns become
+// objects, arrays and, for maps, objects keyed by the map keys.
+type parquetFile struct {
+	reader *pqarrow.FileReader
+	schema *schema.Schema
+}
+
+func openParquet(r parquet.ReaderAtSeeker) (*parquetFile, error) {
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Parquet file: %v", err)
+	}
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: parquetBatchSize}, memory.DefaultAllocator)
+	if err != nil {
+		pf.Close()
+		return nil, fmt.Errorf("unsupported Parquet schema: %v", err)
+	}
+	return &parquetFile{reader: reader, schema: pf.MetaData().Schema}, nil
+}
+
+func (f *parquetFile) Close() error {
+	return f.reader.ParquetReader().Close()
+}
+
+// describe lists the top-level fields as columns, with nested types
+// spelled as LIST<...>, MAP<..., ...> and STRUCT<name TYPE, ...>.
+func (f *parquetFile) describe() []types.Column {
+	fields := f.reader.Manifest.Fields
+	columns := make([]types.Column, len(fields))
+	for i := range fields {
+		columns[i] = types.Column{Name: fields[i].Field.Name, Type: f.typeName(&fields[i]), Nullable: fields[i].Field.Nullable}
+	}
+	return columns
+}
+
+func (f *parquetFile) typeName(field *pqarrow.SchemaField) string {
+	switch t := field.Field.Type.(type) {
+	case *arrow.ListType:
+		return "LIST<" + f.typeName(&field.Children[0]) + ">"
+	case *arrow.MapType:
+		entry := field.Children[0]
+		return "MAP<" + f.typeName(&entry.Children[0]) + ", " + f.typeName(&entry.Children[1]) + ">"
+	case *arrow.StructType:
+		names := make([]string, len(field.Children))
+		for i := range field.Children {
+			names[i] = field.Children[i].Field.Name + " " + f.typeName(&field.Children[i])
+		}
+		return "STRUCT<" + strings.Join(names, ", ") + ">"
+	case arrow.DecimalType:
+		return fmt.Sprintf("DECIMAL(%d,%d)", t.GetPrecision(), t.GetScale())
+	case *arrow.BinaryType:
+		if f.logical(field).Equals(schema.JSONLogicalType{}) {
+			return "JSON"
+		}
+		return "BINARY"
+	case *arrow.FixedSizeBinaryType:
+		if f.logical(field).Equals(schema.UUIDLogicalType{}) {
+			return "UUID"
+		}
+		return "BINARY"
+	}
+	switch field.Field.Type.ID() {
+	case arrow.BOOL:
+		return "BOOLEAN"
+	case arrow.STRING:
+		return "STRING"
+	case arrow.FLOAT32:
+		return "FLOAT"
+	case arrow.FLOAT64:
+		return "DOUBLE"
+	case arrow.DATE32:
+		return "DATE"
+	case arrow.TIME32, arrow.TIME64:
+		return "TIME"
+	}
+	return strings.ToUpper(field.Field.Type.Name())
+}
+
+// logical returns the Parquet logical type of a leaf, which Arrow does not
+// keep for JSON and UUID columns.
+func (f *parquetFile) logical(field *pqarrow.SchemaField) schema.LogicalType {
+	if !field.IsLeaf() {
+		return schema.NoLogicalType{}
+	}
+	return f.schema.Column(field.ColIndex).LogicalType()
+}
+
+// read passes the rows of the file to emit, a batch at a time.
+func (f *parquetFile) read(ctx context.Context, decimalsAsStrings bool, emit func(map[string]interface{}) error) error {
+	records, err := f.reader.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer records.Release()
+
+	fields := f.reader.Manifest.Fields
+	for records.Next() {
+		rec := records.Record()
+		for r := 0; r < int(rec.NumRows()); r++ {
+			row := make(map[string]interface{}, len(fields))
+			for c := range fields {
+				v, err := f.value(&fields[c], rec.Column(c), r, decimalsAsStrings)
+				if err != nil {
+					return fmt.Errorf("column %s: %v", fields[c].Field.Name, err)
+				}
+				row[fields[c].Field.Name] = v
+			}
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+	}
+	if err := records.Err(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// value converts the i-th value of an Arrow array into its JSON
+// representation. Decimals keep their exact literal (or become strings),
+// dates and times are rendered like the other inputs render them, and
+// binary values without a string annotation are kept as text when they
+// are valid UTF-8 and base64 encoded otherwise.
+func (f *parquetFile) value(field *pqarrow.SchemaField, arr arrow.Array, i int, decimalsAsStrings bool) (interface{}, error) {
+	if arr.IsNull(i) {
+		return nil, nil
+	}
+	switch a := arr.(type) {
+	case *array.Map:
+		entry := &field.Children[0]
+		start, end := a.ValueOffsets(i)
+		m := make(map[string]interface{}, end-start)
+		for j := int(start); j < int(end); j++ {
+			key, err := f.value(&entry.Children[0], a.Keys(), j, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			value, err := f.value(&entry.Children[1], a.Items(), j, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, nil
+	case array.ListLike:
+		start, end := a.ValueOffsets(i)
+		list := make([]interface{}, 0, end-start)
+		for j := int(start); j < int(end); j++ {
+			v, err := f.value(&field.Children[0], a.ListValues(), j, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case *array.Struct:
+		m := make(map[string]interface{}, a.NumField())
+		for j := 0; j < a.NumField(); j++ {
+			v, err := f.value(&field.Children[j], a.Field(j), i, decimalsAsStrings)
+			if err != nil {
+				return nil, err
+			}
+			m[field.Children[j].Field.Name] = v
+		}
+		return m, nil
+	case *array.Float32:
+		return a.Value(i), nil
+	case *array.Float64:
+		return record.Float(a.Value(i)), nil
+	case *array.String:
+		return a.Value(i), nil
+	case *array.Binary:
+		if f.logical(field).Equals(schema.JSONLogicalType{}) {
+			decoder := json.NewDecoder(bytes.NewReader(a.Value(i)))
+			decoder.UseNumber()
+			var parsed interface{}
+			if err := decoder.Decode(&parsed); err != nil {
+				return nil, fmt.Errorf("invalid JSON value: %v", err)
+			}
+			return parsed, nil
+		}
+		return binaryValue(a.Value(i)), nil
+	case *array.FixedSizeBinary:
+		b := a.Value(i)
+		if len(b) == 16 && f.logical(field).Equals(schema.UUIDLogicalType{}) {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+		}
+		return binaryValue(b), nil
+	case *array.Decimal128:
+		return record.Decimal(a.Value(i).BigInt(), int(a.DataType().(*arrow.Decimal128Type).Scale), decimalsAsStrings), nil
+	case *array.Decimal256:
+		return record.Decimal(a.Value(i).BigInt(), int(a.DataType().(*arrow.Decimal256Type).Scale), decimalsAsStrings), nil
+	case *array.Date32:
+		return a.Value(i).ToTime().Format(time.DateOnly), nil
+	case *array.Time32:
+		return a.Value(i).ToTime(a.DataType().(*arrow.Time32Type).Unit).Format("15:04:05.999999999"), nil
+	case *array.Time64:
+		return a.Value(i).ToTime(a.DataType().(*arrow.Time64Type).Unit).Format("15:04:05.999999999"), nil
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit).UTC().Format(time.RFC3339Nano), nil
+	}
+	return arr.GetOneForMarshal(i), nil
+}
+
+func binaryValue(b []byte) interface{} {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
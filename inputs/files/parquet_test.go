@@ -0,0 +1,161 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"retl/inputs/types"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/decimal128"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+)
+
+// writeParquet writes two rows covering nested, decimal and temporal
+// columns, the second of them null wherever a column allows it.
+func writeParquet(t *testing.T) []byte {
+	t.Helper()
+	point := arrow.StructOf(arrow.Field{Name: "x", Type: arrow.PrimitiveTypes.Float64}, arrow.Field{Name: "y", Type: arrow.PrimitiveTypes.Float64, Nullable: true})
+	s := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 20, Scale: 2}, Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "attrs", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int32), Nullable: true},
+		{Name: "point", Type: point, Nullable: true},
+		{Name: "born", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+		{Name: "at", Type: arrow.FixedWidthTypes.Timestamp_ms, Nullable: true},
+		{Name: "raw", Type: arrow.BinaryTypes.Binary, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, s)
+	defer b.Release()
+
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+
+	amounts := b.Field(1).(*array.Decimal128Builder)
+	amounts.Append(decimal128.FromI64(123456789012345678))
+	amounts.AppendNull()
+
+	tags := b.Field(2).(*array.ListBuilder)
+	tags.Append(true)
+	tags.ValueBuilder().(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	tags.AppendNull()
+
+	attrs := b.Field(3).(*array.MapBuilder)
+	attrs.Append(true)
+	attrs.KeyBuilder().(*array.StringBuilder).Append("n")
+	attrs.ItemBuilder().(*array.Int32Builder).Append(7)
+	attrs.AppendNull()
+
+	points := b.Field(4).(*array.StructBuilder)
+	points.Append(true)
+	points.FieldBuilder(0).(*array.Float64Builder).Append(1.5)
+	points.FieldBuilder(1).(*array.Float64Builder).AppendNull()
+	points.AppendNull()
+
+	b.Field(5).(*array.Date32Builder).AppendValues([]arrow.Date32{19783, 0}, []bool{true, false})
+	b.Field(6).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1709288430500, 0}, []bool{true, false})
+	b.Field(7).(*array.BinaryBuilder).AppendValues([][]byte{{0xff, 0x00}, nil}, []bool{true, false})
+
+	rec := b.NewRecord()
+	defer rec.Release()
+	table := array.NewTableFromRecords(s, []arrow.Record{rec})
+	defer table.Release()
+
+	var buf bytes.Buffer
+	if err := pqarrow.WriteTable(table, &buf, 1024, nil, pqarrow.DefaultWriterProps()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquet(t *testing.T) {
+	pf, err := openParquet(bytes.NewReader(writeParquet(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+
+	wantColumns := []types.Column{
+		{Name: "id", Type: "INT64"},
+		{Name: "amount", Type: "DECIMAL(20,2)", Nullable: true},
+		{Name: "tags", Type: "LIST<STRING>", Nullable: true},
+		{Name: "attrs", Type: "MAP<STRING, INT32>", Nullable: true},
+		{Name: "point", Type: "STRUCT<x DOUBLE, y DOUBLE>", Nullable: true},
+		{Name: "born", Type: "DATE", Nullable: true},
+		{Name: "at", Type: "TIMESTAMP", Nullable: true},
+		{Name: "raw", Type: "BINARY", Nullable: true},
+	}
+	if got := pf.describe(); !reflect.DeepEqual(got, wantColumns) {
+		t.Errorf("columns = %+v, want %+v", got, wantColumns)
+	}
+
+	tests := []struct {
+		name              string
+		decimalsAsStrings bool
+		want              []string
+	}{
+		{
+			name: "decimals as numbers",
+			want: []string{
+				`{"amount":1234567890123456.78,"at":"2024-03-01T10:20:30.5Z","attrs":{"n":7},"born":"2024-03-01","id":1,"point":{"x":1.5,"y":null},"raw":"/wA=","tags":["a","b"]}`,
+				`{"amount":null,"at":null,"attrs":null,"born":null,"id":2,"point":null,"raw":null,"tags":null}`,
+			},
+		},
+		{
+			name:              "decimals as strings",
+			decimalsAsStrings: true,
+			want: []string{
+				`{"amount":"1234567890123456.78","at":"2024-03-01T10:20:30.5Z","attrs":{"n":7},"born":"2024-03-01","id":1,"point":{"x":1.5,"y":null},"raw":"/wA=","tags":["a","b"]}`,
+				`{"amount":null,"at":null,"attrs":null,"born":null,"id":2,"point":null,"raw":null,"tags":null}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := pf.read(context.Background(), tt.decimalsAsStrings, func(row map[string]interface{}) error {
+				b, err := json.Marshal(row)
+				got = append(got, string(b))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetInvalid(t *testing.T) {
+	if _, err := openParquet(bytes.NewReader([]byte("PAR1 not really"))); err == nil {
+		t.Error("opened a file that is not Parquet")
+	}
+}
+
+func TestParquetReadsEveryRow(t *testing.T) {
+	file, err := os.Open("testdata/userdata1.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	pf, err := openParquet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	n := 0
+	if err := pf.read(context.Background(), false, func(map[string]interface{}) error { n++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("read %d rows, want 1000", n)
+	}
+}
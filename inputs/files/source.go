@@ -0,0 +1,127 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// object is a file matched by the input's pattern. Its version changes
+// whenever the file is rewritten.
+type object struct {
+	name    string
+	version string
+}
+
+// source lists and opens the files matching a glob pattern, in name order.
+// As with filepath.Match, * does not cross a /.
+type source interface {
+	list(ctx context.Context) ([]object, error)
+	open(ctx context.Context, o object) (io.ReadCloser, error)
+}
+
+type localSource struct {
+	pattern string
+}
+
+func (s *localSource) list(ctx context.Context) ([]object, error) {
+	names, err := filepath.Glob(s.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path pattern %q: %v", s.pattern, err)
+	}
+	var objects []object
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		objects = append(objects, object{name: name, version: fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())})
+	}
+	return objects, nil
+}
+
+func (s *localSource) open(ctx context.Context, o object) (io.ReadCloser, error) {
+	return os.Open(o.name)
+}
+
+// s3Source reads from S3 or an S3 compatible store such as MinIO. It lists
+// the keys under the literal part of the pattern and matches the rest.
+type s3Source struct {
+	client  *s3.Client
+	bucket  string
+	pattern string
+}
+
+func (s *s3Source) list(ctx context.Context) ([]object, error) {
+	if _, err := path.Match(s.pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid path pattern %q: %v", s.pattern, err)
+	}
+	prefix := s.pattern
+	if i := strings.IndexAny(prefix, `*?[\`); i >= 0 {
+		prefix = prefix[:i]
+	}
+	var objects []object
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(prefix)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %v", s.bucket, prefix, err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if ok, _ := path.Match(s.pattern, key); ok {
+				objects = append(objects, object{name: key, version: aws.ToString(obj.ETag)})
+			}
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].name < objects[j].name })
+	return objects, nil
+}
+
+func (s *s3Source) open(ctx context.Context, o object) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(o.name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %v", s.bucket, o.name, err)
+	}
+	return out.Body, nil
+}
+
+// source picks the local disk or S3 from the configured path, which is
+// either a local pattern or s3://bucket/pattern.
+func (f *Files) source() (source, error) {
+	pattern := f.Conf.Setting("path")
+	if pattern == "" {
+		return nil, fmt.Errorf("files input needs a path")
+	}
+	if !strings.HasPrefix(pattern, "s3://") {
+		return &localSource{pattern: pattern}, nil
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(pattern, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 path %q, expected s3://bucket/pattern", pattern)
+	}
+
+	options := s3.Options{
+		Region: f.Conf.Setting("aws_region"),
+	}
+	if id := f.Conf.Secret("aws_access_key_id"); id != "" {
+		options.Credentials = credentials.NewStaticCredentialsProvider(id, f.Conf.Secret("aws_secret_access_key"), "")
+	}
+	if endpoint := f.Conf.Setting("s3_endpoint"); endpoint != "" {
+		options.BaseEndpoint = aws.String(endpoint)
+		options.UsePathStyle = true
+	}
+	return &s3Source{client: s3.New(options), bucket: bucket, pattern: key}, nil
+}
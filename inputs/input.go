@@ -1,6 +1,31 @@
 package inputs
 
+import (
+	"context"
+
+	"retl/inputs/types"
+)
+
 type Input interface {
 	Run() error
 }
 
+// ConnectionTester is implemented by inputs that can check their
+// configuration reaches the source without running a sync.
+type ConnectionTester interface {
+	TestConnection(ctx context.Context) error
+}
+
+// SchemaDiscoverer is implemented by inputs that can list what the source
+// contains, so a pipeline can be built by picking tables and columns.
+type SchemaDiscoverer interface {
+	Schemas(ctx context.Context) ([]string, error)
+	Tables(ctx context.Context, schema string) ([]string, error)
+	Columns(ctx context.Context, schema, table string) ([]types.Column, error)
+}
+
+// Previewer is implemented by inputs that can read a sample of what a run
+// would write without writing it anywhere.
+type Previewer interface {
+	Preview(ctx context.Context, limit int) (*types.Preview, error)
+}
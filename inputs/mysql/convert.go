@@ -0,0 +1,47 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// convertValue maps a value as returned by the driver to its JSON form.
+// DECIMAL stays exact as a JSON number or string, JSON columns are embedded
+// as documents, BIT becomes an unsigned integer, binary columns are base64
+// and times are RFC 3339 in UTC. Zero dates, which MySQL allows but are
+// not valid times, become null.
+func convertValue(dbType string, v interface{}, decimalsAsStrings bool) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		if dbType == "DATE" {
+			return v.Format(time.DateOnly)
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		switch dbType {
+		case "DECIMAL":
+			if decimalsAsStrings {
+				return string(v)
+			}
+			return json.Number(v)
+		case "JSON":
+			if json.Valid(v) {
+				return json.RawMessage(append([]byte(nil), v...))
+			}
+		case "BIT":
+			var n uint64
+			for _, b := range v {
+				n = n<<8 | uint64(b)
+			}
+			return n
+		case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+			return base64.StdEncoding.EncodeToString(v)
+		}
+		return string(v)
+	}
+	return v
+}
@@ -0,0 +1,80 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+
+	"retl/inputs/types"
+)
+
+func (m *MySQL) TestConnection(ctx context.Context) error {
+	return m.source().TestConnection(ctx)
+}
+
+// Schemas lists the databases visible to the user, leaving out the
+// server's own.
+func (m *MySQL) Schemas(ctx context.Context) ([]string, error) {
+	return m.list(ctx, `SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')
+		ORDER BY schema_name`)
+}
+
+func (m *MySQL) Tables(ctx context.Context, schema string) ([]string, error) {
+	return m.list(ctx, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = ? ORDER BY table_name`, schema)
+}
+
+func (m *MySQL) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	db, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT column_name, column_type, is_nullable, column_key = 'PRI' FROM information_schema.columns
+		WHERE table_schema = ? AND table_name = ? ORDER BY ordinal_position`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up columns of %s.%s: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []types.Column
+	for rows.Next() {
+		var col types.Column
+		var nullable string
+		if err := rows.Scan(&col.Name, &col.Type, &nullable, &col.PrimaryKey); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func (m *MySQL) list(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	db, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Preview reads the first rows of the configured table or query. It
+// selects the whole table, not just the rows new since the last
+// incremental sync.
+func (m *MySQL) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	return m.source().Preview(ctx, limit)
+}
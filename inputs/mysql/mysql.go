@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"net"
+	"retl/inputs/sqlsource"
+	"retl/inputs/types"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL reads a table or, in SQL mode, a custom query from MySQL or
+// MariaDB.
+type MySQL struct {
+	Conf *types.ConfigType
+}
+
+// source runs the input through the generic SQL source.
+func (m *MySQL) source() *sqlsource.Source {
+	return &sqlsource.Source{
+		Name: "MySQL",
+		Driver: &sqlsource.Driver{
+			Name: "mysql",
+			Open: func(conf *types.ConfigType) (*sql.DB, error) {
+				return m.open()
+			},
+			Quote:       quoteIdentifier,
+			Placeholder: func(int) string { return "?" },
+			Convert: func(col *sql.ColumnType, v interface{}, decimalsAsStrings bool) (interface{}, error) {
+				return convertValue(col.DatabaseTypeName(), v, decimalsAsStrings), nil
+			},
+			// Timestamp cursors are stored as RFC 3339, which MySQL does
+			// not parse; bind them as times so the driver formats them.
+			CursorValue: func(since string) interface{} {
+				if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+					return t
+				}
+				return since
+			},
+		},
+		Conf: m.Conf,
+	}
+}
+
+func (m *MySQL) Run() error {
+	return m.source().Run()
+}
+
+// open connects with the configured credentials. The "tls" setting takes
+// the driver's modes (true, skip-verify, preferred); a CA certificate or
+// client certificate in the secrets implies verified TLS.
+func (m *MySQL) open() (*sql.DB, error) {
+	port := m.Conf.Setting("port")
+	if port == "" {
+		port = "3306"
+	}
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(m.Conf.Setting("host"), port)
+	cfg.User = m.Conf.Secret("username")
+	cfg.Passwd = m.Conf.Secret("password")
+	cfg.DBName = m.Conf.Setting("database")
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.Timeout = 10 * time.Second
+
+	tlsConfig, err := m.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.TLS = tlsConfig
+	if tlsConfig == nil {
+		cfg.TLSConfig = m.Conf.Setting("tls")
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL configuration: %v", err)
+	}
+	return sql.OpenDB(connector), nil
+}
+
+func (m *MySQL) tlsConfig() (*tls.Config, error) {
+	caCert, clientCert, clientKey := m.Conf.Secret("ca_cert"), m.Conf.Secret("client_cert"), m.Conf.Secret("client_key")
+	if caCert == "" && clientCert == "" {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: m.Conf.Setting("host")}
+	if caCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("failed to parse MySQL CA certificate")
+		}
+		config.RootCAs = pool
+	}
+	if clientCert != "" {
+		keypair, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MySQL client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{keypair}
+	}
+	return config, nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
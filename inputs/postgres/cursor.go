@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"fmt"
+
+	"retl/inputs/state"
+)
+
+// applyCursor adds the cursor filter to spec and orders the rows by the
+// cursor, so the last row seen carries the new high-water mark.
+func applyCursor(spec *SourceSpec, cursor *state.Cursor) error {
+	if err := spec.checkColumn(cursor.Column); err != nil {
+		return fmt.Errorf("invalid cursor column: %v", err)
+	}
+	if len(spec.Columns) > 0 && !contains(spec.Columns, cursor.Column) {
+		spec.Columns = append(spec.Columns, cursor.Column)
+	}
+	spec.OrderBy = append([]OrderBy{{Column: cursor.Column}}, spec.OrderBy...)
+
+	since, ok, err := cursor.Since()
+	if err != nil || !ok {
+		return err
+	}
+	spec.Filters = append(spec.Filters, Filter{Column: cursor.Column, Op: ">", Value: since})
+	return nil
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"retl/inputs/types"
+)
+
+func (d *Postgres) TestConnection(ctx context.Context) error {
+	return d.source().TestConnection(ctx)
+}
+
+// Schemas lists the schemas visible to the user, leaving out the system
+// catalogs.
+func (d *Postgres) Schemas(ctx context.Context) ([]string, error) {
+	return d.list(ctx, `SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name NOT IN ('pg_catalog', 'information_schema') AND schema_name NOT LIKE 'pg_toast%'
+		ORDER BY schema_name`)
+}
+
+func (d *Postgres) Tables(ctx context.Context, schema string) ([]string, error) {
+	return d.list(ctx, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = $1 ORDER BY table_name`, schema)
+}
+
+func (d *Postgres) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	db, err := sql.Open("postgres", d.Conf.Secret("url"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT c.column_name, c.data_type, c.is_nullable, EXISTS (
+			SELECT 1 FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage k
+				ON k.constraint_schema = tc.constraint_schema AND k.constraint_name = tc.constraint_name
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+				AND tc.table_name = c.table_name AND k.column_name = c.column_name)
+		FROM information_schema.columns c
+		WHERE c.table_schema = $1 AND c.table_name = $2 ORDER BY c.ordinal_position`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up columns of %s.%s: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []types.Column
+	for rows.Next() {
+		var col types.Column
+		var nullable string
+		if err := rows.Scan(&col.Name, &col.Type, &nullable, &col.PrimaryKey); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func (d *Postgres) list(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	db, err := sql.Open("postgres", d.Conf.Secret("url"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Preview reads the first rows of the configured source. It selects the
+// whole source, not just the rows new since the last incremental sync.
+func (d *Postgres) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	return d.source().Preview(ctx, limit)
+}
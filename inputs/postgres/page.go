@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"retl/inputs/extract"
+	"retl/inputs/record"
+
+	"github.com/lib/pq"
+)
+
+// pageReader reads a validated source spec one keyset page at a time.
+type pageReader struct {
+	db   *sql.DB
+	spec *SourceSpec
+	key  []string
+}
+
+func (r *pageReader) ReadPage(ctx context.Context, rng extract.Range, after []interface{}, limit int) ([]extract.Row, error) {
+	query, args, err := r.spec.CompilePage(r.key, rng, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	page := make([]extract.Row, 0, limit)
+	for rows.Next() {
+		row, err := record.Scan(rows, columns, nil)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, row)
+	}
+	return page, rows.Err()
+}
+
+func (r *pageReader) Bounds(ctx context.Context) (int64, int64, bool, error) {
+	col := pq.QuoteIdentifier(r.key[0])
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s.%s", col, col, pq.QuoteIdentifier(r.spec.Schema), pq.QuoteIdentifier(r.spec.Table))
+	var min, max sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query).Scan(&min, &max); err != nil {
+		return 0, 0, false, err
+	}
+	return min.Int64, max.Int64, min.Valid, nil
+}
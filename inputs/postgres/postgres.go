@@ -2,130 +2,119 @@ package postgres
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"retl/inputs/extract"
+	"retl/inputs/sqlsource"
+	"retl/inputs/state"
 	"retl/inputs/types"
-	"time"
 
-	_ "github.com/lib/pq"
-	"github.com/segmentio/kafka-go"
+	"github.com/lib/pq"
 )
 
 type Postgres struct {
 	Conf *types.ConfigType
 }
 
-func (d *Postgres) Run() error {
-	fmt.Println("STARTED POSTGRES TO KAFKA")
-
-	keypair, err := tls.LoadX509KeyPair("service.cert", "service.key")
-	if err != nil {
-		log.Fatalf("Failed to load Access Key and/or Access Certificate: %s", err)
-	}
-
-	caCert, err := os.ReadFile("ca.pem")
-	if err != nil {
-		log.Fatalf("Failed to read CA Certificate file: %s", err)
-	}
-
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(caCert)
-	if !ok {
-		log.Fatalf("Failed to parse CA Certificate file: %s", err)
-	}
-
-	dialer := &kafka.Dialer{
-		Timeout:   10 * time.Second,
-		DualStack: true,
-		TLS: &tls.Config{
-			Certificates: []tls.Certificate{keypair},
-			RootCAs:      caCertPool,
+// source runs the input through the generic SQL source. Queries are
+// compiled from the validated source spec rather than the configured
+// table, and pages are read with the spec's filters.
+func (d *Postgres) source() *sqlsource.Source {
+	return &sqlsource.Source{
+		Name: "Postgres",
+		Driver: &sqlsource.Driver{
+			Name: "postgres",
+			DSN: func(conf *types.ConfigType) (string, error) {
+				return conf.Secret("url"), nil
+			},
+			Quote: pq.QuoteIdentifier,
+			Query: func(ctx context.Context, db *sql.DB, conf *types.ConfigType, cursor *state.Cursor) (string, []interface{}, error) {
+				return d.buildQuery(ctx, db, cursor)
+			},
+			Pages: d.pages,
 		},
+		Conf: d.Conf,
 	}
+}
 
-	brokerAddress := "kafka-297becac-sjsu-f7b6.k.aivencloud.com:11921"
-	topic := "aneesh_2"
-
-	producer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{brokerAddress},
-		Topic:   topic,
-		Dialer:  dialer,
-	})
-
-	dbURL := os.Getenv("POSTGRES_URL")
-	table := os.Getenv("POSTGRES_TABLE")
-	filter := os.Getenv("POSTGRES_FILTER")
-	fmt.Println(dbURL)
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-        log.Fatalf("Unable to connect to database: %v\n", err)
-    }
-    defer db.Close()
+func (d *Postgres) Run() error {
+	return d.source().Run()
+}
 
-	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", table, filter)
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Fatalf("Error fetching data: %v\n", err)
+// pages reads the source spec in chunks ordered by key.
+func (d *Postgres) pages(ctx context.Context, db *sql.DB, conf *types.ConfigType, key []string, cursor *state.Cursor) (extract.Reader, error) {
+	if conf.Setting("filter") != "" {
+		return nil, fmt.Errorf("paginated extraction is not supported in SQL mode")
 	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
+	spec, err := d.sourceSpec(ctx, db, cursor)
 	if err != nil {
-		log.Fatalf("Error getting columns: %v\n", err)
+		return nil, err
 	}
-	fmt.Println("Columns:", columns)
-
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-
-	for rows.Next() {
-		for i := range values {
-			valuePtrs[i] = &values[i] 
+	if spec.Limit > 0 {
+		return nil, fmt.Errorf("a source limit cannot be combined with paginated extraction")
+	}
+	for _, col := range key {
+		if err := spec.checkColumn(col); err != nil {
+			return nil, fmt.Errorf("invalid primary key: %v", err)
 		}
-
-		err := rows.Scan(valuePtrs...)
-		if err != nil {
-			log.Fatalf("Error scanning row: %v\n", err)
+		if len(spec.Columns) > 0 && !contains(spec.Columns, col) {
+			spec.Columns = append(spec.Columns, col)
 		}
+	}
+	return &pageReader{db: db, spec: spec, key: key}, nil
+}
 
-		rowData := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
 
-			if b, ok := val.([]byte); ok {
-				v = string(b)
-			} else {
-				v = val
-			}
-			rowData[col] = v
+// buildQuery compiles the configured source spec, restricted to new rows
+// when cursor is set. Free-form SQL, either a full query or a legacy raw
+// filter, is only run when an admin has enabled SQL mode for the input.
+func (d *Postgres) buildQuery(ctx context.Context, db *sql.DB, cursor *state.Cursor) (string, []interface{}, error) {
+	rawQuery, rawFilter := d.Conf.Setting("query"), d.Conf.Setting("filter")
+	if rawQuery != "" || rawFilter != "" {
+		if cursor != nil {
+			return "", nil, fmt.Errorf("incremental syncs are not supported in SQL mode")
 		}
-		fmt.Println("MARSHALLING HJSON")
-		jsonMarshalled, err := json.Marshal(rowData)
-		fmt.Println(err)
-		fmt.Println(string(jsonMarshalled))
-		if err != nil {
-			return err
+		if d.Conf.Setting("allow_sql") != "true" {
+			return "", nil, fmt.Errorf("free-form SQL is only allowed when SQL mode is enabled by an admin")
 		}
-		msg := kafka.Message{
-			Key:   []byte(os.Getenv("PIPELINE_NAME")),
-			Value: []byte(jsonMarshalled),
+		if rawQuery != "" {
+			return rawQuery, nil, nil
 		}
-		err = producer.WriteMessages(context.TODO(), msg)
+		spec, err := ParseSourceSpec("", d.Conf.Setting("table"))
 		if err != nil {
-			log.Fatalf("Failed to write message to Kafka: %s", err)
+			return "", nil, err
 		}
+		return fmt.Sprintf("SELECT * FROM %s.%s WHERE %s", pq.QuoteIdentifier(spec.Schema), pq.QuoteIdentifier(spec.Table), rawFilter), nil, nil
+	}
 
+	spec, err := d.sourceSpec(ctx, db, cursor)
+	if err != nil {
+		return "", nil, err
 	}
+	return spec.Compile()
+}
 
-	if rows.Err() != nil {
-		log.Fatalf("Error during row iteration: %v", rows.Err())
+// sourceSpec parses and validates the configured source spec.
+func (d *Postgres) sourceSpec(ctx context.Context, db *sql.DB, cursor *state.Cursor) (*SourceSpec, error) {
+	spec, err := ParseSourceSpec(d.Conf.Setting("source"), d.Conf.Setting("table"))
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(ctx, db); err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		if err := applyCursor(spec, cursor); err != nil {
+			return nil, err
+		}
 	}
-	fmt.Println("messages sent")
-	return nil
+	return spec, nil
 }
@@ -0,0 +1,337 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"retl/inputs/extract"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SourceSpec describes what the input reads. It is validated against
+// information_schema and compiled into a quoted, parameterized query, so
+// no user-provided text ends up in the SQL itself.
+type SourceSpec struct {
+	Schema  string    `json:"schema"`
+	Table   string    `json:"table"`
+	Columns []string  `json:"columns"`
+	Filters []Filter  `json:"filters"`
+	OrderBy []OrderBy `json:"order_by"`
+	Limit   int       `json:"limit"`
+
+	columns map[string]string
+	ordered []string
+}
+
+type Filter struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value"`
+	// Type is one of the keys of bindTypes. When empty the value is cast to
+	// the column's own type.
+	Type string `json:"type"`
+}
+
+type OrderBy struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+var operators = map[string]string{
+	"=":           "=",
+	"!=":          "<>",
+	"<":           "<",
+	"<=":          "<=",
+	">":           ">",
+	">=":          ">=",
+	"like":        "LIKE",
+	"ilike":       "ILIKE",
+	"in":          "= ANY",
+	"not_in":      "<> ALL",
+	"is_null":     "IS NULL",
+	"is_not_null": "IS NOT NULL",
+}
+
+var bindTypes = map[string]string{
+	"text":      "text",
+	"integer":   "bigint",
+	"numeric":   "numeric",
+	"boolean":   "boolean",
+	"timestamp": "timestamptz",
+	"date":      "date",
+	"uuid":      "uuid",
+}
+
+// ParseSourceSpec reads the spec from the "source" setting, falling back to
+// the legacy "table" setting, which may be schema-qualified.
+func ParseSourceSpec(source, table string) (*SourceSpec, error) {
+	spec := &SourceSpec{}
+	if source != "" {
+		if err := json.Unmarshal([]byte(source), spec); err != nil {
+			return nil, fmt.Errorf("invalid source spec: %v", err)
+		}
+	} else if schema, name, ok := strings.Cut(table, "."); ok {
+		spec.Schema, spec.Table = schema, name
+	} else {
+		spec.Table = table
+	}
+	if spec.Schema == "" {
+		spec.Schema = "public"
+	}
+	if spec.Table == "" {
+		return nil, fmt.Errorf("source spec is missing a table")
+	}
+	return spec, nil
+}
+
+// Validate checks that the table and every referenced column exist.
+func (s *SourceSpec) Validate(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT column_name, udt_name FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position`, s.Schema, s.Table)
+	if err != nil {
+		return fmt.Errorf("failed to look up columns of %s.%s: %v", s.Schema, s.Table, err)
+	}
+	defer rows.Close()
+
+	s.columns = make(map[string]string)
+	s.ordered = nil
+	for rows.Next() {
+		var name, udt string
+		if err := rows.Scan(&name, &udt); err != nil {
+			return err
+		}
+		s.columns[name] = udt
+		s.ordered = append(s.ordered, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(s.columns) == 0 {
+		return fmt.Errorf("table %s.%s does not exist or has no visible columns", s.Schema, s.Table)
+	}
+
+	for _, col := range s.Columns {
+		if err := s.checkColumn(col); err != nil {
+			return err
+		}
+	}
+	for _, f := range s.Filters {
+		if err := s.checkColumn(f.Column); err != nil {
+			return err
+		}
+		if _, ok := operators[f.Op]; !ok {
+			return fmt.Errorf("unsupported filter operator %q on column %q", f.Op, f.Column)
+		}
+		if _, ok := bindTypes[f.Type]; f.Type != "" && !ok {
+			return fmt.Errorf("unsupported filter type %q on column %q", f.Type, f.Column)
+		}
+	}
+	for _, o := range s.OrderBy {
+		if err := s.checkColumn(o.Column); err != nil {
+			return err
+		}
+	}
+	if s.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+func (s *SourceSpec) checkColumn(col string) error {
+	if _, ok := s.columns[col]; !ok {
+		return fmt.Errorf("column %q does not exist in %s.%s", col, s.Schema, s.Table)
+	}
+	return nil
+}
+
+// Compile renders the validated spec as a query and its bind arguments.
+func (s *SourceSpec) Compile() (string, []interface{}, error) {
+	return s.compile(nil)
+}
+
+// page selects one chunk of a keyset-paginated read: the rows of rng whose
+// key sorts after after, in key order.
+type page struct {
+	key   []string
+	rng   extract.Range
+	after []interface{}
+	limit int
+}
+
+// CompilePage renders one page of the spec, ordered by key instead of the
+// spec's own ordering.
+func (s *SourceSpec) CompilePage(key []string, rng extract.Range, after []interface{}, limit int) (string, []interface{}, error) {
+	return s.compile(&page{key: key, rng: rng, after: after, limit: limit})
+}
+
+func (s *SourceSpec) compile(pg *page) (string, []interface{}, error) {
+	if s.columns == nil {
+		return "", nil, fmt.Errorf("source spec must be validated before it is compiled")
+	}
+
+	columns := s.Columns
+	if len(columns) == 0 {
+		columns = s.ordered
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pq.QuoteIdentifier(col)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s FROM %s.%s", strings.Join(quoted, ", "), pq.QuoteIdentifier(s.Schema), pq.QuoteIdentifier(s.Table))
+
+	var args []interface{}
+	var conds []string
+	for _, f := range s.Filters {
+		cond, arg, err := s.condition(f, len(args)+1)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, cond)
+		if arg != nil {
+			args = append(args, arg)
+		}
+	}
+	orderBy, limit := s.OrderBy, s.Limit
+	if pg != nil {
+		conds, args = s.pageConditions(pg, conds, args)
+		orderBy, limit = nil, pg.limit
+		for _, col := range pg.key {
+			orderBy = append(orderBy, OrderBy{Column: col})
+		}
+	}
+	if len(conds) > 0 {
+		b.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	}
+
+	for i, o := range orderBy {
+		if i == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(pq.QuoteIdentifier(o.Column))
+		if o.Desc {
+			b.WriteString(" DESC")
+		}
+	}
+
+	if limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", limit)
+	}
+	return b.String(), args, nil
+}
+
+// pageConditions restricts the leading key column to the page's range and
+// compares the whole key against the last key of the previous page as a
+// row value, which Postgres can answer from a composite index.
+func (s *SourceSpec) pageConditions(pg *page, conds []string, args []interface{}) ([]string, []interface{}) {
+	lead := pq.QuoteIdentifier(pg.key[0])
+	if pg.rng.Lower != nil {
+		args = append(args, *pg.rng.Lower)
+		conds = append(conds, fmt.Sprintf("%s >= $%d::bigint", lead, len(args)))
+	}
+	if pg.rng.Upper != nil {
+		args = append(args, *pg.rng.Upper)
+		conds = append(conds, fmt.Sprintf("%s < $%d::bigint", lead, len(args)))
+	}
+	if pg.after != nil {
+		cols := make([]string, len(pg.key))
+		params := make([]string, len(pg.key))
+		for i, col := range pg.key {
+			args = append(args, textValue(pg.after[i]))
+			cols[i] = pq.QuoteIdentifier(col)
+			params[i] = fmt.Sprintf("$%d::%s", len(args), pq.QuoteIdentifier(s.columns[col]))
+		}
+		conds = append(conds, fmt.Sprintf("(%s) > (%s)", strings.Join(cols, ", "), strings.Join(params, ", ")))
+	}
+	return conds, args
+}
+
+func (s *SourceSpec) condition(f Filter, n int) (string, interface{}, error) {
+	col := pq.QuoteIdentifier(f.Column)
+	op := operators[f.Op]
+	switch f.Op {
+	case "is_null", "is_not_null":
+		return fmt.Sprintf("%s %s", col, op), nil, nil
+	}
+
+	castTo := pq.QuoteIdentifier(s.columns[f.Column])
+	if f.Type != "" {
+		castTo = bindTypes[f.Type]
+	}
+
+	switch f.Op {
+	case "in", "not_in":
+		values, ok := f.Value.([]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("filter %q on column %q expects a list", f.Op, f.Column)
+		}
+		strs := make([]string, len(values))
+		for i, v := range values {
+			bound, err := bindValue(f.Type, v)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid value for column %q: %v", f.Column, err)
+			}
+			strs[i] = textValue(bound)
+		}
+		return fmt.Sprintf("%s %s($%d::text[]::%s[])", col, op, n, castTo), pq.StringArray(strs), nil
+	}
+
+	bound, err := bindValue(f.Type, f.Value)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid value for column %q: %v", f.Column, err)
+	}
+	return fmt.Sprintf("%s %s $%d::%s", col, op, n, castTo), bound, nil
+}
+
+// bindValue converts a filter value to the Go type matching its declared
+// type, so malformed values are rejected before reaching the database.
+func bindValue(typ string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("value is required")
+	}
+	str := fmt.Sprintf("%v", v)
+	switch typ {
+	case "integer":
+		if f, ok := v.(float64); ok && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+		return strconv.ParseInt(str, 10, 64)
+	case "numeric":
+		if _, err := strconv.ParseFloat(str, 64); err != nil {
+			return nil, err
+		}
+		return str, nil
+	case "boolean":
+		return strconv.ParseBool(str)
+	case "timestamp":
+		return time.Parse(time.RFC3339, str)
+	case "date":
+		if _, err := time.Parse(time.DateOnly, str); err != nil {
+			return nil, err
+		}
+		return str, nil
+	case "uuid":
+		if _, err := uuid.Parse(str); err != nil {
+			return nil, err
+		}
+		return str, nil
+	}
+	return str, nil
+}
+
+func textValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,243 @@
+package postgrescdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// lsn is a position in the write-ahead log.
+type lsn uint64
+
+func (l lsn) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+func parseLSN(s string) (lsn, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid LSN %q: %v", s, err)
+	}
+	return lsn(uint64(hi)<<32 | uint64(lo)), nil
+}
+
+// relation describes a published table, as announced by the server before
+// the first change to it in each session.
+type relation struct {
+	namespace string
+	name      string
+	columns   []relationColumn
+}
+
+type relationColumn struct {
+	name    string
+	key     bool
+	typeOID uint32
+}
+
+func (r *relation) String() string {
+	return r.namespace + "." + r.name
+}
+
+// tupleColumn is one column of a row image. Kind is 'n' for NULL, 'u' for
+// an unchanged TOAST value that the server did not send, and 't' for text.
+type tupleColumn struct {
+	kind byte
+	data []byte
+}
+
+var errShortMessage = errors.New("truncated pgoutput message")
+
+// decoder reads the big-endian fields of a pgoutput message. The first
+// out-of-bounds read is remembered in err and later reads return zero.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = errShortMessage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	for i, c := range d.buf {
+		if c == 0 {
+			s := string(d.buf[:i])
+			d.buf = d.buf[i+1:]
+			return s
+		}
+	}
+	d.err = errShortMessage
+	return ""
+}
+
+func (d *decoder) relation() (uint32, *relation) {
+	id := d.uint32()
+	rel := &relation{namespace: d.string(), name: d.string()}
+	d.uint8() // replica identity setting
+	n := int(d.uint16())
+	for i := 0; i < n && d.err == nil; i++ {
+		flags := d.uint8()
+		rel.columns = append(rel.columns, relationColumn{
+			name:    d.string(),
+			key:     flags&1 != 0,
+			typeOID: d.uint32(),
+		})
+		d.uint32() // type modifier
+	}
+	return id, rel
+}
+
+func (d *decoder) tuple() []tupleColumn {
+	n := int(d.uint16())
+	tuple := make([]tupleColumn, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		col := tupleColumn{kind: d.uint8()}
+		if col.kind == 't' {
+			col.data = d.take(int(d.uint32()))
+		}
+		tuple = append(tuple, col)
+	}
+	return tuple
+}
+
+// Type OIDs of the built-in types that have a better JSON representation
+// than their text form.
+const (
+	boolOID        = 16
+	int8OID        = 20
+	int2OID        = 21
+	int4OID        = 23
+	oidOID         = 26
+	jsonOID        = 114
+	float4OID      = 700
+	float8OID      = 701
+	timestamptzOID = 1184
+	numericOID     = 1700
+	jsonbOID       = 3802
+)
+
+var timestamptzLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999-07:00:00",
+}
+
+// decodeText converts a column in the text output format of its type.
+// Values that cannot be converted are passed through as strings.
+func decodeText(typeOID uint32, data []byte) interface{} {
+	s := string(data)
+	switch typeOID {
+	case boolOID:
+		return s == "t"
+	case int2OID, int4OID, int8OID, oidOID:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case float4OID, float8OID:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case numericOID:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case jsonOID, jsonbOID:
+		if json.Valid(data) {
+			return json.RawMessage(s)
+		}
+	case timestamptzOID:
+		for _, layout := range timestamptzLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+	}
+	return s
+}
+
+// record maps the columns of a row image to their values, leaving out
+// unchanged TOAST values whose contents the server did not send.
+func (r *relation) record(tuple []tupleColumn) map[string]interface{} {
+	record := make(map[string]interface{}, len(tuple))
+	for i, col := range tuple {
+		if i >= len(r.columns) {
+			break
+		}
+		switch col.kind {
+		case 'n':
+			record[r.columns[i].name] = nil
+		case 't':
+			record[r.columns[i].name] = decodeText(r.columns[i].typeOID, col.data)
+		}
+	}
+	return record
+}
+
+// key returns the replica identity of a row image as a JSON array, the same
+// form the other inputs use for primary keys, along with the key columns
+// as a record. It returns an empty key for tables without a replica
+// identity.
+func (r *relation) key(tuple []tupleColumn) (string, map[string]interface{}, error) {
+	var values []interface{}
+	record := map[string]interface{}{}
+	for i, col := range r.columns {
+		if !col.key {
+			continue
+		}
+		var v interface{}
+		if i < len(tuple) && tuple[i].kind == 't' {
+			v = decodeText(col.typeOID, tuple[i].data)
+		}
+		values = append(values, v)
+		record[col.name] = v
+	}
+	if len(values) == 0 {
+		return "", record, nil
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(encoded), record, nil
+}
@@ -0,0 +1,191 @@
+package postgrescdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// message builds a pgoutput message from its fields: bytes are written as
+// they are, strings NUL-terminated, and integers big-endian by size.
+func message(fields ...interface{}) []byte {
+	var buf []byte
+	for _, f := range fields {
+		switch f := f.(type) {
+		case byte:
+			buf = append(buf, f)
+		case uint16:
+			buf = binary.BigEndian.AppendUint16(buf, f)
+		case uint32:
+			buf = binary.BigEndian.AppendUint32(buf, f)
+		case string:
+			buf = append(append(buf, f...), 0)
+		case []byte:
+			buf = append(buf, f...)
+		}
+	}
+	return buf
+}
+
+func text(s string) []byte {
+	return message(byte('t'), uint32(len(s)), []byte(s))
+}
+
+func TestDecodeRelation(t *testing.T) {
+	d := &decoder{buf: message(
+		uint32(16384), "public", "users", byte('d'), uint16(2),
+		byte(1), "id", uint32(int4OID), uint32(0xFFFFFFFF),
+		byte(0), "name", uint32(25), uint32(0xFFFFFFFF),
+	)}
+	id, rel := d.relation()
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	want := &relation{namespace: "public", name: "users", columns: []relationColumn{
+		{name: "id", key: true, typeOID: int4OID},
+		{name: "name", typeOID: 25},
+	}}
+	if id != 16384 || !reflect.DeepEqual(rel, want) {
+		t.Errorf("got %d %+v, want 16384 %+v", id, rel, want)
+	}
+}
+
+func TestDecodeTuple(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want []tupleColumn
+		err  error
+	}{
+		{
+			name: "text, null and unchanged",
+			buf:  message(uint16(3), text("42"), byte('n'), byte('u')),
+			want: []tupleColumn{{kind: 't', data: []byte("42")}, {kind: 'n'}, {kind: 'u'}},
+		},
+		{
+			name: "empty",
+			buf:  message(uint16(0)),
+			want: []tupleColumn{},
+		},
+		{
+			name: "truncated value",
+			buf:  message(uint16(1), byte('t'), uint32(10), []byte("abc")),
+			err:  errShortMessage,
+		},
+		{
+			name: "missing columns",
+			buf:  message(uint16(2), byte('n')),
+			err:  errShortMessage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &decoder{buf: tt.buf}
+			got := d.tuple()
+			if d.err != tt.err {
+				t.Fatalf("got error %v, want %v", d.err, tt.err)
+			}
+			if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		typeOID uint32
+		data    string
+		want    interface{}
+	}{
+		{boolOID, "t", true},
+		{boolOID, "f", false},
+		{int4OID, "-12", int64(-12)},
+		{int8OID, "9007199254740993", int64(9007199254740993)},
+		{float8OID, "1.5", 1.5},
+		{numericOID, "12345678901234567890.123", json.Number("12345678901234567890.123")},
+		{numericOID, "NaN", json.Number("NaN")},
+		{jsonbOID, `{"a": 1}`, json.RawMessage(`{"a": 1}`)},
+		{jsonOID, `{"a"`, `{"a"`},
+		{timestamptzOID, "2024-03-01 10:20:30.5+02", "2024-03-01T08:20:30.5Z"},
+		{timestamptzOID, "2024-03-01 10:20:30+05:30", "2024-03-01T04:50:30Z"},
+		{25, "hello", "hello"},
+		{int4OID, "not a number", "not a number"},
+	}
+	for _, tt := range tests {
+		if got := decodeText(tt.typeOID, []byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeText(%d, %q) = %#v, want %#v", tt.typeOID, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestRecordAndKey(t *testing.T) {
+	rel := &relation{namespace: "public", name: "users", columns: []relationColumn{
+		{name: "id", key: true, typeOID: int4OID},
+		{name: "bio", typeOID: 25},
+		{name: "email", typeOID: 25},
+	}}
+	tests := []struct {
+		name      string
+		tuple     []tupleColumn
+		record    map[string]interface{}
+		key       string
+		keyRecord map[string]interface{}
+	}{
+		{
+			name:      "full row",
+			tuple:     []tupleColumn{{kind: 't', data: []byte("7")}, {kind: 't', data: []byte("hi")}, {kind: 'n'}},
+			record:    map[string]interface{}{"id": int64(7), "bio": "hi", "email": nil},
+			key:       "[7]",
+			keyRecord: map[string]interface{}{"id": int64(7)},
+		},
+		{
+			name:      "unchanged TOAST value is left out",
+			tuple:     []tupleColumn{{kind: 't', data: []byte("7")}, {kind: 'u'}, {kind: 't', data: []byte("a@b.c")}},
+			record:    map[string]interface{}{"id": int64(7), "email": "a@b.c"},
+			key:       "[7]",
+			keyRecord: map[string]interface{}{"id": int64(7)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rel.record(tt.tuple); !reflect.DeepEqual(got, tt.record) {
+				t.Errorf("record = %#v, want %#v", got, tt.record)
+			}
+			key, keyRecord, err := rel.key(tt.tuple)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != tt.key || !reflect.DeepEqual(keyRecord, tt.keyRecord) {
+				t.Errorf("key = %s %#v, want %s %#v", key, keyRecord, tt.key, tt.keyRecord)
+			}
+		})
+	}
+
+	noKey := &relation{columns: []relationColumn{{name: "v", typeOID: 25}}}
+	if key, _, err := noKey.key([]tupleColumn{{kind: 't', data: []byte("x")}}); err != nil || key != "" {
+		t.Errorf("key of a table without replica identity = %q, %v", key, err)
+	}
+}
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want lsn
+		err  bool
+	}{
+		{in: "0/0", want: 0},
+		{in: "16/B374D848", want: lsn(0x16<<32 | 0xB374D848)},
+		{in: "garbage", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLSN(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseLSN(%q) = %v, %v", tt.in, got, err)
+		}
+		if err == nil && got.String() != tt.in {
+			t.Errorf("%v.String() = %s, want %s", got, got.String(), tt.in)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package postgrescdc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	retldb "retl/db"
+	"retl/envelope"
+	"retl/inputs/producer"
+	"retl/inputs/state"
+	"retl/inputs/types"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// LSNKey holds the last log position whose changes were acknowledged by
+// Kafka and confirmed to the server.
+const LSNKey = "cdc_lsn"
+
+// pgEpoch is the reference point of timestamps in the replication protocol.
+var pgEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// PostgresCDC streams row changes of the selected tables from a logical
+// replication slot. Unlike the other inputs it does not finish on its own;
+// it runs until the pod is asked to stop.
+type PostgresCDC struct {
+	Conf *types.ConfigType
+}
+
+func (c *PostgresCDC) Run() error {
+	pipelineID := os.Getenv("PIPELINE_NAME")
+	slot, publication := c.Conf.Setting("slot"), c.Conf.Setting("publication")
+	if slot == "" {
+		slot = defaultName(pipelineID)
+	}
+	if publication == "" {
+		publication = defaultName(pipelineID)
+	}
+	if !namePattern.MatchString(slot) || !namePattern.MatchString(publication) {
+		return fmt.Errorf("slot and publication names may only contain lower case letters, digits and underscores")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	dbClient, err := retldb.NewClient()
+	if err != nil {
+		return err
+	}
+	store := state.New(dbClient)
+
+	if c.Conf.Setting("cleanup") == "true" {
+		if err := dropSlot(ctx, conn, slot, publication); err != nil {
+			return err
+		}
+		log.Printf("dropped replication slot %s and publication %s", slot, publication)
+		return store.Delete(pipelineID, LSNKey)
+	}
+
+	tables, err := parseTables(c.Conf.Setting("tables"))
+	if err != nil {
+		return err
+	}
+	if err := ensurePublication(ctx, conn, publication, tables); err != nil {
+		return err
+	}
+	start, err := ensureSlot(ctx, conn, slot)
+	if err != nil {
+		return err
+	}
+	// The server never goes back before the slot's confirmed position, so
+	// the stored position only matters when it is further ahead.
+	if stored, ok, err := store.Get(pipelineID, LSNKey); err != nil {
+		return err
+	} else if ok {
+		pos, err := parseLSN(stored)
+		if err != nil {
+			return err
+		}
+		if pos > start {
+			start = pos
+		}
+	}
+
+	producer, err := producer.New(c.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	s := &stream{
+		conn:       conn,
+		producer:   producer,
+		store:      store,
+		pipelineID: pipelineID,
+		interval:   time.Duration(c.Conf.SettingInt("status_interval_ms", 10000)) * time.Millisecond,
+		relations:  map[uint32]*relation{},
+		confirmed:  start,
+		committed:  start,
+	}
+	log.Printf("starting replication from slot %s at %s", slot, start)
+	if err := s.start(ctx, slot, publication); err != nil {
+		return err
+	}
+	err = s.run(ctx)
+	if ctx.Err() != nil {
+		// Shutting down: make sure everything streamed so far is confirmed
+		// before the connection goes away.
+		return s.checkpoint(context.Background())
+	}
+	return err
+}
+
+// connect opens a replication connection, which can also run simple SQL
+// queries against the configured database.
+func (c *PostgresCDC) connect(ctx context.Context) (*pgconn.PgConn, error) {
+	config, err := pgconn.ParseConfig(c.Conf.Secret("url"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string: %v", err)
+	}
+	config.RuntimeParams["replication"] = "database"
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %v", err)
+	}
+	return conn, nil
+}
+
+// TestConnection checks that the user may open a replication connection,
+// which needs the REPLICATION attribute on top of normal access.
+func (c *PostgresCDC) TestConnection(ctx context.Context) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := query(ctx, conn, "IDENTIFY_SYSTEM"); err != nil {
+		return fmt.Errorf("replication is not available: %v", err)
+	}
+	return nil
+}
+
+// stream holds the replication session. Changes are handed to the producer
+// as they arrive; a transaction's commit position is only confirmed to the
+// server once the producer has flushed, so a restart replays anything Kafka
+// has not acknowledged.
+type stream struct {
+	conn       *pgconn.PgConn
+	producer   *producer.Producer
+	store      *state.Store
+	pipelineID string
+	interval   time.Duration
+	relations  map[uint32]*relation
+
+	inTx      bool
+	committed lsn // end of the last transaction handed to the producer
+	serverEnd lsn // position the server has sent everything up to
+	confirmed lsn // last position reported to the server
+}
+
+func (s *stream) start(ctx context.Context, slot, publication string) error {
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names '%s')", slot, s.confirmed, publication)
+	buf, err := (&pgproto3.Query{String: sql}).Encode(nil)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.SendBytes(ctx, buf); err != nil {
+		return fmt.Errorf("failed to start replication: %v", err)
+	}
+	for {
+		msg, err := s.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start replication: %v", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("failed to start replication: %v", pgconn.ErrorResponseToPgError(msg))
+		}
+	}
+}
+
+func (s *stream) run(ctx context.Context) error {
+	next := time.Now().Add(s.interval)
+	for {
+		if !time.Now().Before(next) {
+			if err := s.checkpoint(ctx); err != nil {
+				return err
+			}
+			next = time.Now().Add(s.interval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, next)
+		msg, err := s.conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("replication stream failed: %v", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if err := s.handle(ctx, msg.Data); err != nil {
+				return err
+			}
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("replication stream failed: %v", pgconn.ErrorResponseToPgError(msg))
+		case *pgproto3.CopyDone:
+			return fmt.Errorf("server ended the replication stream")
+		}
+	}
+}
+
+func (s *stream) handle(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	d := &decoder{buf: data[1:]}
+	switch data[0] {
+	case 'k': // primary keepalive
+		end := lsn(d.uint64())
+		d.uint64() // server clock
+		replyRequested := d.uint8() == 1
+		if d.err != nil {
+			return d.err
+		}
+		if end > s.serverEnd {
+			s.serverEnd = end
+		}
+		if replyRequested {
+			return s.sendStatus(ctx)
+		}
+	case 'w': // WAL data
+		// The header carries the server's end of WAL, which may be ahead of
+		// changes not sent yet, so only keepalives advance serverEnd.
+		d.take(24)
+		if d.err != nil {
+			return d.err
+		}
+		return s.decode(ctx, d.buf)
+	}
+	return nil
+}
+
+// decode handles one pgoutput message.
+func (s *stream) decode(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	d := &decoder{buf: data[1:]}
+	switch data[0] {
+	case 'B':
+		s.inTx = true
+	case 'C':
+		d.uint8()  // flags
+		d.uint64() // commit position
+		end := lsn(d.uint64())
+		if d.err != nil {
+			return d.err
+		}
+		s.committed = end
+		s.inTx = false
+	case 'R':
+		id, rel := d.relation()
+		if d.err != nil {
+			return d.err
+		}
+		s.relations[id] = rel
+	case 'I':
+		rel, err := s.relation(d.uint32())
+		if err != nil {
+			return err
+		}
+		d.uint8() // 'N'
+		tuple := d.tuple()
+		if d.err != nil {
+			return d.err
+		}
+		return s.upsert(ctx, rel, envelope.OpUpsert, "insert", tuple)
+	case 'U':
+		rel, err := s.relation(d.uint32())
+		if err != nil {
+			return err
+		}
+		// The old key is only sent when the key changed, and the old row
+		// when the replica identity is FULL.
+		var old []tupleColumn
+		kind := d.uint8()
+		if kind == 'K' || kind == 'O' {
+			old = d.tuple()
+			d.uint8() // 'N'
+		}
+		tuple := d.tuple()
+		if d.err != nil {
+			return d.err
+		}
+		return s.update(ctx, rel, old, kind == 'O', tuple)
+	case 'D':
+		rel, err := s.relation(d.uint32())
+		if err != nil {
+			return err
+		}
+		d.uint8() // 'K' or 'O'
+		tuple := d.tuple()
+		if d.err != nil {
+			return d.err
+		}
+		return s.delete(ctx, rel, tuple)
+	case 'T':
+		log.Printf("ignoring TRUNCATE of %d published tables", d.uint32())
+	}
+	return nil
+}
+
+func (s *stream) relation(id uint32) (*relation, error) {
+	rel, ok := s.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("change for unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+func (s *stream) upsert(ctx context.Context, rel *relation, op, change string, tuple []tupleColumn) error {
+	key, _, err := rel.key(tuple)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(rel.record(tuple))
+	if err != nil {
+		return err
+	}
+	return s.producer.Write(ctx, s.message(op, change, rel, key, value))
+}
+
+// update writes the new row image of an update. When the key changed, the
+// row under the old key is deleted first so the destination does not keep
+// it. Unchanged TOAST values are not sent; they are taken from the old
+// row when the replica identity is FULL, and otherwise the record is a
+// patch that leaves those fields as they are in the destination.
+func (s *stream) update(ctx context.Context, rel *relation, old []tupleColumn, full bool, tuple []tupleColumn) error {
+	if full {
+		for i := range tuple {
+			if tuple[i].kind == 'u' && i < len(old) {
+				tuple[i] = old[i]
+			}
+		}
+	}
+	if old != nil {
+		oldKey, _, err := rel.key(old)
+		if err != nil {
+			return err
+		}
+		newKey, _, err := rel.key(tuple)
+		if err != nil {
+			return err
+		}
+		if oldKey != newKey {
+			if err := s.delete(ctx, rel, old); err != nil {
+				return err
+			}
+		}
+	}
+	op := envelope.OpUpsert
+	for _, col := range tuple {
+		if col.kind == 'u' {
+			op = envelope.OpPatch
+			break
+		}
+	}
+	return s.upsert(ctx, rel, op, "update", tuple)
+}
+
+func (s *stream) delete(ctx context.Context, rel *relation, tuple []tupleColumn) error {
+	key, record, err := rel.key(tuple)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		log.Printf("skipping delete from %s: table has no replica identity", rel)
+		return nil
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.producer.Write(ctx, s.message(envelope.OpDelete, "delete", rel, key, value))
+}
+
+func (s *stream) message(op, change string, rel *relation, key string, value []byte) kafka.Message {
+	msg := envelope.New(s.pipelineID, op, key, value)
+	msg.Headers = append(msg.Headers,
+		kafka.Header{Key: envelope.TableHeader, Value: []byte(rel.String())},
+		kafka.Header{Key: envelope.ChangeHeader, Value: []byte(change)},
+	)
+	return msg
+}
+
+// checkpoint waits for Kafka to acknowledge everything streamed so far and
+// then confirms it to the server and the state store. Outside a
+// transaction the server's keepalive position is confirmed too, so WAL
+// written for unpublished tables does not pile up behind the slot.
+func (s *stream) checkpoint(ctx context.Context) error {
+	if err := s.producer.Flush(ctx); err != nil {
+		return err
+	}
+	pos := s.committed
+	if !s.inTx && s.serverEnd > pos {
+		pos = s.serverEnd
+	}
+	if pos > s.confirmed {
+		if err := s.store.Set(s.pipelineID, LSNKey, pos.String()); err != nil {
+			return err
+		}
+		s.confirmed = pos
+	}
+	return s.sendStatus(ctx)
+}
+
+// sendStatus reports the confirmed position as written, flushed and
+// applied.
+func (s *stream) sendStatus(ctx context.Context) error {
+	data := []byte{'r'}
+	for i := 0; i < 3; i++ {
+		data = binary.BigEndian.AppendUint64(data, uint64(s.confirmed))
+	}
+	data = binary.BigEndian.AppendUint64(data, uint64(time.Since(pgEpoch).Microseconds()))
+	data = append(data, 0)
+
+	buf, err := (&pgproto3.CopyData{Data: data}).Encode(nil)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.SendBytes(ctx, buf); err != nil {
+		return fmt.Errorf("failed to send standby status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package postgrescdc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// defaultName derives a slot or publication name from the pipeline id.
+// Replication slot names may only contain lower case letters, digits and
+// underscores.
+func defaultName(pipelineID string) string {
+	name := "retl_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, pipelineID)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// parseTables turns a comma separated list of tables, optionally qualified
+// with a schema, into quoted identifiers.
+func parseTables(setting string) ([]string, error) {
+	var tables []string
+	for _, t := range strings.Split(setting, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		schema, table := "public", t
+		if i := strings.Index(t, "."); i >= 0 {
+			schema, table = t[:i], t[i+1:]
+		}
+		if schema == "" || table == "" {
+			return nil, fmt.Errorf("invalid table %q", t)
+		}
+		tables = append(tables, pq.QuoteIdentifier(schema)+"."+pq.QuoteIdentifier(table))
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables selected for change data capture")
+	}
+	return tables, nil
+}
+
+// query runs a simple query on the replication connection and returns the
+// rows of its last result.
+func query(ctx context.Context, conn *pgconn.PgConn, sql string) ([][][]byte, error) {
+	results, err := conn.Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[len(results)-1].Rows, nil
+}
+
+// ensurePublication creates the publication for the selected tables, or
+// brings the table list of an existing one up to date.
+func ensurePublication(ctx context.Context, conn *pgconn.PgConn, name string, tables []string) error {
+	rows, err := query(ctx, conn, fmt.Sprintf("SELECT 1 FROM pg_publication WHERE pubname = '%s'", name))
+	if err != nil {
+		return fmt.Errorf("failed to look up publication %s: %v", name, err)
+	}
+	stmt := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", name, strings.Join(tables, ", "))
+	if len(rows) > 0 {
+		stmt = fmt.Sprintf("ALTER PUBLICATION %s SET TABLE %s", name, strings.Join(tables, ", "))
+	}
+	if _, err := query(ctx, conn, stmt); err != nil {
+		return fmt.Errorf("failed to set up publication %s: %v", name, err)
+	}
+	return nil
+}
+
+// ensureSlot creates the replication slot if it does not exist yet and
+// returns the position up to which the server considers changes consumed.
+func ensureSlot(ctx context.Context, conn *pgconn.PgConn, name string) (lsn, error) {
+	rows, err := query(ctx, conn, fmt.Sprintf("SELECT plugin, confirmed_flush_lsn FROM pg_replication_slots WHERE slot_name = '%s'", name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up replication slot %s: %v", name, err)
+	}
+	if len(rows) > 0 {
+		if plugin := string(rows[0][0]); plugin != "pgoutput" {
+			return 0, fmt.Errorf("replication slot %s uses the %s plugin, not pgoutput", name, plugin)
+		}
+		if rows[0][1] == nil {
+			return 0, nil
+		}
+		return parseLSN(string(rows[0][1]))
+	}
+
+	rows, err = query(ctx, conn, fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput", name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create replication slot %s: %v", name, err)
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return 0, fmt.Errorf("unexpected response creating replication slot %s", name)
+	}
+	return parseLSN(string(rows[0][1]))
+}
+
+// dropSlot removes the replication slot and publication so the server
+// stops retaining WAL for the pipeline.
+func dropSlot(ctx context.Context, conn *pgconn.PgConn, slot, publication string) error {
+	rows, err := query(ctx, conn, fmt.Sprintf("SELECT 1 FROM pg_replication_slots WHERE slot_name = '%s'", slot))
+	if err != nil {
+		return fmt.Errorf("failed to look up replication slot %s: %v", slot, err)
+	}
+	if len(rows) > 0 {
+		if _, err := query(ctx, conn, fmt.Sprintf("DROP_REPLICATION_SLOT %s", slot)); err != nil {
+			return fmt.Errorf("failed to drop replication slot %s: %v", slot, err)
+		}
+	}
+	if _, err := query(ctx, conn, fmt.Sprintf("DROP PUBLICATION IF EXISTS %s", publication)); err != nil {
+		return fmt.Errorf("failed to drop publication %s: %v", publication, err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package producer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"retl/inputs/types"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	brokerAddress = "kafka-297becac-sjsu-f7b6.k.aivencloud.com:11921"
+	topic         = "aneesh_2"
+)
+
+// Producer batches rows onto the pipeline topic asynchronously. At most
+// max_in_flight messages are handed to the writer without having been
+// acknowledged by the broker, so a fast source cannot buffer the whole
+// extract in memory.
+type Producer struct {
+	writer   *kafka.Writer
+	inFlight chan struct{}
+	// drop lists fields left out of every record, such as columns added
+	// to the source that the pipeline's schema drift policy ignores.
+	drop []string
+
+	mu  sync.Mutex
+	err error
+}
+
+func New(conf *types.ConfigType) (*Producer, error) {
+	tlsConfig, err := loadTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	compression := kafka.Snappy
+	if c := conf.Setting("compression"); c != "" {
+		if err := compression.UnmarshalText([]byte(c)); err != nil {
+			return nil, fmt.Errorf("invalid compression %q: %v", c, err)
+		}
+	}
+
+	maxInFlight := conf.SettingInt("max_in_flight", 10000)
+	if maxInFlight < 1 {
+		return nil, fmt.Errorf("invalid max in flight %d, expected at least 1", maxInFlight)
+	}
+	p := &Producer{
+		inFlight: make(chan struct{}, maxInFlight),
+	}
+	if drop := conf.Setting("drop_fields"); drop != "" {
+		p.drop = strings.Split(drop, ",")
+	}
+	p.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokerAddress),
+		Topic:        topic,
+		BatchSize:    conf.SettingInt("batch_size", 500),
+		BatchBytes:   int64(conf.SettingInt("batch_bytes", 1<<20)),
+		BatchTimeout: time.Duration(conf.SettingInt("linger_ms", 50)) * time.Millisecond,
+		Compression:  compression,
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		Completion:   p.complete,
+		Transport: &kafka.Transport{
+			DialTimeout: 10 * time.Second,
+			TLS:         tlsConfig,
+		},
+	}
+	return p, nil
+}
+
+func loadTLS() (*tls.Config, error) {
+	keypair, err := tls.LoadX509KeyPair("service.cert", "service.key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Access Key and/or Access Certificate: %v", err)
+	}
+
+	caCert, err := os.ReadFile("ca.pem")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA Certificate file: %v", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA Certificate file")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{keypair},
+		RootCAs:      caCertPool,
+	}, nil
+}
+
+// Write queues msgs for delivery, blocking while the in-flight window is
+// full. Calls with more messages than the window are written in windows,
+// each waiting for room left by the ones before. It returns the first
+// delivery error reported by the broker so far.
+func (p *Producer) Write(ctx context.Context, msgs ...kafka.Message) error {
+	if len(p.drop) > 0 {
+		for i := range msgs {
+			value, err := p.dropFields(msgs[i].Value)
+			if err != nil {
+				return err
+			}
+			msgs[i].Value = value
+		}
+	}
+	for len(msgs) > 0 {
+		n := min(len(msgs), cap(p.inFlight))
+		for i := 0; i < n; i++ {
+			select {
+			case p.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				p.release(i)
+				return ctx.Err()
+			}
+		}
+		if err := p.writer.WriteMessages(ctx, msgs[:n]...); err != nil {
+			p.release(n)
+			return err
+		}
+		msgs = msgs[n:]
+	}
+	return p.Err()
+}
+
+// dropFields removes the dropped fields from a record. Values that are not
+// JSON objects, such as the empty values of deletes, are kept as they are.
+func (p *Producer) dropFields(value []byte) ([]byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(value, &record); err != nil || record == nil {
+		return value, nil
+	}
+	for _, field := range p.drop {
+		delete(record, field)
+	}
+	return json.Marshal(record)
+}
+
+// Batch tracks the delivery of a group of messages, so a caller can wait
+// for them without flushing everything else in flight.
+type Batch struct {
+	// done is closed once the last message has been acknowledged.
+	done chan struct{}
+
+	mu      sync.Mutex
+	pending int
+	err     error
+}
+
+// WriteBatch queues msgs like Write and returns a Batch that completes once
+// all of them have been acknowledged.
+func (p *Producer) WriteBatch(ctx context.Context, msgs ...kafka.Message) (*Batch, error) {
+	b := newBatch(len(msgs))
+	for i := range msgs {
+		msgs[i].WriterData = b
+	}
+	if err := p.Write(ctx, msgs...); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newBatch(n int) *Batch {
+	b := &Batch{done: make(chan struct{}), pending: n}
+	if n == 0 {
+		close(b.done)
+	}
+	return b
+}
+
+// Wait blocks until every message of the batch has been acknowledged and
+// returns the first delivery error among them.
+func (b *Batch) Wait(ctx context.Context) error {
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// ack records the delivery of one of the batch's messages.
+func (b *Batch) ack(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	if b.pending--; b.pending == 0 {
+		close(b.done)
+	}
+}
+
+func (p *Producer) complete(messages []kafka.Message, err error) {
+	for _, msg := range messages {
+		if b, ok := msg.WriterData.(*Batch); ok {
+			b.ack(err)
+		}
+	}
+	if err != nil {
+		p.mu.Lock()
+		if p.err == nil {
+			p.err = fmt.Errorf("failed to write %d messages to Kafka: %v", len(messages), err)
+		}
+		p.mu.Unlock()
+	}
+	p.release(len(messages))
+}
+
+func (p *Producer) release(n int) {
+	for i := 0; i < n; i++ {
+		<-p.inFlight
+	}
+}
+
+func (p *Producer) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Flush blocks until every message handed to Write so far has been
+// acknowledged by the broker, and returns the first delivery error. It must
+// not be called concurrently with Write.
+func (p *Producer) Flush(ctx context.Context) error {
+	for i := 0; i < cap(p.inFlight); i++ {
+		select {
+		case p.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			p.release(i)
+			return ctx.Err()
+		}
+	}
+	p.release(cap(p.inFlight))
+	return p.Err()
+}
+
+// Close flushes any pending batches and waits for them to be acknowledged.
+func (p *Producer) Close() error {
+	if err := p.writer.Close(); err != nil {
+		return err
+	}
+	return p.Err()
+}
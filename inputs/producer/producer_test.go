@@ -0,0 +1,37 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestBatchWait(t *testing.T) {
+	p := &Producer{inFlight: make(chan struct{}, 3)}
+	b := newBatch(2)
+	msgs := []kafka.Message{{WriterData: b}, {WriterData: b}, {}}
+	for range msgs {
+		p.inFlight <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait on a cancelled context = %v", err)
+	}
+
+	failed := errors.New("broker down")
+	p.complete(msgs[:1], failed)
+	p.complete(msgs[1:], nil)
+	if err := b.Wait(context.Background()); err != failed {
+		t.Errorf("Wait = %v, want the first delivery error", err)
+	}
+	if len(p.inFlight) != 0 {
+		t.Errorf("%d messages still in flight", len(p.inFlight))
+	}
+	if err := newBatch(0).Wait(context.Background()); err != nil {
+		t.Errorf("Wait on an empty batch = %v", err)
+	}
+}
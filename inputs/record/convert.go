@@ -0,0 +1,26 @@
+package record
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Decimal renders an unscaled value with the given scale as an exact
+// decimal literal, or as a string when asString is set.
+func Decimal(unscaled *big.Int, scale int, asString bool) interface{} {
+	text := new(big.Rat).SetFrac(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(scale)
+	if asString {
+		return text
+	}
+	return json.Number(text)
+}
+
+// Float keeps NaN and infinities, which JSON cannot hold, as text.
+func Float(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
@@ -0,0 +1,62 @@
+package record
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"retl/inputs/types"
+)
+
+// LimitQuery wraps query so that it returns at most n rows, in the syntax
+// most databases share.
+func LimitQuery(query string, n int) string {
+	query = strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+	return fmt.Sprintf("SELECT * FROM (%s) AS preview LIMIT %d", query, n)
+}
+
+// Columns describes the columns of rows under the names a run gives them.
+// Columns whose nullability the driver does not report are nullable.
+func Columns(rows *sql.Rows, names []string) ([]types.Column, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]types.Column, len(columnTypes))
+	for i, t := range columnTypes {
+		nullable, ok := t.Nullable()
+		columns[i] = types.Column{Name: names[i], Type: t.DatabaseTypeName(), Nullable: nullable || !ok}
+	}
+	return columns, nil
+}
+
+// Sample encodes a row like Encode and adds it to p instead of writing it.
+func (w *Writer) Sample(p *types.Preview, row map[string]interface{}) error {
+	msg, ok, err := w.Encode(row)
+	if err != nil || !ok {
+		return err
+	}
+	p.Rows = append(p.Rows, msg.Value)
+	return nil
+}
+
+// Preview reads at most limit rows of rows, scanned with Scan, and returns
+// them with their columns without writing anything.
+func (w *Writer) Preview(rows *sql.Rows, columns []string, convert Convert, limit int) (*types.Preview, error) {
+	cols, err := Columns(rows, columns)
+	if err != nil {
+		return nil, err
+	}
+	p := &types.Preview{Columns: cols, Rows: []json.RawMessage{}}
+	for len(p.Rows) < limit && rows.Next() {
+		row, err := Scan(rows, columns, convert)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.Sample(p, row); err != nil {
+			return nil, err
+		}
+	}
+	return p, rows.Err()
+}
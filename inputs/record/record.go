@@ -0,0 +1,123 @@
+package record
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"retl/envelope"
+	"retl/inputs/diff"
+	"retl/inputs/producer"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Convert turns the scanned value of the i-th column into its JSON
+// representation.
+type Convert func(i int, v interface{}) (interface{}, error)
+
+// Scan reads the current row of rows into a map keyed by columns. Values
+// go through convert when it is set; otherwise byte slices become strings.
+func Scan(rows *sql.Rows, columns []string, convert Convert) (map[string]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, fmt.Errorf("error scanning row: %v", err)
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		v := values[i]
+		if convert != nil {
+			var err error
+			if v, err = convert(i, v); err != nil {
+				return nil, err
+			}
+		} else if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		row[col] = v
+	}
+	return row, nil
+}
+
+// Writer encodes the rows of a run and writes them to Kafka.
+type Writer struct {
+	Producer   *producer.Producer
+	PipelineID string
+	// Differ, when set, drops rows unchanged since the last run and wraps
+	// the others in upsert envelopes.
+	Differ *diff.Differ
+	// Observe, when set, sees every row before it is encoded, e.g. to
+	// track the high-water mark of an incremental sync.
+	Observe func(row map[string]interface{})
+}
+
+// Encode turns a row into its message. ok is false when change detection
+// found the row unchanged since the last run.
+func (w *Writer) Encode(row map[string]interface{}) (kafka.Message, bool, error) {
+	if w.Observe != nil {
+		w.Observe(row)
+	}
+	value, err := json.Marshal(row)
+	if err != nil {
+		return kafka.Message{}, false, fmt.Errorf("failed to marshal row to JSON: %v", err)
+	}
+	if w.Differ == nil {
+		return kafka.Message{Key: []byte(w.PipelineID), Value: value}, true, nil
+	}
+	key, changed, err := w.Differ.Compare(row)
+	if err != nil || !changed {
+		return kafka.Message{}, false, err
+	}
+	return envelope.New(w.PipelineID, envelope.OpUpsert, key, value), true, nil
+}
+
+// Messages encodes a page of rows, leaving out the unchanged ones. It
+// fits extract.Extractor's Messages.
+func (w *Writer) Messages(rows []map[string]interface{}) ([]kafka.Message, error) {
+	msgs := make([]kafka.Message, 0, len(rows))
+	for _, row := range rows {
+		msg, ok, err := w.Encode(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+// Write encodes a row and writes it to Kafka.
+func (w *Writer) Write(ctx context.Context, row map[string]interface{}) error {
+	msg, ok, err := w.Encode(row)
+	if err != nil || !ok {
+		return err
+	}
+	if err := w.Producer.Write(ctx, msg); err != nil {
+		return fmt.Errorf("failed to write message to Kafka: %v", err)
+	}
+	return nil
+}
+
+// Copy writes every remaining row of rows, scanned with Scan.
+func (w *Writer) Copy(ctx context.Context, rows *sql.Rows, columns []string, convert Convert) error {
+	for rows.Next() {
+		row, err := Scan(rows, columns, convert)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(ctx, row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during row iteration: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package redshift
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+func (r *Redshift) TestConnection(ctx context.Context) error {
+	db, err := sql.Open("postgres", r.Conf.Secret("url"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to Redshift: %v", err)
+	}
+	return nil
+}
+
+// Schemas lists the schemas visible to the user, leaving out the system
+// catalogs.
+func (r *Redshift) Schemas(ctx context.Context) ([]string, error) {
+	return r.list(ctx, `SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name NOT IN ('pg_catalog', 'information_schema', 'pg_internal', 'pg_automv', 'pg_auto_copy')
+		AND schema_name NOT LIKE 'pg_toast%' ORDER BY schema_name`)
+}
+
+func (r *Redshift) Tables(ctx context.Context, schema string) ([]string, error) {
+	return r.list(ctx, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = $1 ORDER BY table_name`, schema)
+}
+
+func (r *Redshift) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	db, err := sql.Open("postgres", r.Conf.Secret("url"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT column_name, data_type, is_nullable FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up columns of %s.%s: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []types.Column
+	for rows.Next() {
+		var col types.Column
+		var nullable string
+		if err := rows.Scan(&col.Name, &col.Type, &nullable); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func (r *Redshift) list(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	db, err := sql.Open("postgres", r.Conf.Secret("url"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Preview reads the first rows of the configured query or table over the
+// connection, whether or not runs unload.
+func (r *Redshift) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	query, err := r.buildQuery()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", r.Conf.Secret("url"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, record.LimitQuery(query, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Redshift query: %v", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	return (&record.Writer{}).Preview(rows, columns, nil, limit)
+}
@@ -0,0 +1,92 @@
+package redshift
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"retl/inputs/producer"
+	"retl/inputs/record"
+	"retl/inputs/types"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Redshift reads a table or a query from Amazon Redshift. Small results
+// are read over the connection; large ones can be unloaded to S3 by the
+// cluster and read back from there.
+type Redshift struct {
+	Conf *types.ConfigType
+}
+
+func (r *Redshift) Run() error {
+	producer, err := producer.New(r.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	db, err := sql.Open("postgres", r.Conf.Secret("url"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query, err := r.buildQuery()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	w := &record.Writer{Producer: producer, PipelineID: os.Getenv("PIPELINE_NAME")}
+	var files *unloadFiles
+	if r.Conf.Setting("unload") == "true" {
+		files, err = r.unload(ctx, db, w, query)
+	} else {
+		err = r.extractAll(ctx, db, w, query)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := producer.Close(); err != nil {
+		return err
+	}
+	if files != nil {
+		// The files are a full copy of the result, so they are only kept
+		// until every row has been delivered.
+		return files.remove(ctx)
+	}
+	return nil
+}
+
+// extractAll reads the result over the connection.
+func (r *Redshift) extractAll(ctx context.Context, db *sql.DB, w *record.Writer, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to run Redshift query: %v", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	return w.Copy(ctx, rows, columns, nil)
+}
+
+// buildQuery returns the configured query, or selects the configured
+// table, which may be qualified with its schema.
+func (r *Redshift) buildQuery() (string, error) {
+	if query := r.Conf.Setting("query"); query != "" {
+		return query, nil
+	}
+	table := r.Conf.Setting("table")
+	if table == "" {
+		return "", fmt.Errorf("redshift input needs either a table or a query")
+	}
+	var parts []string
+	for _, part := range strings.Split(table, ".") {
+		parts = append(parts, pq.QuoteIdentifier(part))
+	}
+	return "SELECT * FROM " + strings.Join(parts, "."), nil
+}
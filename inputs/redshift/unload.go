@@ -0,0 +1,151 @@
+package redshift
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"retl/inputs/record"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// unloadFiles are the objects an UNLOAD wrote for a run.
+type unloadFiles struct {
+	client *s3.Client
+	bucket string
+	keys   []string
+}
+
+// unload has the cluster write the result to S3 as JSON lines, in parallel
+// slices, and then reads the files listed in the manifest back in order.
+// Each run unloads under its own prefix, which a retry of the run
+// overwrites.
+func (r *Redshift) unload(ctx context.Context, db *sql.DB, w *record.Writer, query string) (*unloadFiles, error) {
+	location, err := url.Parse(strings.TrimRight(r.Conf.Setting("unload_path"), "/"))
+	if err != nil || location.Scheme != "s3" || location.Host == "" {
+		return nil, fmt.Errorf("unload needs an s3://bucket/prefix unload path")
+	}
+	role := r.Conf.Setting("unload_iam_role")
+	if role == "" {
+		return nil, fmt.Errorf("unload needs an IAM role the cluster can write to S3 with")
+	}
+	run := os.Getenv("RUN_ID")
+	if run == "" {
+		run = time.Now().UTC().Format("20060102T150405Z")
+	}
+	prefix := strings.TrimPrefix(fmt.Sprintf("%s/%s/%s/", location.Path, w.PipelineID, run), "/")
+
+	statement := fmt.Sprintf("UNLOAD (%s) TO %s IAM_ROLE %s FORMAT JSON MANIFEST ALLOWOVERWRITE",
+		quoteLiteral(query), quoteLiteral("s3://"+location.Host+"/"+prefix), quoteLiteral(role))
+	if _, err := db.ExecContext(ctx, statement); err != nil {
+		return nil, fmt.Errorf("failed to unload Redshift query: %v", err)
+	}
+
+	files := &unloadFiles{client: r.s3Client(), bucket: location.Host}
+	manifestKey := prefix + "manifest"
+	files.keys = append(files.keys, manifestKey)
+	var manifest struct {
+		Entries []struct {
+			URL string `json:"url"`
+		} `json:"entries"`
+	}
+	if err := files.read(ctx, manifestKey, func(d *json.Decoder) error { return d.Decode(&manifest) }); err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Entries {
+		u, err := url.Parse(entry.URL)
+		if err != nil || u.Host != files.bucket {
+			return nil, fmt.Errorf("unexpected file %q in unload manifest", entry.URL)
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		files.keys = append(files.keys, key)
+		err = files.read(ctx, key, func(d *json.Decoder) error {
+			for {
+				var row map[string]interface{}
+				if err := d.Decode(&row); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if err := w.Write(ctx, row); err != nil {
+					return err
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (f *unloadFiles) read(ctx context.Context, key string, decode func(*json.Decoder) error) error {
+	out, err := f.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(f.bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to read s3://%s/%s: %v", f.bucket, key, err)
+	}
+	defer out.Body.Close()
+	decoder := json.NewDecoder(out.Body)
+	decoder.UseNumber()
+	if err := decode(decoder); err != nil {
+		return fmt.Errorf("failed to read s3://%s/%s: %v", f.bucket, key, err)
+	}
+	return nil
+}
+
+// remove deletes the unloaded files, in batches of the most S3 accepts.
+func (f *unloadFiles) remove(ctx context.Context) error {
+	for start := 0; start < len(f.keys); start += 1000 {
+		end := start + 1000
+		if end > len(f.keys) {
+			end = len(f.keys)
+		}
+		var objects []types.ObjectIdentifier
+		for _, key := range f.keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := f.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(f.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete unloaded files: %v", err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("failed to delete unloaded file %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
+// s3Client connects to S3, or to the S3 compatible store at the configured
+// endpoint, such as MinIO.
+func (r *Redshift) s3Client() *s3.Client {
+	options := s3.Options{
+		Region: r.Conf.Setting("aws_region"),
+	}
+	if key := r.Conf.Secret("aws_access_key_id"); key != "" {
+		options.Credentials = credentials.NewStaticCredentialsProvider(key, r.Conf.Secret("aws_secret_access_key"), "")
+	}
+	if endpoint := r.Conf.Setting("s3_endpoint"); endpoint != "" {
+		options.BaseEndpoint = aws.String(endpoint)
+		options.UsePathStyle = true
+	}
+	return s3.New(options)
+}
+
+// quoteLiteral quotes s as a string literal. Redshift expects the query of
+// an UNLOAD as one, with its own quotes doubled.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
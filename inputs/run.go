@@ -1,46 +1,384 @@
 package inputs
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"os"
+	retldb "retl/db"
+	"retl/inputs/bigquery"
+	"retl/inputs/clickhouse"
+	"retl/inputs/databricks"
+	"retl/inputs/drift"
+	"retl/inputs/duckdb"
+	"retl/inputs/files"
+	"retl/inputs/mysql"
 	"retl/inputs/postgres"
+	"retl/inputs/postgrescdc"
+	"retl/inputs/redshift"
 	"retl/inputs/snowflake"
+	"retl/inputs/sqlsource"
 	"retl/inputs/types"
+	"sort"
+	"strings"
+	"time"
 )
 
+func producerSettings(getenv func(string) string, settings map[string]interface{}) map[string]interface{} {
+	settings["batch_size"] = getenv("KAFKA_BATCH_SIZE")
+	settings["batch_bytes"] = getenv("KAFKA_BATCH_BYTES")
+	settings["linger_ms"] = getenv("KAFKA_LINGER_MS")
+	settings["compression"] = getenv("KAFKA_COMPRESSION")
+	settings["max_in_flight"] = getenv("KAFKA_MAX_IN_FLIGHT")
+	settings["drop_fields"] = getenv(dropFieldsKey)
+	return settings
+}
 
-
-func Start() {
+// New builds the named input, reading its configuration through getenv.
+// Pods pass os.Getenv; the API passes a lookup into a stored input config,
+// whose keys are the same variable names.
+func New(name string, getenv func(string) string) (Input, error) {
 	var inputs map[string]Input = map[string]Input{
 		"snowflake": &snowflake.Snowflake{
 			Conf: &types.ConfigType{
-				Settings: map[string]interface{}{
-					"org": os.Getenv("SNOWFLAKE_ORG"),
-					"acc": os.Getenv("SNOWFLAKE_ACC"),
-					"db": os.Getenv("SNOWFLAKE_DB"),
-					"wh": os.Getenv("SNOWFLAKE_WH"),
-				},
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"org":                 getenv("SNOWFLAKE_ORG"),
+					"acc":                 getenv("SNOWFLAKE_ACC"),
+					"db":                  getenv("SNOWFLAKE_DB"),
+					"wh":                  getenv("SNOWFLAKE_WH"),
+					"schema":              getenv("SNOWFLAKE_SCHEMA"),
+					"role":                getenv("SNOWFLAKE_ROLE"),
+					"table":               getenv("SNOWFLAKE_TABLE"),
+					"query":               getenv("SNOWFLAKE_QUERY"),
+					"statement_timeout":   getenv("SNOWFLAKE_STATEMENT_TIMEOUT"),
+					"column_case":         getenv("SNOWFLAKE_COLUMN_CASE"),
+					"decimals_as_strings": getenv("SNOWFLAKE_DECIMALS_AS_STRINGS"),
+					"account":             getenv("SNOWFLAKE_ACCOUNT"),
+					"region":              getenv("SNOWFLAKE_REGION"),
+					"auth":                getenv("SNOWFLAKE_AUTH"),
+					"primary_key":         getenv("SNOWFLAKE_PRIMARY_KEY"),
+					"diff":                getenv("SNOWFLAKE_DIFF"),
+					"chunk_size":          getenv("SNOWFLAKE_CHUNK_SIZE"),
+					"parallelism":         getenv("SNOWFLAKE_PARALLELISM"),
+				}),
 				Secrets: map[string]interface{}{
-					"username": os.Getenv("SNOWFLAKE_USERNAME"),
-					"password": os.Getenv("SNOWFLAKE_PASSWORD"),
+					"username":               getenv("SNOWFLAKE_USERNAME"),
+					"password":               getenv("SNOWFLAKE_PASSWORD"),
+					"private_key":            getenv("SNOWFLAKE_PRIVATE_KEY"),
+					"private_key_passphrase": getenv("SNOWFLAKE_PRIVATE_KEY_PASSPHRASE"),
+					"oauth_token":            getenv("SNOWFLAKE_OAUTH_TOKEN"),
 				},
 			},
 		},
 		"postgres": &postgres.Postgres{
 			Conf: &types.ConfigType{
-				Settings: map[string]interface{}{
-					"table": os.Getenv("POSTGRES_TABLE"),
-					"filter": os.Getenv("POSTGRES_FILTER"),
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"table":           getenv("POSTGRES_TABLE"),
+					"filter":          getenv("POSTGRES_FILTER"),
+					"source":          getenv("POSTGRES_SOURCE"),
+					"query":           getenv("POSTGRES_QUERY"),
+					"allow_sql":       getenv("POSTGRES_ALLOW_SQL"),
+					"cursor_column":   getenv("POSTGRES_CURSOR_COLUMN"),
+					"cursor_lookback": getenv("POSTGRES_CURSOR_LOOKBACK"),
+					"primary_key":     getenv("POSTGRES_PRIMARY_KEY"),
+					"diff":            getenv("POSTGRES_DIFF"),
+					"chunk_size":      getenv("POSTGRES_CHUNK_SIZE"),
+					"parallelism":     getenv("POSTGRES_PARALLELISM"),
+				}),
+				Secrets: map[string]interface{}{
+					"url": getenv("POSTGRES_URL"),
+				},
+			},
+		},
+		"postgres_cdc": &postgrescdc.PostgresCDC{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"tables":             getenv("POSTGRES_CDC_TABLES"),
+					"slot":               getenv("POSTGRES_CDC_SLOT"),
+					"publication":        getenv("POSTGRES_CDC_PUBLICATION"),
+					"status_interval_ms": getenv("POSTGRES_CDC_STATUS_INTERVAL_MS"),
+					"cleanup":            getenv("POSTGRES_CDC_CLEANUP"),
+				}),
+				Secrets: map[string]interface{}{
+					"url": getenv("POSTGRES_URL"),
+				},
+			},
+		},
+		"mysql": &mysql.MySQL{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"host":                getenv("MYSQL_HOST"),
+					"port":                getenv("MYSQL_PORT"),
+					"database":            getenv("MYSQL_DATABASE"),
+					"table":               getenv("MYSQL_TABLE"),
+					"query":               getenv("MYSQL_QUERY"),
+					"allow_sql":           getenv("MYSQL_ALLOW_SQL"),
+					"tls":                 getenv("MYSQL_TLS"),
+					"cursor_column":       getenv("MYSQL_CURSOR_COLUMN"),
+					"cursor_lookback":     getenv("MYSQL_CURSOR_LOOKBACK"),
+					"decimals_as_strings": getenv("MYSQL_DECIMALS_AS_STRINGS"),
+				}),
+				Secrets: map[string]interface{}{
+					"username":    getenv("MYSQL_USERNAME"),
+					"password":    getenv("MYSQL_PASSWORD"),
+					"ca_cert":     getenv("MYSQL_CA_CERT"),
+					"client_cert": getenv("MYSQL_CLIENT_CERT"),
+					"client_key":  getenv("MYSQL_CLIENT_KEY"),
 				},
+			},
+		},
+		"bigquery": &bigquery.BigQuery{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"project":             getenv("BIGQUERY_PROJECT"),
+					"table":               getenv("BIGQUERY_TABLE"),
+					"query":               getenv("BIGQUERY_QUERY"),
+					"location":            getenv("BIGQUERY_LOCATION"),
+					"max_bytes_billed":    getenv("BIGQUERY_MAX_BYTES_BILLED"),
+					"decimals_as_strings": getenv("BIGQUERY_DECIMALS_AS_STRINGS"),
+					"endpoint":            getenv("BIGQUERY_ENDPOINT"),
+					"storage_endpoint":    getenv("BIGQUERY_STORAGE_ENDPOINT"),
+				}),
 				Secrets: map[string]interface{}{
-					"url": os.Getenv("POSTGRES_URL"),
+					"credentials": getenv("BIGQUERY_CREDENTIALS"),
 				},
 			},
 		},
+		"clickhouse": &clickhouse.ClickHouse{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"host":                getenv("CLICKHOUSE_HOST"),
+					"port":                getenv("CLICKHOUSE_PORT"),
+					"tls":                 getenv("CLICKHOUSE_TLS"),
+					"database":            getenv("CLICKHOUSE_DATABASE"),
+					"table":               getenv("CLICKHOUSE_TABLE"),
+					"query":               getenv("CLICKHOUSE_QUERY"),
+					"cursor_column":       getenv("CLICKHOUSE_CURSOR_COLUMN"),
+					"cursor_lookback":     getenv("CLICKHOUSE_CURSOR_LOOKBACK"),
+					"decimals_as_strings": getenv("CLICKHOUSE_DECIMALS_AS_STRINGS"),
+				}),
+				Secrets: map[string]interface{}{
+					"username": getenv("CLICKHOUSE_USERNAME"),
+					"password": getenv("CLICKHOUSE_PASSWORD"),
+					"ca_cert":  getenv("CLICKHOUSE_CA_CERT"),
+				},
+			},
+		},
+		"redshift": &redshift.Redshift{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"table":           getenv("REDSHIFT_TABLE"),
+					"query":           getenv("REDSHIFT_QUERY"),
+					"unload":          getenv("REDSHIFT_UNLOAD"),
+					"unload_path":     getenv("REDSHIFT_UNLOAD_PATH"),
+					"unload_iam_role": getenv("REDSHIFT_UNLOAD_IAM_ROLE"),
+					"aws_region":      getenv("REDSHIFT_AWS_REGION"),
+					"s3_endpoint":     getenv("REDSHIFT_S3_ENDPOINT"),
+				}),
+				Secrets: map[string]interface{}{
+					"url":                   getenv("REDSHIFT_URL"),
+					"aws_access_key_id":     getenv("REDSHIFT_AWS_ACCESS_KEY_ID"),
+					"aws_secret_access_key": getenv("REDSHIFT_AWS_SECRET_ACCESS_KEY"),
+				},
+			},
+		},
+		"databricks": &databricks.Databricks{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"host":                getenv("DATABRICKS_HOST"),
+					"warehouse_id":        getenv("DATABRICKS_WAREHOUSE_ID"),
+					"catalog":             getenv("DATABRICKS_CATALOG"),
+					"schema":              getenv("DATABRICKS_SCHEMA"),
+					"table":               getenv("DATABRICKS_TABLE"),
+					"query":               getenv("DATABRICKS_QUERY"),
+					"external_links":      getenv("DATABRICKS_EXTERNAL_LINKS"),
+					"decimals_as_strings": getenv("DATABRICKS_DECIMALS_AS_STRINGS"),
+				}),
+				Secrets: map[string]interface{}{
+					"token": getenv("DATABRICKS_TOKEN"),
+				},
+			},
+		},
+		"files": &files.Files{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"path":                getenv("FILES_PATH"),
+					"format":              getenv("FILES_FORMAT"),
+					"csv_header":          getenv("FILES_CSV_HEADER"),
+					"csv_delimiter":       getenv("FILES_CSV_DELIMITER"),
+					"csv_quote":           getenv("FILES_CSV_QUOTE"),
+					"decimals_as_strings": getenv("FILES_DECIMALS_AS_STRINGS"),
+					"aws_region":          getenv("FILES_AWS_REGION"),
+					"s3_endpoint":         getenv("FILES_S3_ENDPOINT"),
+				}),
+				Secrets: map[string]interface{}{
+					"aws_access_key_id":     getenv("FILES_AWS_ACCESS_KEY_ID"),
+					"aws_secret_access_key": getenv("FILES_AWS_SECRET_ACCESS_KEY"),
+				},
+			},
+		},
+		"duckdb": &duckdb.DuckDB{
+			Conf: &types.ConfigType{
+				Settings: producerSettings(getenv, map[string]interface{}{
+					"query":               getenv("DUCKDB_QUERY"),
+					"allow_sql":           getenv("DUCKDB_ALLOW_SQL"),
+					"attach":              getenv("DUCKDB_ATTACH"),
+					"decimals_as_strings": getenv("DUCKDB_DECIMALS_AS_STRINGS"),
+					"aws_region":          getenv("DUCKDB_AWS_REGION"),
+					"s3_endpoint":         getenv("DUCKDB_S3_ENDPOINT"),
+				}),
+				Secrets: map[string]interface{}{
+					"aws_access_key_id":     getenv("DUCKDB_AWS_ACCESS_KEY_ID"),
+					"aws_secret_access_key": getenv("DUCKDB_AWS_SECRET_ACCESS_KEY"),
+				},
+			},
+		},
+	}
+	if !duckdb.Available {
+		delete(inputs, "duckdb")
+	}
+	if input, ok := inputs[name]; ok {
+		return input, nil
+	}
+	// Inputs registered with the generic SQL source read NAME_KEY
+	// variables for the keys their driver declares.
+	if _, ok := sqlsource.Lookup(name); ok {
+		source, err := sqlsource.NewSource(name, getenv)
+		if err != nil {
+			return nil, err
+		}
+		producerSettings(getenv, source.Conf.Settings)
+		return source, nil
+	}
+	return nil, fmt.Errorf("unknown input %q", name)
+}
+
+// sqlModeSettings are the variables of each input that make it run
+// free-form SQL against the source, or send requests to any address, so
+// only admins may set them.
+var sqlModeSettings = map[string][]string{
+	"snowflake":  {"SNOWFLAKE_QUERY"},
+	"postgres":   {"POSTGRES_QUERY", "POSTGRES_FILTER", "POSTGRES_ALLOW_SQL"},
+	"mysql":      {"MYSQL_QUERY", "MYSQL_ALLOW_SQL"},
+	"bigquery":   {"BIGQUERY_QUERY", "BIGQUERY_ENDPOINT", "BIGQUERY_STORAGE_ENDPOINT"},
+	"clickhouse": {"CLICKHOUSE_QUERY"},
+	"redshift":   {"REDSHIFT_QUERY"},
+	"databricks": {"DATABRICKS_QUERY"},
+	"duckdb":     {"DUCKDB_QUERY", "DUCKDB_ATTACH", "DUCKDB_ALLOW_SQL"},
+	"files":      {"FILES_S3_ENDPOINT"},
+}
+
+// localPathSettings are the variables of each input that may name files
+// on the machine it runs on. Previews and discovery run in the API
+// process, so only admins may set them to anything but an s3:// path.
+var localPathSettings = map[string][]string{
+	"files": {"FILES_PATH"},
+}
+
+// SQLModeSettings lists the variables of every input, including those
+// registered with the generic SQL source, that enable free-form SQL.
+func SQLModeSettings() []string {
+	var keys []string
+	for _, settings := range sqlModeSettings {
+		keys = append(keys, settings...)
+	}
+	sort.Strings(keys)
+	return append(keys, sqlsource.SQLModeSettings()...)
+}
+
+// LocalPathSettings lists the variables of every input that may name
+// local files.
+func LocalPathSettings() []string {
+	var keys []string
+	for _, settings := range localPathSettings {
+		keys = append(keys, settings...)
 	}
-	CONNECTOR_NAME := os.Getenv("CONNECTOR_NAME")
-	for key, value := range inputs {
-		if CONNECTOR_NAME == key {
-			value.Run()
+	sort.Strings(keys)
+	return keys
+}
+
+// dropFieldsKey is the variable listing fields left out of records, which
+// Start sets for columns the schema drift policy ignores.
+const dropFieldsKey = "DROP_FIELDS"
+
+func Start() {
+	name := os.Getenv("CONNECTOR_NAME")
+	input, err := New(name, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if policy := os.Getenv("SCHEMA_DRIFT_POLICY"); policy != "" {
+		dropped, err := checkDrift(input, policy)
+		if err != nil {
+			log.Fatalf("%s input failed: %v", name, err)
+		}
+		if len(dropped) > 0 {
+			input, err = New(name, func(key string) string {
+				if key == dropFieldsKey {
+					if fields := os.Getenv(key); fields != "" {
+						return strings.Join(append(dropped, fields), ",")
+					}
+					return strings.Join(dropped, ",")
+				}
+				return os.Getenv(key)
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
-}
\ No newline at end of file
+	if err := input.Run(); err != nil {
+		log.Fatalf("%s input failed: %v", name, err)
+	}
+}
+
+// CheckDriftPolicy rejects a schema drift policy the named input cannot
+// apply, so a pipeline is refused when it is configured rather than
+// failing on every run.
+func CheckDriftPolicy(name string, getenv func(string) string) error {
+	policy := getenv("SCHEMA_DRIFT_POLICY")
+	if policy == "" {
+		return nil
+	}
+	if err := drift.CheckPolicy(policy); err != nil {
+		return err
+	}
+	input, err := New(name, getenv)
+	if err != nil {
+		return err
+	}
+	if _, ok := input.(Previewer); !ok {
+		return fmt.Errorf("the %s input does not support schema drift detection, leave SCHEMA_DRIFT_POLICY unset", name)
+	}
+	return nil
+}
+
+// checkDrift reads the columns the input produces without reading any
+// rows and applies the pipeline's schema drift policy to them. It returns
+// the columns to leave out of the run's records. Inputs that cannot read
+// their columns are run unchecked; CheckDriftPolicy refuses such
+// configurations, so only pipelines configured before it get here.
+func checkDrift(input Input, policy string) ([]string, error) {
+	previewer, ok := input.(Previewer)
+	if !ok {
+		log.Printf("input does not support schema drift detection, ignoring SCHEMA_DRIFT_POLICY")
+		return nil, nil
+	}
+	dbClient, err := retldb.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	checker, err := drift.New(dbClient, os.Getenv("PIPELINE_NAME"), os.Getenv("RUN_ID"), policy)
+	if err != nil {
+		return nil, err
+	}
+	checker.Webhook = os.Getenv("SCHEMA_DRIFT_WEBHOOK")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	preview, err := previewer.Preview(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the source schema: %v", err)
+	}
+	return checker.Check(ctx, preview.Columns)
+}
@@ -0,0 +1,60 @@
+package inputs
+
+import (
+	"strings"
+	"testing"
+
+	"retl/inputs/duckdb"
+)
+
+func TestCheckDriftPolicy(t *testing.T) {
+	tests := []struct {
+		input  string
+		policy string
+		err    string
+	}{
+		{input: "postgres", policy: ""},
+		{input: "postgres", policy: "notify"},
+		{input: "postgres", policy: "warn", err: "invalid schema drift policy"},
+		{input: "postgres_cdc", policy: ""},
+		{input: "postgres_cdc", policy: "fail", err: "does not support schema drift detection"},
+		{input: "nosuchdb", policy: "fail", err: "unknown input"},
+	}
+	for _, tt := range tests {
+		err := CheckDriftPolicy(tt.input, func(key string) string {
+			if key == "SCHEMA_DRIFT_POLICY" {
+				return tt.policy
+			}
+			return ""
+		})
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("CheckDriftPolicy(%s, %q) = %v, want %q", tt.input, tt.policy, err, tt.err)
+		}
+	}
+}
+
+func TestDuckDBNeedsBuildTag(t *testing.T) {
+	_, err := New("duckdb", func(string) string { return "" })
+	if duckdb.Available != (err == nil) {
+		t.Errorf("New(duckdb) = %v with the driver available: %v", err, duckdb.Available)
+	}
+}
+
+func TestAdminSettingsAreRead(t *testing.T) {
+	for _, settings := range []map[string][]string{sqlModeSettings, localPathSettings} {
+		for name, keys := range settings {
+			read := map[string]bool{}
+			if _, err := New(name, func(key string) string {
+				read[key] = true
+				return ""
+			}); err != nil && !read[keys[0]] {
+				continue
+			}
+			for _, key := range keys {
+				if !read[key] {
+					t.Errorf("the %s input does not read %s", name, key)
+				}
+			}
+		}
+	}
+}
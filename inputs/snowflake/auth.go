@@ -0,0 +1,99 @@
+package snowflake
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/youmark/pkcs8"
+)
+
+// connectorConfig builds the driver configuration from the input's settings
+// and secrets. It is passed to the driver as a struct rather than a DSN so
+// credentials never appear in a string that could be logged.
+func (s *Snowflake) connectorConfig() (*gosnowflake.Config, error) {
+	account := s.Conf.Setting("account")
+	if account == "" {
+		account = fmt.Sprintf("%s-%s", s.Conf.Setting("org"), s.Conf.Setting("acc"))
+	}
+	timeout := fmt.Sprintf("%d", s.Conf.SettingInt("statement_timeout", 3600))
+
+	cfg := &gosnowflake.Config{
+		Account:     account,
+		Region:      s.Conf.Setting("region"),
+		User:        s.Conf.Secret("username"),
+		Database:    s.Conf.Setting("db"),
+		Schema:      s.Conf.Setting("schema"),
+		Warehouse:   s.Conf.Setting("wh"),
+		Role:        s.Conf.Setting("role"),
+		Application: "retl",
+		Params: map[string]*string{
+			"STATEMENT_TIMEOUT_IN_SECONDS": &timeout,
+		},
+	}
+
+	switch auth := s.Conf.Setting("auth"); auth {
+	case "", "password":
+		cfg.Authenticator = gosnowflake.AuthTypeSnowflake
+		cfg.Password = s.Conf.Secret("password")
+	case "keypair":
+		key, err := parsePrivateKey(s.Conf.Secret("private_key"), s.Conf.Secret("private_key_passphrase"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Authenticator = gosnowflake.AuthTypeJwt
+		cfg.PrivateKey = key
+	case "oauth":
+		if s.Conf.Secret("oauth_token") == "" {
+			return nil, fmt.Errorf("oauth authentication requires an oauth_token secret")
+		}
+		cfg.Authenticator = gosnowflake.AuthTypeOAuth
+		cfg.Token = s.Conf.Secret("oauth_token")
+	default:
+		return nil, fmt.Errorf("unsupported Snowflake authentication %q, expected password, keypair or oauth", auth)
+	}
+	return cfg, nil
+}
+
+// parsePrivateKey accepts PKCS#8 keys, encrypted or not, and PKCS#1 RSA
+// keys. Keys passed through environment variables often have their line
+// breaks escaped, so literal "\n" sequences are restored first.
+func parsePrivateKey(encoded, passphrase string) (*rsa.PrivateKey, error) {
+	encoded = strings.ReplaceAll(encoded, `\n`, "\n")
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key is encrypted but no passphrase was provided")
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKeyRSA(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %v", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key is not an RSA key")
+		}
+		return rsaKey, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+}
@@ -0,0 +1,146 @@
+package snowflake
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"retl/inputs/record"
+)
+
+type column struct {
+	name   string
+	dbType string
+	scale  int
+}
+
+// columnsOf names the result columns after the source, applying the
+// configured case normalization: "preserve" (the default), "lower" or
+// "upper". Snowflake reports unquoted identifiers in upper case.
+func columnsOf(rows *sql.Rows, normalize string) ([]column, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]column, len(types))
+	for i, t := range types {
+		name, err := normalizeName(t.Name(), normalize)
+		if err != nil {
+			return nil, err
+		}
+		_, scale, _ := t.DecimalSize()
+		columns[i] = column{name: name, dbType: t.DatabaseTypeName(), scale: int(scale)}
+	}
+	return columns, nil
+}
+
+func normalizeName(name, normalize string) (string, error) {
+	switch normalize {
+	case "", "preserve":
+		return name, nil
+	case "lower":
+		return strings.ToLower(name), nil
+	case "upper":
+		return strings.ToUpper(name), nil
+	}
+	return "", fmt.Errorf("invalid column case %q, expected preserve, lower or upper", normalize)
+}
+
+// keyColumns returns the names the configured key columns have in rows.
+// Snowflake resolves unquoted identifiers to upper case and keeps quoted
+// ones as written, and columnsOf then applies the column case.
+func keyColumns(key []string, normalize string) ([]string, error) {
+	names := make([]string, len(key))
+	for i, col := range key {
+		if !identifierPattern.MatchString(col) {
+			return nil, fmt.Errorf("invalid primary key column %q", col)
+		}
+		name := strings.ToUpper(col)
+		if strings.HasPrefix(col, `"`) {
+			name = strings.ReplaceAll(col[1:len(col)-1], `""`, `"`)
+		}
+		var err error
+		if names[i], err = normalizeName(name, normalize); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// converter returns the column names and the conversion of their values
+// for record.Scan.
+func converter(columns []column, decimalsAsStrings bool) ([]string, record.Convert) {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	return names, func(i int, v interface{}) (interface{}, error) {
+		return convertValue(columns[i], v, decimalsAsStrings)
+	}
+}
+
+// convertValue turns a scanned value into its JSON representation. NUMBER
+// is kept as an exact decimal literal (or a string when decimalsAsStrings
+// is set), timestamps become RFC3339 with their zone and semi-structured
+// values are parsed into nested JSON.
+func convertValue(col column, v interface{}, decimalsAsStrings bool) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch col.dbType {
+	case "FIXED":
+		var text string
+		switch n := v.(type) {
+		case *big.Int:
+			text = n.String()
+		case *big.Float:
+			text = n.Text('f', col.scale)
+		case int64:
+			text = fmt.Sprintf("%d", n)
+		case string:
+			text = n
+		default:
+			return nil, fmt.Errorf("unexpected %T for NUMBER column %s", v, col.name)
+		}
+		if decimalsAsStrings {
+			return text, nil
+		}
+		return json.Number(text), nil
+	case "VARIANT", "OBJECT", "ARRAY":
+		s, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var parsed interface{}
+		if err := decoder.Decode(&parsed); err != nil {
+			return nil, fmt.Errorf("invalid %s value in column %s: %v", col.dbType, col.name, err)
+		}
+		return parsed, nil
+	case "DATE":
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.DateOnly), nil
+		}
+	case "TIME":
+		if t, ok := v.(time.Time); ok {
+			return t.Format("15:04:05.999999999"), nil
+		}
+	case "TIMESTAMP_NTZ", "TIMESTAMP_LTZ", "TIMESTAMP_TZ":
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), nil
+		}
+	case "BINARY":
+		if b, ok := v.([]byte); ok {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,35 @@
+package snowflake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyColumns(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        []string
+		columnCase string
+		want       []string
+		err        bool
+	}{
+		{name: "unquoted resolves to upper case", key: []string{"id"}, want: []string{"ID"}},
+		{name: "lower column case", key: []string{"id", "Region"}, columnCase: "lower", want: []string{"id", "region"}},
+		{name: "quoted keeps its case", key: []string{`"Id"`}, want: []string{"Id"}},
+		{name: "quoted with escaped quote", key: []string{`"a""b"`}, want: []string{`a"b`}},
+		{name: "quoted under upper column case", key: []string{`"id"`}, columnCase: "upper", want: []string{"ID"}},
+		{name: "invalid identifier", key: []string{"id; drop"}, err: true},
+		{name: "invalid column case", key: []string{"id"}, columnCase: "title", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyColumns(tt.key, tt.columnCase)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v", err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"retl/inputs/types"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+func (s *Snowflake) open() (*sql.DB, error) {
+	cfg, err := s.connectorConfig()
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *cfg)), nil
+}
+
+func (s *Snowflake) TestConnection(ctx context.Context) error {
+	return s.source().TestConnection(ctx)
+}
+
+// Discovery uses SHOW commands, which only need the USAGE privilege and,
+// unlike INFORMATION_SCHEMA queries, do not need a running warehouse.
+// Names come back exactly as stored, so schemas and tables are always
+// quoted when used.
+
+func (s *Snowflake) Schemas(ctx context.Context) ([]string, error) {
+	rows, err := s.show(ctx, "SHOW SCHEMAS IN DATABASE "+s.database())
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, row := range rows {
+		if row["name"] != "INFORMATION_SCHEMA" {
+			names = append(names, row["name"])
+		}
+	}
+	return names, nil
+}
+
+func (s *Snowflake) Tables(ctx context.Context, schema string) ([]string, error) {
+	rows, err := s.show(ctx, fmt.Sprintf("SHOW OBJECTS IN SCHEMA %s.%s", s.database(), quote(schema)))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, row := range rows {
+		if row["kind"] == "TABLE" || row["kind"] == "VIEW" {
+			names = append(names, row["name"])
+		}
+	}
+	return names, nil
+}
+
+func (s *Snowflake) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	name := fmt.Sprintf("%s.%s.%s", s.database(), quote(schema), quote(table))
+	rows, err := s.show(ctx, "SHOW COLUMNS IN TABLE "+name)
+	if err != nil {
+		return nil, err
+	}
+	// Snowflake does not enforce primary keys, but tables declare them
+	// often enough to be a useful default for change detection. Views
+	// have none and the command fails on them, which leaves the columns
+	// without a key.
+	keys, _ := s.show(ctx, "SHOW PRIMARY KEYS IN TABLE "+name)
+	primaryKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		primaryKey[key["column_name"]] = true
+	}
+	columns := make([]types.Column, 0, len(rows))
+	for _, row := range rows {
+		// data_type is a JSON document such as
+		// {"type":"FIXED","precision":38,"scale":0,"nullable":true}.
+		var dataType struct {
+			Type     string `json:"type"`
+			Nullable bool   `json:"nullable"`
+		}
+		if err := json.Unmarshal([]byte(row["data_type"]), &dataType); err != nil {
+			return nil, fmt.Errorf("unexpected data type of column %s: %v", row["column_name"], err)
+		}
+		columns = append(columns, types.Column{
+			Name:       row["column_name"],
+			Type:       dataType.Type,
+			Nullable:   dataType.Nullable,
+			PrimaryKey: primaryKey[row["column_name"]],
+		})
+	}
+	return columns, nil
+}
+
+// database refers to the configured database the way the connection does,
+// where an unquoted name is case-insensitive.
+func (s *Snowflake) database() string {
+	if db := s.Conf.Setting("db"); identifierPattern.MatchString(db) {
+		return db
+	}
+	return quote(s.Conf.Setting("db"))
+}
+
+// show runs a SHOW command and returns its rows keyed by column name.
+func (s *Snowflake) show(ctx context.Context, query string) ([]map[string]string, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %q: %v", query, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]string
+	values := make([]sql.NullString, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(columns))
+		for i, col := range columns {
+			row[col] = values[i].String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Preview reads the first rows of the configured model or table, with the
+// column names and values a run would write.
+func (s *Snowflake) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	return s.source().Preview(ctx, limit)
+}
@@ -2,18 +2,19 @@ package snowflake
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"regexp"
+	"retl/inputs/record"
+	"retl/inputs/sqlsource"
+	"retl/inputs/state"
 	"retl/inputs/types"
+	"strings"
 	"time"
 
-	"github.com/segmentio/kafka-go"
-	_ "github.com/snowflakedb/gosnowflake"
+	"github.com/snowflakedb/gosnowflake"
 )
 
 type Snowflake struct {
@@ -22,117 +23,95 @@ type Snowflake struct {
 
 var LastRunTime time.Time
 
-func (s *Snowflake) Run() error {
-    fmt.Println("IN RUN FUNCTIONNNNN")
-    fmt.Println("cd ls")
-    dir, err := os.Getwd()
-    if err != nil {
-        log.Fatal(err)
-    }
-
-    entries, err := os.ReadDir(dir)
-    if err != nil {
-        log.Fatal(err)
-    }
-
-    for _, entry := range entries {
-        fmt.Println(entry.Name())
-    }
-    keypair, err := tls.LoadX509KeyPair("service.cert", "service.key")
-    if err != nil {
-        log.Fatalf("Failed to load Access Key and/or Access Certificate: %s", err)
-    }
-    fmt.Println("KEYPAIR RESOLVED")
-    caCert, err := os.ReadFile("ca.pem")
-    if err != nil {
-        log.Fatalf("Failed to read CA Certificate file: %s", err)
-    }
-    fmt.Println("CA CERT RESOLVED")
-    caCertPool := x509.NewCertPool()
-    ok := caCertPool.AppendCertsFromPEM(caCert)
-    if !ok {
-        log.Fatalf("Failed to parse CA Certificate file: %s", err)
-    }
-
-    dialer := &kafka.Dialer{
-        Timeout:   10 * time.Second,
-        DualStack: true,
-        TLS: &tls.Config{
-            Certificates: []tls.Certificate{keypair},
-            RootCAs:      caCertPool,
+// source runs the input through the generic SQL source. Models run as
+// configured, and rows are named after the configured column case, which
+// the primary key is resolved against.
+func (s *Snowflake) source() *sqlsource.Source {
+    return &sqlsource.Source{
+        Name: "Snowflake",
+        Driver: &sqlsource.Driver{
+            Name: "snowflake",
+            Open: func(conf *types.ConfigType) (*sql.DB, error) {
+                return s.open()
+            },
+            Quote:       quoteIdentifier,
+            Placeholder: func(int) string { return "?" },
+            Dialect: &sqlsource.Dialect{
+                Limit: func(n int) string { return fmt.Sprintf("LIMIT %d", n) },
+                Bind:  bindKey,
+            },
+            Context: func(ctx context.Context, conf *types.ConfigType) context.Context {
+                tag := fmt.Sprintf("retl pipeline=%s run=%s", os.Getenv("PIPELINE_NAME"), os.Getenv("RUN_ID"))
+                return gosnowflake.WithHigherPrecision(gosnowflake.WithQueryTag(ctx, tag))
+            },
+            Query: func(ctx context.Context, db *sql.DB, conf *types.ConfigType, cursor *state.Cursor) (string, []interface{}, error) {
+                query, err := s.buildQuery()
+                return query, nil, err
+            },
+            Columns: func(conf *types.ConfigType, rows *sql.Rows) ([]string, record.Convert, error) {
+                columns, err := columnsOf(rows, conf.Setting("column_case"))
+                if err != nil {
+                    return nil, nil, err
+                }
+                names, convert := converter(columns, conf.Setting("decimals_as_strings") == "true")
+                return names, convert, nil
+            },
+            Key: func(conf *types.ConfigType, key []string) ([]string, error) {
+                return keyColumns(key, conf.Setting("column_case"))
+            },
         },
+        Conf: s.Conf,
     }
+}
+
+func (s *Snowflake) Run() error {
+    return s.source().Run()
+}
 
-    brokerAddress := "kafka-297becac-sjsu-f7b6.k.aivencloud.com:11921"
-    topic := "aneesh_2"
+var identifierPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_$]*|"([^"]|"")+")$`)
 
-    producer := kafka.NewWriter(kafka.WriterConfig{
-        Brokers: []string{brokerAddress},
-        Topic:   topic,
-        Dialer:  dialer,
-    })
-    fmt.Println("KAFKA PRODUCER OK")
-    fmt.Println(os.Getenv("SNOWFLAKE_USERNAME"))
-    snowflakeURL := fmt.Sprintf("%s:%s@%s-%s/%s?warehouse=%s", os.Getenv("SNOWFLAKE_USERNAME"), os.Getenv("SNOWFLAKE_PASSWORD"), os.Getenv("SNOWFLAKE_ORG"), os.Getenv("SNOWFLAKE_ACC"), os.Getenv("SNOWFLAKE_DB"), os.Getenv("SNOWFLAKE_WH"))
-    fmt.Println(snowflakeURL)
-    db, err := sql.Open("snowflake", snowflakeURL)
-    if err != nil {
-        log.Fatal(err)
+// buildQuery returns the user's model query when one is configured, and
+// otherwise selects the whole configured table. Table references may be
+// qualified with a database and schema; each part must be a valid
+// identifier so the reference cannot smuggle in SQL.
+func (s *Snowflake) buildQuery() (string, error) {
+    if model := s.Conf.Setting("query"); model != "" {
+        return model, nil
     }
-    fmt.Println("DB")
-    fmt.Println(db)
-    rows, err := db.Query("SELECT * FROM DB_1.PUBLIC.TABLE_1 LIMIT 10")
+    table, err := s.tableRef()
     if err != nil {
-        log.Fatal(err)
+        return "", err
     }
-    defer rows.Close()
-    fmt.Println("ROWS")
-    fmt.Println(rows)
-    columns, err := rows.Columns()
-    if err != nil {
-        log.Fatal(err)
-    }
-
-    values := make([]interface{}, len(columns))
-    valuePtrs := make([]interface{}, len(columns))
-    rowMap := make(map[string]interface{})
-    for rows.Next() {
-        for i := range values {
-            valuePtrs[i] = &values[i]
-        }
-
-        err := rows.Scan(valuePtrs...)
-        if err != nil {
-            log.Fatal(err)
-        }
-        for i := range columns {
-            var v interface{}
-            val := values[i]
+    return "SELECT * FROM " + table, nil
+}
 
-            b, ok := val.([]byte)
-            if ok {
-                v = string(b)
-            } else {
-                v = val
-            }
-            rowMap[fmt.Sprintf("column_%d", i)] = v
-        }
-        rowJSON, err := json.Marshal(rowMap)
-        fmt.Println(string(rowJSON))
-        if err != nil {
-            log.Fatalf("Failed to marshal row to JSON: %s", err)
+func (s *Snowflake) tableRef() (string, error) {
+    table := s.Conf.Setting("table")
+    if table == "" {
+        return "", fmt.Errorf("snowflake input needs either a table or a query")
+    }
+    for _, part := range strings.Split(table, ".") {
+        if !identifierPattern.MatchString(part) {
+            return "", fmt.Errorf("invalid table reference %q", table)
         }
+    }
+    return table, nil
+}
 
-        msg := kafka.Message{
-            Key:   []byte(os.Getenv("PIPELINE_NAME")),
-            Value: rowJSON, 
-        }
-        err = producer.WriteMessages(context.TODO(), msg)
-        if err != nil {
-                log.Fatalf("Failed to write message: %s", err)
-        }
+// quoteIdentifier leaves valid identifiers as they are, so unquoted ones
+// keep resolving case-insensitively, and quotes anything else.
+func quoteIdentifier(name string) string {
+    if identifierPattern.MatchString(name) {
+        return name
     }
+    return quote(name)
+}
 
-    fmt.Println("Message sent successfully")
-    return nil
+// bindKey converts a key value read back from a row or a checkpoint into
+// something the driver can bind.
+func bindKey(v interface{}) interface{} {
+    if n, ok := v.(json.Number); ok {
+        return n.String()
+    }
+    return v
 }
@@ -0,0 +1,115 @@
+package sqlsource
+
+import (
+	"context"
+	"fmt"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+)
+
+// Schemas lists the schemas of the database, leaving out the standard
+// catalog.
+func (s *Source) Schemas(ctx context.Context) ([]string, error) {
+	return s.list(ctx, `SELECT schema_name FROM information_schema.schemata
+		WHERE schema_name <> 'information_schema' ORDER BY schema_name`)
+}
+
+func (s *Source) Tables(ctx context.Context, schema string) ([]string, error) {
+	return s.list(ctx, fmt.Sprintf(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = %s ORDER BY table_name`, s.Driver.Placeholder(1)), schema)
+}
+
+func (s *Source) Columns(ctx context.Context, schema, table string) ([]types.Column, error) {
+	if !s.Driver.InformationSchema {
+		return nil, fmt.Errorf("schema discovery is not supported for %s", s.Name)
+	}
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// CASE rather than a bare EXISTS, which not every database allows in
+	// the select list.
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT c.column_name, c.data_type, c.is_nullable, CASE WHEN EXISTS (
+			SELECT 1 FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage k
+				ON k.constraint_schema = tc.constraint_schema AND k.constraint_name = tc.constraint_name
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+				AND tc.table_name = c.table_name AND k.column_name = c.column_name) THEN 1 ELSE 0 END
+		FROM information_schema.columns c
+		WHERE c.table_schema = %s AND c.table_name = %s ORDER BY c.ordinal_position`, s.Driver.Placeholder(1), s.Driver.Placeholder(2)), schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up columns of %s.%s: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	var columns []types.Column
+	for rows.Next() {
+		var col types.Column
+		var nullable string
+		var primaryKey int
+		if err := rows.Scan(&col.Name, &col.Type, &nullable, &primaryKey); err != nil {
+			return nil, err
+		}
+		col.Nullable = nullable == "YES"
+		col.PrimaryKey = primaryKey == 1
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func (s *Source) list(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	if !s.Driver.InformationSchema {
+		return nil, fmt.Errorf("schema discovery is not supported for %s", s.Name)
+	}
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Preview reads the first rows of the configured table or query. It
+// selects the whole source, not just the rows new since the last
+// incremental sync.
+func (s *Source) Preview(ctx context.Context, limit int) (*types.Preview, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query, args, err := s.query(ctx, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.Driver.Sample != nil {
+		query = s.Driver.Sample(query, limit)
+	} else {
+		query = record.LimitQuery(query, limit)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s query: %v", s.Name, err)
+	}
+	defer rows.Close()
+	columns, convert, err := s.converter(rows)
+	if err != nil {
+		return nil, err
+	}
+	return (&record.Writer{}).Preview(rows, columns, convert, limit)
+}
@@ -0,0 +1,160 @@
+package sqlsource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"retl/inputs/extract"
+	"retl/inputs/record"
+	"retl/inputs/state"
+	"retl/inputs/types"
+)
+
+// Driver plugs a database/sql driver into the generic SQL input. Adding a
+// database is a matter of registering one; the input takes care of
+// reading tables or queries, chunked extraction, change detection and
+// writing to Kafka.
+type Driver struct {
+	// Name is the database/sql driver name.
+	Name string
+	// Settings and Secrets are the keys the driver reads on top of the
+	// common ones, such as host and password.
+	Settings []string
+	Secrets  []string
+	// DSN builds the data source name from the input's configuration.
+	DSN func(conf *types.ConfigType) (string, error)
+	// Open connects when a data source name is not enough, for example for
+	// TLS certificates or key pair authentication. It replaces DSN.
+	Open func(conf *types.ConfigType) (*sql.DB, error)
+	// Quote quotes an identifier.
+	Quote func(name string) string
+	// Placeholder returns the bind parameter of the n-th argument,
+	// counting from 1.
+	Placeholder func(n int) string
+	// Convert turns a scanned value into its JSON representation. Without
+	// it byte slices become strings and other values are kept.
+	Convert func(col *sql.ColumnType, v interface{}, decimalsAsStrings bool) (interface{}, error)
+	// Dialect spells out keyset pagination. Without one, sources cannot be
+	// extracted in chunks.
+	Dialect *Dialect
+	// Sample wraps a query to return at most n of its rows for a preview.
+	// Without it the query is wrapped in SELECT ... LIMIT n.
+	Sample func(query string, n int) string
+	// InformationSchema is set when the database has the standard
+	// information_schema views, which schema discovery reads.
+	InformationSchema bool
+
+	// The hooks below let an input with its own configuration reuse the
+	// run of a source. Each replaces the default behavior when set.
+
+	// Context prepares the context of a run's queries, for example to tag
+	// them.
+	Context func(ctx context.Context, conf *types.ConfigType) context.Context
+	// Query builds the query of a run or preview in place of the
+	// configured table or SQL-mode query. cursor is set for incremental
+	// syncs, whose query must only select newer rows, ordered by the
+	// cursor column.
+	Query func(ctx context.Context, db *sql.DB, conf *types.ConfigType, cursor *state.Cursor) (string, []interface{}, error)
+	// Pages reads a paginated run in place of the keyset reader over the
+	// configured table. key is led by the cursor column for incremental
+	// syncs, which the default reader does not support.
+	Pages func(ctx context.Context, db *sql.DB, conf *types.ConfigType, key []string, cursor *state.Cursor) (extract.Reader, error)
+	// Columns names the result columns and converts their values in place
+	// of the driver's names and Convert, for example to normalize case.
+	Columns func(conf *types.ConfigType, rows *sql.Rows) ([]string, record.Convert, error)
+	// Key names the configured key columns the way rows name them, for
+	// when Columns renames them.
+	Key func(conf *types.ConfigType, key []string) ([]string, error)
+	// CursorValue converts the stored high-water mark of an incremental
+	// sync into the value bound in its filter. Without it the stored text
+	// is bound.
+	CursorValue func(since string) interface{}
+}
+
+// Dialect is how a database spells a page of a keyset-paginated query.
+type Dialect struct {
+	// Limit returns the clause that follows ORDER BY to return at most n
+	// rows.
+	Limit func(n int) string
+	// RowValues is set when the database compares row values, as in
+	// (a, b) > (x, y). Otherwise the comparison is spelled out.
+	RowValues bool
+	// Bind converts a key value read back from a row or a checkpoint into
+	// something the driver can bind. Without it values are bound as they
+	// are.
+	Bind func(v interface{}) interface{}
+}
+
+// commonSettings are read by every registered source.
+var (
+	commonSettings = []string{"table", "query", "allow_sql", "primary_key", "chunk_size", "parallelism", "diff", "decimals_as_strings"}
+	commonSecrets  = []string{"url"}
+)
+
+var drivers = map[string]*Driver{}
+
+// Register makes a driver available as the input of the given name. It
+// panics when the name is taken, like sql.Register.
+func Register(name string, d *Driver) {
+	if _, ok := drivers[name]; ok {
+		panic("sqlsource: Register called twice for " + name)
+	}
+	drivers[name] = d
+}
+
+func Lookup(name string) (*Driver, bool) {
+	d, ok := drivers[name]
+	return d, ok
+}
+
+// Names lists the registered inputs.
+func Names() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Keys returns the setting and secret keys of a driver's input.
+func (d *Driver) Keys() (settings, secrets []string) {
+	return append(append([]string{}, commonSettings...), d.Settings...), append(append([]string{}, commonSecrets...), d.Secrets...)
+}
+
+// EnvName is the variable a registered input reads a key from, such as
+// SQLSERVER_TABLE.
+func EnvName(input, key string) string {
+	return strings.ToUpper(input + "_" + key)
+}
+
+// SQLModeSettings are the variables of registered inputs that enable
+// free-form SQL.
+func SQLModeSettings() []string {
+	var keys []string
+	for _, name := range Names() {
+		keys = append(keys, EnvName(name, "query"), EnvName(name, "allow_sql"))
+	}
+	return keys
+}
+
+// NewSource builds the source of a registered input, reading its
+// configuration through getenv.
+func NewSource(name string, getenv func(string) string) (*Source, error) {
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown SQL input %q", name)
+	}
+	settings, secrets := d.Keys()
+	conf := &types.ConfigType{Settings: map[string]interface{}{}, Secrets: map[string]interface{}{}}
+	for _, key := range settings {
+		conf.Settings[key] = getenv(EnvName(name, key))
+	}
+	for _, key := range secrets {
+		conf.Secrets[key] = getenv(EnvName(name, key))
+	}
+	return &Source{Name: name, Driver: d, Conf: conf}, nil
+}
@@ -0,0 +1,100 @@
+package sqlsource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"retl/inputs/extract"
+	"retl/inputs/record"
+)
+
+// pageReader reads a table one keyset page at a time in the driver's
+// dialect. Key values are always bound as parameters.
+type pageReader struct {
+	source *Source
+	db     *sql.DB
+	table  string
+	key    []string
+}
+
+func (r *pageReader) ReadPage(ctx context.Context, rng extract.Range, after []interface{}, limit int) ([]extract.Row, error) {
+	d := r.source.Driver
+	key := make([]string, len(r.key))
+	for i, col := range r.key {
+		key[i] = d.Quote(col)
+	}
+	var conds []string
+	var args []interface{}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return d.Placeholder(len(args))
+	}
+	bindKey := bind
+	if d.Dialect.Bind != nil {
+		bindKey = func(v interface{}) string { return bind(d.Dialect.Bind(v)) }
+	}
+	if rng.Lower != nil {
+		conds = append(conds, key[0]+" >= "+bind(*rng.Lower))
+	}
+	if rng.Upper != nil {
+		conds = append(conds, key[0]+" < "+bind(*rng.Upper))
+	}
+	if after != nil {
+		if d.Dialect.RowValues {
+			params := make([]string, len(after))
+			for i, v := range after {
+				params[i] = bindKey(v)
+			}
+			conds = append(conds, fmt.Sprintf("(%s) > (%s)", strings.Join(key, ", "), strings.Join(params, ", ")))
+		} else {
+			// (a, b) > (x, y) spelled out as a > x OR (a = x AND b > y).
+			var alternatives []string
+			for i := range key {
+				var terms []string
+				for j := 0; j < i; j++ {
+					terms = append(terms, key[j]+" = "+bindKey(after[j]))
+				}
+				terms = append(terms, key[i]+" > "+bindKey(after[i]))
+				alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+			}
+			conds = append(conds, "("+strings.Join(alternatives, " OR ")+")")
+		}
+	}
+
+	query := "SELECT * FROM " + r.table
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY " + strings.Join(key, ", ") + " " + d.Dialect.Limit(limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s query: %v", r.source.Name, err)
+	}
+	defer rows.Close()
+	columns, convert, err := r.source.converter(rows)
+	if err != nil {
+		return nil, err
+	}
+	page := make([]extract.Row, 0, limit)
+	for rows.Next() {
+		row, err := record.Scan(rows, columns, convert)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, row)
+	}
+	return page, rows.Err()
+}
+
+func (r *pageReader) Bounds(ctx context.Context) (int64, int64, bool, error) {
+	col := r.source.Driver.Quote(r.key[0])
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", col, col, r.table)
+	var min, max sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query).Scan(&min, &max); err != nil {
+		return 0, 0, false, err
+	}
+	return min.Int64, max.Int64, min.Valid, nil
+}
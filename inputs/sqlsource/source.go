@@ -0,0 +1,301 @@
+package sqlsource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	retldb "retl/db"
+	"retl/inputs/diff"
+	"retl/inputs/extract"
+	"retl/inputs/producer"
+	"retl/inputs/record"
+	"retl/inputs/state"
+	"retl/inputs/types"
+	"strings"
+)
+
+// Source reads a table or, in SQL mode, a custom query through a
+// registered driver.
+type Source struct {
+	Name   string
+	Driver *Driver
+	Conf   *types.ConfigType
+}
+
+func (s *Source) Run() error {
+	producer, err := producer.New(s.Conf)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	pipelineID := os.Getenv("PIPELINE_NAME")
+	chunkSize := s.Conf.SettingInt("chunk_size", 0)
+	var cursor *state.Cursor
+	var differ *diff.Differ
+	var checkpoints *extract.Checkpoints
+	cursorColumn, detectChanges := s.Conf.Setting("cursor_column"), s.Conf.Setting("diff") == "true"
+	if cursorColumn != "" && detectChanges {
+		return fmt.Errorf("incremental syncs and change detection cannot be combined")
+	}
+	if cursorColumn != "" || detectChanges || chunkSize > 0 {
+		dbClient, err := retldb.NewClient()
+		if err != nil {
+			return err
+		}
+		if cursorColumn != "" {
+			cursor, err = state.NewCursor(state.New(dbClient), pipelineID, cursorColumn, s.Conf.Setting("cursor_lookback"))
+		} else if detectChanges {
+			var key []string
+			if key, err = s.rowKey(diff.ParseKey(s.Conf.Setting("primary_key"))); err == nil {
+				differ, err = diff.New(dbClient, pipelineID, key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// Change detection needs to see every row of the run to find
+		// deletes, so a run that uses it cannot resume halfway.
+		if runID := os.Getenv("RUN_ID"); chunkSize > 0 && differ == nil && runID != "" {
+			checkpoints = extract.NewCheckpoints(state.New(dbClient), pipelineID, runID)
+		}
+	}
+
+	ctx := context.TODO()
+	if s.Driver.Context != nil {
+		ctx = s.Driver.Context(ctx, s.Conf)
+	}
+	w := &record.Writer{Producer: producer, PipelineID: pipelineID, Differ: differ}
+	if chunkSize > 0 {
+		err = s.extractPages(ctx, db, w, chunkSize, cursor, checkpoints)
+	} else {
+		if cursor != nil {
+			w.Observe = func(row map[string]interface{}) { cursor.Observe(row[cursor.Column]) }
+		}
+		err = s.extractAll(ctx, db, w, cursor)
+	}
+	if err != nil {
+		return err
+	}
+
+	if differ != nil {
+		deletes, err := differ.DeleteEvents(pipelineID)
+		if err != nil {
+			return err
+		}
+		if err := producer.Write(ctx, deletes...); err != nil {
+			return err
+		}
+	}
+	if err := producer.Close(); err != nil {
+		return err
+	}
+	if cursor != nil {
+		if err := cursor.Commit(); err != nil {
+			return err
+		}
+	}
+	if differ != nil {
+		return differ.Commit()
+	}
+	return nil
+}
+
+func (s *Source) open() (*sql.DB, error) {
+	if s.Driver.Open != nil {
+		return s.Driver.Open(s.Conf)
+	}
+	dsn, err := s.Driver.DSN(s.Conf)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open(s.Driver.Name, dsn)
+}
+
+func (s *Source) TestConnection(ctx context.Context) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", s.Name, err)
+	}
+	return nil
+}
+
+// extractAll reads the whole source with a single query, restricted to new
+// rows when cursor is set.
+func (s *Source) extractAll(ctx context.Context, db *sql.DB, w *record.Writer, cursor *state.Cursor) error {
+	query, args, err := s.query(ctx, db, cursor)
+	if err != nil {
+		return err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to run %s query: %v", s.Name, err)
+	}
+	defer rows.Close()
+	columns, convert, err := s.converter(rows)
+	if err != nil {
+		return err
+	}
+	return w.Copy(ctx, rows, columns, convert)
+}
+
+// extractPages reads the source in chunks ordered by its primary key, led
+// by the cursor column for incremental syncs.
+func (s *Source) extractPages(ctx context.Context, db *sql.DB, w *record.Writer, chunkSize int, cursor *state.Cursor, checkpoints *extract.Checkpoints) error {
+	if s.Driver.Dialect == nil && s.Driver.Pages == nil {
+		return fmt.Errorf("%s does not support paginated extraction", s.Name)
+	}
+	if s.Conf.Setting("query") != "" {
+		return fmt.Errorf("paginated extraction is only supported for tables, not queries")
+	}
+	key := diff.ParseKey(s.Conf.Setting("primary_key"))
+	if len(key) == 0 {
+		return fmt.Errorf("paginated extraction needs a primary key")
+	}
+	parallelism := s.Conf.SettingInt("parallelism", 1)
+	if cursor != nil {
+		if parallelism > 1 {
+			return fmt.Errorf("incremental syncs cannot be extracted in parallel")
+		}
+		key = append([]string{cursor.Column}, key...)
+	}
+
+	var reader extract.Reader
+	if s.Driver.Pages != nil {
+		var err error
+		if reader, err = s.Driver.Pages(ctx, db, s.Conf, key, cursor); err != nil {
+			return err
+		}
+	} else {
+		if cursor != nil {
+			return fmt.Errorf("incremental syncs of %s cannot be paginated", s.Name)
+		}
+		table, err := s.table()
+		if err != nil {
+			return err
+		}
+		reader = &pageReader{source: s, db: db, table: table, key: key}
+	}
+	// Queries name the key as configured, rows by their result columns.
+	rowKey, err := s.rowKey(key)
+	if err != nil {
+		return err
+	}
+
+	extractor := &extract.Extractor{
+		Reader:      reader,
+		Key:         rowKey,
+		ChunkSize:   chunkSize,
+		Parallelism: parallelism,
+		Producer:    w.Producer,
+		Checkpoints: checkpoints,
+		Messages:    w.Messages,
+	}
+	if err := extractor.Run(ctx); err != nil {
+		return err
+	}
+	// Pages are ordered by the cursor first, so the last key seen, even
+	// before a resume, carries the new high-water mark.
+	if last := extractor.Last(); cursor != nil && last != nil {
+		cursor.Observe(last[0])
+	}
+	return nil
+}
+
+// rowKey names key columns the way rows name them.
+func (s *Source) rowKey(key []string) ([]string, error) {
+	if s.Driver.Key == nil {
+		return key, nil
+	}
+	return s.Driver.Key(s.Conf, key)
+}
+
+// converter returns the column names of rows and the conversion of their
+// values for record.Scan.
+func (s *Source) converter(rows *sql.Rows) ([]string, record.Convert, error) {
+	if s.Driver.Columns != nil {
+		return s.Driver.Columns(s.Conf, rows)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(columnTypes))
+	for i, t := range columnTypes {
+		columns[i] = t.Name()
+	}
+	if s.Driver.Convert == nil {
+		return columns, nil, nil
+	}
+	decimalsAsStrings := s.Conf.Setting("decimals_as_strings") == "true"
+	return columns, func(i int, v interface{}) (interface{}, error) {
+		return s.Driver.Convert(columnTypes[i], v, decimalsAsStrings)
+	}, nil
+}
+
+// query builds the query of a run, restricted to new rows when cursor is
+// set.
+func (s *Source) query(ctx context.Context, db *sql.DB, cursor *state.Cursor) (string, []interface{}, error) {
+	if s.Driver.Query != nil {
+		return s.Driver.Query(ctx, db, s.Conf, cursor)
+	}
+	query, err := s.buildQuery()
+	if err != nil || cursor == nil {
+		return query, nil, err
+	}
+	if s.Conf.Setting("query") != "" {
+		return "", nil, fmt.Errorf("incremental syncs are not supported in SQL mode")
+	}
+	var args []interface{}
+	query, err = cursor.Apply(query, s.Driver.Quote, func(since string) string {
+		if s.Driver.CursorValue != nil {
+			args = append(args, s.Driver.CursorValue(since))
+		} else {
+			args = append(args, since)
+		}
+		return s.Driver.Placeholder(len(args))
+	})
+	return query, args, err
+}
+
+// buildQuery returns the configured query, which is only run when an
+// admin has enabled SQL mode for the input, or selects the configured
+// table.
+func (s *Source) buildQuery() (string, error) {
+	if query := s.Conf.Setting("query"); query != "" {
+		if s.Conf.Setting("allow_sql") != "true" {
+			return "", fmt.Errorf("free-form SQL is only allowed when SQL mode is enabled by an admin")
+		}
+		return query, nil
+	}
+	table, err := s.table()
+	if err != nil {
+		return "", err
+	}
+	return "SELECT * FROM " + table, nil
+}
+
+// table quotes the configured table, which may be qualified with its
+// schema or database.
+func (s *Source) table() (string, error) {
+	table := s.Conf.Setting("table")
+	if table == "" {
+		return "", fmt.Errorf("%s input needs either a table or a query", s.Name)
+	}
+	var parts []string
+	for _, part := range strings.Split(table, ".") {
+		parts = append(parts, s.Driver.Quote(part))
+	}
+	return strings.Join(parts, "."), nil
+}
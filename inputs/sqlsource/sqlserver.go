@@ -0,0 +1,112 @@
+package sqlsource
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"retl/inputs/record"
+	"retl/inputs/types"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+func init() {
+	Register("sqlserver", &Driver{
+		Name:     "sqlserver",
+		Settings: []string{"host", "port", "database", "encrypt", "trust_server_certificate"},
+		Secrets:  []string{"username", "password"},
+		DSN:      sqlServerDSN,
+		Quote: func(name string) string {
+			return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+		},
+		Placeholder: func(n int) string { return fmt.Sprintf("@p%d", n) },
+		Convert:     convertSQLServer,
+		Dialect: &Dialect{
+			Limit: func(n int) string { return fmt.Sprintf("OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", n) },
+		},
+		Sample: func(query string, n int) string {
+			return fmt.Sprintf("SELECT TOP (%d) * FROM (%s) AS preview", n, strings.TrimRight(strings.TrimSpace(query), "; \t\n"))
+		},
+		InformationSchema: true,
+	})
+}
+
+// sqlServerDSN uses the url secret as is, or builds one from the host and
+// credentials. Connections are encrypted unless encrypt says otherwise.
+func sqlServerDSN(conf *types.ConfigType) (string, error) {
+	if dsn := conf.Secret("url"); dsn != "" {
+		return dsn, nil
+	}
+	host := conf.Setting("host")
+	if host == "" {
+		return "", fmt.Errorf("sqlserver input needs a url or a host")
+	}
+	if port := conf.Setting("port"); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	query := url.Values{"app name": {"retl"}, "encrypt": {"true"}}
+	if database := conf.Setting("database"); database != "" {
+		query.Set("database", database)
+	}
+	if encrypt := conf.Setting("encrypt"); encrypt != "" {
+		query.Set("encrypt", encrypt)
+	}
+	if conf.Setting("trust_server_certificate") == "true" {
+		query.Set("TrustServerCertificate", "true")
+	}
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(conf.Secret("username"), conf.Secret("password")),
+		Host:     host,
+		RawQuery: query.Encode(),
+	}
+	return u.String(), nil
+}
+
+// convertSQLServer keeps decimals and money exact, renders dates, times
+// and timestamps like the other inputs, formats uniqueidentifiers, whose
+// first three groups SQL Server stores little-endian, and base64 encodes
+// binary columns.
+func convertSQLServer(col *sql.ColumnType, v interface{}, decimalsAsStrings bool) (interface{}, error) {
+	switch n := v.(type) {
+	case []byte:
+		switch col.DatabaseTypeName() {
+		case "DECIMAL", "MONEY", "SMALLMONEY":
+			text := string(n)
+			scale := 0
+			if i := strings.IndexByte(text, '.'); i >= 0 {
+				scale = len(text) - i - 1
+			}
+			unscaled, ok := new(big.Int).SetString(strings.Replace(text, ".", "", 1), 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s value %q in column %s", col.DatabaseTypeName(), text, col.Name())
+			}
+			return record.Decimal(unscaled, scale, decimalsAsStrings), nil
+		case "UNIQUEIDENTIFIER":
+			if len(n) == 16 {
+				return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+					n[3], n[2], n[1], n[0], n[5], n[4], n[7], n[6], n[8:10], n[10:]), nil
+			}
+		case "BINARY", "VARBINARY", "IMAGE", "TIMESTAMP", "ROWVERSION":
+			return base64.StdEncoding.EncodeToString(n), nil
+		}
+		return string(n), nil
+	case time.Time:
+		switch col.DatabaseTypeName() {
+		case "DATE":
+			return n.Format(time.DateOnly), nil
+		case "TIME":
+			return n.Format("15:04:05.9999999"), nil
+		}
+		return n.Format(time.RFC3339Nano), nil
+	case float64:
+		return record.Float(n), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,129 @@
+package state
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// CursorKey holds the high-water mark of incremental syncs.
+const CursorKey = "cursor"
+
+// Cursor restricts a run to rows whose cursor column is beyond the
+// high-water mark of the last successful run. The lookback widens that
+// window to pick up rows that were committed late; it is a duration such
+// as "15m" for timestamp cursors and a number for numeric cursors.
+type Cursor struct {
+	Column     string
+	lookback   string
+	store      *Store
+	pipelineID string
+
+	highWater string
+	latest    string
+}
+
+func NewCursor(store *Store, pipelineID, column, lookback string) (*Cursor, error) {
+	highWater, _, err := store.Get(pipelineID, CursorKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{
+		Column:     column,
+		lookback:   lookback,
+		store:      store,
+		pipelineID: pipelineID,
+		highWater:  highWater,
+	}, nil
+}
+
+// Since returns the bound rows must be beyond, as RFC 3339 for timestamp
+// cursors and as a number or text otherwise. ok is false on the first
+// run, which reads every row.
+func (c *Cursor) Since() (since string, ok bool, err error) {
+	if c.highWater == "" {
+		return "", false, nil
+	}
+	since, err = Lookback(c.highWater, c.lookback)
+	return since, err == nil, err
+}
+
+// Apply restricts a query over a table to new rows and orders them by the
+// cursor, so the last row seen carries the new high-water mark. quote
+// quotes the column, and bind returns the placeholder that passes since
+// to the database in its dialect.
+func (c *Cursor) Apply(query string, quote func(name string) string, bind func(since string) string) (string, error) {
+	column := quote(c.Column)
+	since, ok, err := c.Since()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		query += fmt.Sprintf(" WHERE %s > %s", column, bind(since))
+	}
+	return query + " ORDER BY " + column, nil
+}
+
+// Observe records the cursor value of a delivered row. Rows must be seen
+// in cursor order.
+func (c *Cursor) Observe(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+	case time.Time:
+		c.latest = v.Format(time.RFC3339Nano)
+	default:
+		c.latest = fmt.Sprintf("%v", v)
+	}
+}
+
+// Commit persists the new high-water mark. It must only be called once
+// every row of the run has been delivered.
+func (c *Cursor) Commit() error {
+	if c.latest == "" {
+		return nil
+	}
+	return c.store.Set(c.pipelineID, CursorKey, c.latest)
+}
+
+// Lookback moves a high-water mark back by lookback, to pick up rows that
+// were committed late. Numeric marks are subtracted exactly, so bigint
+// cursors beyond 2^53 keep their precision.
+func Lookback(highWater, lookback string) (string, error) {
+	if lookback == "" {
+		return highWater, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, highWater); err == nil {
+		d, err := time.ParseDuration(lookback)
+		if err != nil {
+			return "", fmt.Errorf("invalid cursor lookback %q for a timestamp cursor: %v", lookback, err)
+		}
+		return t.Add(-d).Format(time.RFC3339Nano), nil
+	}
+	if n, ok := new(big.Int).SetString(highWater, 10); ok {
+		if back, ok := new(big.Int).SetString(lookback, 10); ok {
+			return n.Sub(n, back).String(), nil
+		}
+	}
+	if n, ok := new(big.Rat).SetString(highWater); ok && isDecimal(highWater) {
+		back, ok := new(big.Rat).SetString(lookback)
+		if !ok || !isDecimal(lookback) {
+			return "", fmt.Errorf("invalid cursor lookback %q for a numeric cursor", lookback)
+		}
+		return n.Sub(n, back).FloatString(max(decimals(highWater), decimals(lookback))), nil
+	}
+	return "", fmt.Errorf("cursor lookback is only supported for timestamp and numeric cursors")
+}
+
+// isDecimal rejects the fractions big.Rat also reads, such as 1/3.
+func isDecimal(s string) bool {
+	return !strings.Contains(s, "/")
+}
+
+// decimals counts the digits after the decimal point of a plain decimal.
+func decimals(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 && !strings.ContainsAny(s, "eE") {
+		return len(s) - i - 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supabase-community/supabase-go"
+)
+
+const table = "PipelineState"
+
+// Store persists small per-pipeline values between runs, such as the
+// high-water mark of an incremental sync.
+type Store struct {
+	client *supabase.Client
+}
+
+type entry struct {
+	PipelineID string    `json:"pipeline_id"`
+	Key        string    `json:"key"`
+	Value      string    `json:"value"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func New(client *supabase.Client) *Store {
+	return &Store{client: client}
+}
+
+// Get returns the stored value and whether one exists.
+func (s *Store) Get(pipelineID, key string) (string, bool, error) {
+	var entries []entry
+	_, err := s.client.From(table).Select("*", "", false).Eq("pipeline_id", pipelineID).Eq("key", key).ExecuteTo(&entries)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s state of pipeline %s: %v", key, pipelineID, err)
+	}
+	if len(entries) == 0 {
+		return "", false, nil
+	}
+	return entries[0].Value, true, nil
+}
+
+func (s *Store) Set(pipelineID, key, value string) error {
+	row := entry{PipelineID: pipelineID, Key: key, Value: value, UpdatedAt: time.Now().UTC()}
+	_, _, err := s.client.From(table).Upsert(row, "pipeline_id,key", "minimal", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to save %s state of pipeline %s: %v", key, pipelineID, err)
+	}
+	return nil
+}
+
+func (s *Store) Delete(pipelineID, key string) error {
+	_, _, err := s.client.From(table).Delete("minimal", "").Eq("pipeline_id", pipelineID).Eq("key", key).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete %s state of pipeline %s: %v", key, pipelineID, err)
+	}
+	return nil
+}
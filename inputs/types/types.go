@@ -1,6 +1,55 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 type ConfigType struct {
 	Settings map[string]interface{}
-	Secrets map[string]interface{}
-}
\ No newline at end of file
+	Secrets  map[string]interface{}
+}
+
+func (c *ConfigType) Setting(key string) string {
+	return lookup(c.Settings, key)
+}
+
+func (c *ConfigType) Secret(key string) string {
+	return lookup(c.Secrets, key)
+}
+
+// SettingInt returns the setting parsed as an integer, or def when it is
+// unset or malformed.
+func (c *ConfigType) SettingInt(key string, def int) int {
+	n, err := strconv.Atoi(c.Setting(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func lookup(m map[string]interface{}, key string) string {
+	if m == nil || m[key] == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", m[key])
+}
+
+// Column describes a source column found by schema discovery. Type is the
+// source's own name for the column type. PrimaryKey is only set by sources
+// that declare primary keys.
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primary_key"`
+}
+
+// Preview is a sample of what an input would write for its current
+// configuration: the columns of the result and the values of the first
+// messages, exactly as they would be put on the bus.
+type Preview struct {
+	Columns []Column          `json:"columns"`
+	Rows    []json.RawMessage `json:"rows"`
+}
@@ -9,6 +9,7 @@ import (
 	"retl/inputs/types"
 	"strings"
 
+	"github.com/google/uuid"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -44,6 +45,16 @@ func RunOrchestration(connectorType string, connectorName string, conf *types.Co
 		Name: "PIPELINE_NAME",
 		Value: pipelineName,
 	})
+	envVariablesForSpec = append(envVariablesForSpec, corev1.EnvVar{
+		Name: "RUN_ID",
+		Value: uuid.New().String(),
+	})
+	for _, name := range []string{"SUPABASE_API_URL", "SUPABASE_API_KEY"} {
+		envVariablesForSpec = append(envVariablesForSpec, corev1.EnvVar{
+			Name: name,
+			Value: os.Getenv(name),
+		})
+	}
 	for key, value := range conf.Settings {
 		envVariablesForSpec = append(envVariablesForSpec, corev1.EnvVar{
 			Name: key,
@@ -56,7 +67,6 @@ func RunOrchestration(connectorType string, connectorName string, conf *types.Co
 			Value: fmt.Sprintf("%v", value),
 		})
 	}
-	fmt.Println(envVariablesForSpec)
 	fmt.Println(connectorType)
 	var image string
 	if connectorType == "Input" {
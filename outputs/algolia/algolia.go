@@ -1,22 +1,36 @@
 package algolia
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"retl/envelope"
+	"retl/outputs/consumer"
+	"retl/outputs/mapping"
+	"retl/outputs/ratelimit"
+	"retl/outputs/retry"
 	"retl/outputs/types"
+	"strings"
 	"time"
 
+	"github.com/algolia/algoliasearch-client-go/v3/algolia/compression"
+	"github.com/algolia/algoliasearch-client-go/v3/algolia/errs"
+	"github.com/algolia/algoliasearch-client-go/v3/algolia/opt"
 	"github.com/algolia/algoliasearch-client-go/v3/algolia/search"
+	"github.com/algolia/algoliasearch-client-go/v3/algolia/transport"
 	"github.com/segmentio/kafka-go"
 )
 
 type Algolia struct {
-	Conf *types.ConfigType
+	Conf    *types.ConfigType
+	index   *search.Index
+	retry   retry.Policy
+	limiter *ratelimit.Limiter
+	mapping *mapping.Mapping
 }
 
 var LastRunTime time.Time
@@ -24,79 +38,276 @@ var LastRunTime time.Time
 func (a *Algolia) Run() error {
 
 	fmt.Println("ENTERED RUN FUNC")
-	keypair, err := tls.LoadX509KeyPair("service.cert", "service.key")
+	reader, err := consumer.New(a.Conf, "algolia-consumer-group")
 	if err != nil {
-		log.Fatalf("Failed to load Access Key and/or Access Certificate: %s", err)
+		return err
 	}
 
-	caCert, err := os.ReadFile("ca.pem")
+	a.mapping, err = mapping.Parse(a.Conf.Setting("field_mapping"))
 	if err != nil {
-		log.Fatalf("Failed to read CA Certificate file: %s", err)
-	}
-
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(caCert)
-	if !ok {
-		log.Fatalf("Failed to parse CA Certificate file: %s", err)
-	}
-
-	dialer := &kafka.Dialer{
-		Timeout:   10 * time.Second,
-		DualStack: true,
-		TLS: &tls.Config{
-			Certificates: []tls.Certificate{keypair},
-			RootCAs:      caCertPool,
-		},
-	}
-
-	brokerAddress := "kafka-297becac-sjsu-f7b6.k.aivencloud.com:11921"
-	topic := "aneesh_2"
-	partition := 0
-
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{brokerAddress},
-		Topic:          topic,
-		Partition:      partition,
-		Dialer:         dialer,
-		StartOffset:    kafka.LastOffset, 
-		GroupID:        "algolia-consumer-group", 
-		MinBytes:       10e3, 
-		MaxBytes:       10e6, 
-		CommitInterval: time.Second, 
-	})
-
-	client := search.NewClient(os.Getenv("ALGOLIA_APP_ID"), os.Getenv("ALGOLIA_API_KEY"))
-	index := client.InitIndex(os.Getenv("ALGOLIA_INDEX"))
+		return err
+	}
+	a.index = a.initIndex()
+	a.retry = retry.NewPolicy(a.Conf)
+	a.limiter = ratelimit.New(a.Conf)
 
-	fmt.Println(client)
-	fmt.Println(index)
 	fmt.Println(os.Getenv("ALGOLIA_APP_ID"))
 	fmt.Println(os.Getenv("ALGOLIA_INDEX"))
 
-	for {
-		msg, err := reader.ReadMessage(context.TODO())
+	return reader.Run(context.Background(), a.indexBatch)
+}
+
+// indexBatch applies the upserts, patches and deletes of a batch in runs
+// of the same operation, in offset order, so an object deleted after it
+// was upserted in the same batch stays deleted and vice versa.
+func (a *Algolia) indexBatch(ctx context.Context, msgs []kafka.Message) ([]consumer.Rejection, error) {
+	var rejected []consumer.Rejection
+	for start := 0; start < len(msgs); {
+		op := envelope.Op(msgs[start])
+		end := start + 1
+		for end < len(msgs) && envelope.Op(msgs[end]) == op {
+			end++
+		}
+		var run []consumer.Rejection
+		var err error
+		switch op {
+		case envelope.OpDelete:
+			run, err = a.deleteBatch(ctx, msgs[start:end])
+		case envelope.OpPatch:
+			run, err = a.saveBatch(ctx, msgs[start:end], true)
+		default:
+			run, err = a.saveBatch(ctx, msgs[start:end], false)
+		}
 		if err != nil {
-			log.Fatalf("Failed to read message: %s", err)
+			return nil, err
 		}
+		rejected = append(rejected, run...)
+		start = end
+	}
+	return rejected, nil
+}
 
-		fmt.Println(string(msg.Value))
-		var document map[string]interface{}
-		err = json.Unmarshal(msg.Value, &document)
+// saveBatch indexes the documents of upsert events. Patches only update
+// the attributes they carry and keep the others of the object.
+func (a *Algolia) saveBatch(ctx context.Context, msgs []kafka.Message, patch bool) ([]consumer.Rejection, error) {
+	var rejected []consumer.Rejection
+	var documents []map[string]interface{}
+	var sources []kafka.Message
+	for _, msg := range msgs {
+		document, err := a.document(msg, patch)
 		if err != nil {
-			log.Printf("Failed to unmarshal Kafka message: %s", err)
+			rejected = append(rejected, consumer.Rejection{Message: msg, Err: err, Attempts: 1})
 			continue
 		}
+		documents = append(documents, document)
+		sources = append(sources, msg)
+	}
+	if len(documents) == 0 {
+		return rejected, nil
+	}
 
-		if _, exists := document["objectID"]; string(msg.Key) == "algolia" && !exists {
-			document["objectID"] = fmt.Sprintf("%s-%d", msg.Key, msg.Offset)
+	attempts, err := a.retry.Do(ctx, func() error {
+		return a.limiter.Do(ctx, len(documents), func() error {
+			ctx, after := retry.WithRetryAfter(ctx)
+			var err error
+			if patch {
+				_, err = a.index.PartialUpdateObjects(documents, opt.CreateIfNotExists(true), ctx)
+			} else {
+				_, err = a.index.SaveObjects(documents, ctx)
+			}
+			return classify(err, *after)
+		})
+	})
+	if err == nil {
+		log.Printf("Successfully indexed %d documents in Algolia", len(documents))
+		return rejected, nil
+	}
+	if retry.IsExhausted(err) {
+		for _, msg := range sources {
+			rejected = append(rejected, consumer.Rejection{Message: msg, Err: err, Attempts: attempts})
+		}
+		return rejected, nil
+	}
+	if !retry.IsPermanent(err) {
+		return nil, fmt.Errorf("failed to index documents in Algolia: %v", err)
+	}
+
+	// Algolia rejects the whole batch for a single invalid document, so
+	// index them one by one to find out which ones to dead-letter.
+	for i, document := range documents {
+		attempts, err := a.retry.Do(ctx, func() error {
+			return a.limiter.Do(ctx, 1, func() error {
+				ctx, after := retry.WithRetryAfter(ctx)
+				var err error
+				if patch {
+					_, err = a.index.PartialUpdateObject(document, opt.CreateIfNotExists(true), ctx)
+				} else {
+					_, err = a.index.SaveObject(document, ctx)
+				}
+				return classify(err, *after)
+			})
+		})
+		if err == nil {
+			continue
+		}
+		if !retry.IsPermanent(err) && !retry.IsExhausted(err) {
+			return nil, fmt.Errorf("failed to index document in Algolia: %v", err)
 		}
+		rejected = append(rejected, consumer.Rejection{Message: sources[i], Err: err, Attempts: attempts})
+	}
+	return rejected, nil
+}
 
-		_, err = index.SaveObject(document)
+// document builds the Algolia object of an upsert or patch event, mapping
+// its fields and identifying it by its source key when the mapping sets no
+// objectID.
+func (a *Algolia) document(msg kafka.Message, patch bool) (map[string]interface{}, error) {
+	document, err := decode(msg.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Kafka message: %v", err)
+	}
+	if document == nil {
+		return nil, fmt.Errorf("Kafka message is not a JSON object")
+	}
+	if a.mapping != nil {
+		if patch {
+			document, err = a.mapping.ApplyPatch(document)
+		} else {
+			document, err = a.mapping.Apply(document)
+		}
 		if err != nil {
-			log.Printf("Failed to index document in Algolia: %s", err)
-			return err
+			return nil, err
+		}
+	}
+
+	if _, exists := document["objectID"]; !exists {
+		if key := envelope.Header(msg, envelope.KeyHeader); key != "" {
+			document["objectID"] = key
+		} else if string(msg.Key) == "algolia" {
+			document["objectID"] = fmt.Sprintf("%s-%d", msg.Key, msg.Offset)
 		}
+	}
+	return document, nil
+}
+
+// decode reads a record keeping its numbers as json.Number, so large
+// integers and exact decimals reach the mapping and the index unchanged.
+func decode(value []byte) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// initIndex sends requests through retry.Transport, since Algolia's errors
+// leave out the Retry-After header of throttled responses.
+func (a *Algolia) initIndex() *search.Index {
+	client := search.NewClientWithConfig(search.Configuration{
+		AppID:       a.Conf.Secret("app_id"),
+		APIKey:      a.Conf.Secret("api_key"),
+		Compression: compression.None,
+		Requester: requester{&http.Client{
+			Transport: &retry.Transport{Base: transport.DefaultHTTPClient().Transport},
+		}},
+	})
+	return client.InitIndex(a.Conf.Setting("index"))
+}
+
+type requester struct {
+	client *http.Client
+}
+
+func (r requester) Request(req *http.Request) (*http.Response, error) {
+	return r.client.Do(req)
+}
+
+// Catalogue lists the attributes the index settings refer to. Algolia
+// indexes are schemaless, so mapped fields outside the catalogue are
+// allowed, and objectID falls back to the record's source key.
+func (a *Algolia) Catalogue(ctx context.Context) (*mapping.Catalogue, error) {
+	settings, err := a.initIndex().GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Algolia index settings: %v", err)
+	}
+	catalogue := &mapping.Catalogue{Fields: []mapping.DestinationField{{Name: "objectID", Type: mapping.String}}}
+	seen := map[string]bool{"objectID": true}
+	var attributes []string
+	if settings.SearchableAttributes != nil {
+		attributes = append(attributes, settings.SearchableAttributes.Get()...)
+	}
+	if settings.AttributesForFaceting != nil {
+		attributes = append(attributes, settings.AttributesForFaceting.Get()...)
+	}
+	if settings.CustomRanking != nil {
+		attributes = append(attributes, settings.CustomRanking.Get()...)
+	}
+	for _, attribute := range attributes {
+		// Settings wrap attributes in modifiers such as unordered(title)
+		// or desc(popularity), and searchable attributes of equal
+		// priority share an entry.
+		if i := strings.IndexByte(attribute, '('); i >= 0 && strings.HasSuffix(attribute, ")") {
+			attribute = attribute[i+1 : len(attribute)-1]
+		}
+		for _, name := range strings.Split(attribute, ",") {
+			if name = strings.TrimSpace(name); name != "" && !seen[name] {
+				seen[name] = true
+				catalogue.Fields = append(catalogue.Fields, mapping.DestinationField{Name: name})
+			}
+		}
+	}
+	return catalogue, nil
+}
+
+// deleteBatch removes the objects of delete events. The object ID is the
+// deleted record's objectID, after field mapping, when it has one, and its
+// source key otherwise, matching how upserted documents are identified.
+func (a *Algolia) deleteBatch(ctx context.Context, msgs []kafka.Message) ([]consumer.Rejection, error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	objectIDs := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		record, err := decode(msg.Value)
+		if err == nil && record != nil && a.mapping != nil {
+			record, err = a.mapping.Apply(record)
+		}
+		if err == nil && record["objectID"] != nil {
+			objectIDs = append(objectIDs, fmt.Sprintf("%v", record["objectID"]))
+		} else {
+			objectIDs = append(objectIDs, envelope.Header(msg, envelope.KeyHeader))
+		}
+	}
+
+	attempts, err := a.retry.Do(ctx, func() error {
+		return a.limiter.Do(ctx, len(objectIDs), func() error {
+			ctx, after := retry.WithRetryAfter(ctx)
+			_, err := a.index.DeleteObjects(objectIDs, ctx)
+			return classify(err, *after)
+		})
+	})
+	if err == nil {
+		log.Printf("Successfully deleted %d documents from Algolia", len(objectIDs))
+		return nil, nil
+	}
+	if !retry.IsPermanent(err) && !retry.IsExhausted(err) {
+		return nil, fmt.Errorf("failed to delete documents from Algolia: %v", err)
+	}
+	rejected := make([]consumer.Rejection, len(msgs))
+	for i, msg := range msgs {
+		rejected[i] = consumer.Rejection{Message: msg, Err: err, Attempts: attempts}
+	}
+	return rejected, nil
+}
 
-		log.Printf("Successfully indexed document in Algolia: %v", document)
+// classify attaches the HTTP status of Algolia API errors, and the
+// Retry-After the response came with, so the retry policy can tell
+// throttling and outages apart from invalid documents.
+func classify(err error, retryAfter time.Duration) error {
+	if e, ok := errs.IsAlgoliaErr(err); ok {
+		return &retry.StatusError{StatusCode: e.Status, RetryAfter: retryAfter, Err: err}
 	}
+	return err
 }
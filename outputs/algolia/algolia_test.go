@@ -0,0 +1,85 @@
+package algolia
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"retl/envelope"
+	"retl/outputs/mapping"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		value   string
+		key     string
+		want    string
+		err     string
+	}{
+		{
+			name:    "integer cast to a string object ID",
+			mapping: `[{"target": "objectID", "source": "id", "type": "string"}]`,
+			value:   `{"id": 1234567}`,
+			want:    `{"objectID":"1234567"}`,
+		},
+		{
+			name:    "large integer keeps its precision",
+			mapping: `[{"target": "objectID", "source": "id", "type": "string"}, {"target": "n", "source": "n", "type": "integer"}]`,
+			value:   `{"id": 1, "n": 9007199254740993}`,
+			want:    `{"n":9007199254740993,"objectID":"1"}`,
+		},
+		{
+			name:  "unmapped decimal passes through unchanged",
+			value: `{"amount": 12345678901234567890.123}`,
+			key:   "k1",
+			want:  `{"amount":12345678901234567890.123,"objectID":"k1"}`,
+		},
+		{
+			name:  "not an object",
+			value: `null`,
+			err:   "not a JSON object",
+		},
+		{
+			name:  "invalid JSON",
+			value: `{"id":`,
+			err:   "failed to unmarshal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Algolia{}
+			if tt.mapping != "" {
+				m, err := mapping.Parse(tt.mapping)
+				if err != nil {
+					t.Fatal(err)
+				}
+				a.mapping = m
+			}
+			msg := kafka.Message{Value: []byte(tt.value)}
+			if tt.key != "" {
+				msg.Headers = []kafka.Header{{Key: envelope.KeyHeader, Value: []byte(tt.key)}}
+			}
+			document, err := a.document(msg, false)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
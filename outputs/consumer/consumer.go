@@ -0,0 +1,286 @@
+package consumer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"retl/db"
+	"retl/envelope"
+	"retl/outputs/deadletter"
+	"retl/outputs/types"
+	"retl/transform"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	brokerAddress = "kafka-297becac-sjsu-f7b6.k.aivencloud.com:11921"
+	topic         = "aneesh_2"
+)
+
+// Rejection is a record the destination refused for a reason that retrying
+// will not fix. Rejected records are dead-lettered instead of blocking the
+// pipeline, as the message originally read from the topic, so replaying
+// them runs the pipeline's transforms again from the start.
+type Rejection struct {
+	Message  kafka.Message
+	Err      error
+	Attempts int
+}
+
+// Handler delivers a batch to the destination. Offsets for the batch are
+// committed only when it returns a nil error, after any rejections have been
+// stored in the dead-letter queue.
+type Handler func(ctx context.Context, msgs []kafka.Message) ([]Rejection, error)
+
+// reader is the part of *kafka.Reader the consumer uses.
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// deadLetterQueue stores the records a destination rejected.
+type deadLetterQueue interface {
+	Add(entries ...deadletter.Entry) error
+}
+
+// Consumer reads the pipeline topic with manual offset commits, giving
+// at-least-once delivery: a batch that is not acknowledged by the
+// destination is fetched again from the last committed offset.
+type Consumer struct {
+	newReader    func() reader
+	reader       reader
+	batchSize    int
+	batchTimeout time.Duration
+	retryBackoff time.Duration
+	deadLetters  deadLetterQueue
+	transform    *transform.Transform
+}
+
+func New(conf *types.ConfigType, groupID string) (*Consumer, error) {
+	tlsConfig, err := loadTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	dbClient, err := db.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset := kafka.FirstOffset
+	switch conf.Setting("start_offset") {
+	case "", "earliest":
+	case "latest":
+		startOffset = kafka.LastOffset
+	default:
+		return nil, fmt.Errorf("invalid start offset %q, expected earliest or latest", conf.Setting("start_offset"))
+	}
+
+	t, err := transform.Parse(conf.Setting("transforms"))
+	if err != nil {
+		return nil, err
+	}
+
+	config := kafka.ReaderConfig{
+		Brokers: []string{brokerAddress},
+		Topic:   topic,
+		GroupID: groupID,
+		Dialer: &kafka.Dialer{
+			Timeout:   10 * time.Second,
+			DualStack: true,
+			TLS:       tlsConfig,
+		},
+		// Only applies when the group has no committed offset yet.
+		StartOffset: startOffset,
+		MinBytes:    10e3,
+		MaxBytes:    10e6,
+	}
+	c := &Consumer{
+		newReader:    func() reader { return kafka.NewReader(config) },
+		batchSize:    conf.SettingInt("batch_size", 100),
+		batchTimeout: time.Duration(conf.SettingInt("batch_timeout_ms", 1000)) * time.Millisecond,
+		retryBackoff: 5 * time.Second,
+		deadLetters:  deadletter.New(dbClient),
+		transform:    t,
+	}
+	c.reader = c.newReader()
+	return c, nil
+}
+
+func loadTLS() (*tls.Config, error) {
+	keypair, err := tls.LoadX509KeyPair("service.cert", "service.key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Access Key and/or Access Certificate: %v", err)
+	}
+
+	caCert, err := os.ReadFile("ca.pem")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA Certificate file: %v", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA Certificate file")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{keypair},
+		RootCAs:      caCertPool,
+	}, nil
+}
+
+// Run fetches batches and hands them to handle until ctx is cancelled.
+func (c *Consumer) Run(ctx context.Context, handle Handler) error {
+	defer func() { c.reader.Close() }()
+	for {
+		batch, err := c.fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		msgs, rejected := c.transformBatch(batch)
+		if len(msgs) > 0 {
+			var handled []Rejection
+			handled, err = handle(ctx, msgs)
+			rejected = append(rejected, originals(batch, handled)...)
+		}
+		if err == nil {
+			err = c.deadLetter(rejected)
+		}
+		if err != nil {
+			log.Printf("Failed to deliver batch of %d messages, retrying from last committed offset: %s", len(batch), err)
+			if err := c.rewind(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := c.reader.CommitMessages(ctx, batch...); err != nil {
+			return fmt.Errorf("failed to commit offsets: %v", err)
+		}
+	}
+}
+
+// transformBatch runs the pipeline's transforms on copies of the messages
+// for the destination, leaving the batch as read. Messages a filter drops
+// are left out but still committed with the batch; messages the
+// transforms fail on are rejected.
+// Deletes carry only the key columns and skip the filters and any step
+// that fails on them, so a deleted record always reaches the destination.
+func (c *Consumer) transformBatch(batch []kafka.Message) ([]kafka.Message, []Rejection) {
+	if c.transform == nil {
+		return batch, nil
+	}
+	msgs := make([]kafka.Message, 0, len(batch))
+	var rejected []Rejection
+	for _, msg := range batch {
+		if len(msg.Value) == 0 {
+			msgs = append(msgs, msg)
+			continue
+		}
+		value, keep, err := c.transformMessage(msg)
+		if err != nil {
+			rejected = append(rejected, Rejection{Message: msg, Err: fmt.Errorf("failed to transform record: %v", err), Attempts: 1})
+			continue
+		}
+		if !keep {
+			continue
+		}
+		transformed := msg
+		transformed.Value = value
+		msgs = append(msgs, transformed)
+	}
+	return msgs, rejected
+}
+
+// originals points rejections of transformed messages back at the
+// messages of the batch they were made from.
+func originals(batch []kafka.Message, rejected []Rejection) []Rejection {
+	type position struct {
+		partition int
+		offset    int64
+	}
+	read := make(map[position]kafka.Message, len(batch))
+	for _, msg := range batch {
+		read[position{msg.Partition, msg.Offset}] = msg
+	}
+	for i, r := range rejected {
+		if msg, ok := read[position{r.Message.Partition, r.Message.Offset}]; ok {
+			rejected[i].Message = msg
+		}
+	}
+	return rejected
+}
+
+func (c *Consumer) transformMessage(msg kafka.Message) ([]byte, bool, error) {
+	record, err := transform.Decode(msg.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	keep := true
+	if envelope.Op(msg) == envelope.OpDelete {
+		c.transform.Fields(record)
+	} else {
+		keep, err = c.transform.Apply(record)
+	}
+	if err != nil || !keep {
+		return nil, keep, err
+	}
+	value, err := json.Marshal(record)
+	return value, true, err
+}
+
+func (c *Consumer) deadLetter(rejected []Rejection) error {
+	entries := make([]deadletter.Entry, 0, len(rejected))
+	for _, r := range rejected {
+		log.Printf("Dead-lettering message at offset %d: %s", r.Message.Offset, r.Err)
+		entries = append(entries, deadletter.NewEntry(r.Message, r.Err, r.Attempts))
+	}
+	return c.deadLetters.Add(entries...)
+}
+
+// fetch blocks for the first message, then collects more until the batch is
+// full or the batch timeout elapses.
+func (c *Consumer) fetch(ctx context.Context) ([]kafka.Message, error) {
+	msg, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %v", err)
+	}
+	batch := []kafka.Message{msg}
+
+	lingerCtx, cancel := context.WithTimeout(ctx, c.batchTimeout)
+	defer cancel()
+	for len(batch) < c.batchSize {
+		msg, err := c.reader.FetchMessage(lingerCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			break
+		}
+		batch = append(batch, msg)
+	}
+	return batch, nil
+}
+
+// rewind drops the reader's in-memory position so the next fetch resumes
+// from the group's last committed offset.
+func (c *Consumer) rewind(ctx context.Context) error {
+	if err := c.reader.Close(); err != nil {
+		log.Printf("Failed to close Kafka reader: %s", err)
+	}
+	select {
+	case <-time.After(c.retryBackoff):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.reader = c.newReader()
+	return nil
+}
@@ -0,0 +1,249 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"retl/outputs/deadletter"
+	"retl/transform"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestTransformBatch(t *testing.T) {
+	tr, err := transform.New([]transform.Step{
+		{Filter: "amount > 0"},
+		{Field: "label", Expression: `"n" + string(id)`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Consumer{transform: tr}
+	batch := []kafka.Message{
+		{Offset: 1, Value: []byte(`{"id": 1, "amount": 12345678901234567890.123}`)},
+		{Offset: 2, Value: []byte(`{"id": 2, "amount": 0}`)},
+		{Offset: 3, Value: []byte(`{"id":`)},
+		{Offset: 4},
+	}
+	msgs, rejected := c.transformBatch(batch)
+
+	if len(msgs) != 2 || msgs[0].Offset != 1 || msgs[1].Offset != 4 {
+		t.Fatalf("got messages %v, want offsets 1 and 4", msgs)
+	}
+	if got, want := string(msgs[0].Value), `{"amount":12345678901234567890.123,"id":1,"label":"n1"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := string(batch[0].Value), `{"id": 1, "amount": 12345678901234567890.123}`; got != want {
+		t.Errorf("transforming changed the batch to %s", got)
+	}
+	if len(rejected) != 1 || rejected[0].Message.Offset != 3 {
+		t.Errorf("got rejections %v, want offset 3", rejected)
+	}
+}
+
+func TestOriginals(t *testing.T) {
+	batch := []kafka.Message{
+		{Partition: 0, Offset: 5, Value: []byte(`{"id": 1}`)},
+		{Partition: 1, Offset: 5, Value: []byte(`{"id": 2}`)},
+	}
+	rejected := originals(batch, []Rejection{
+		{Message: kafka.Message{Partition: 1, Offset: 5, Value: []byte(`{"id":2,"label":"n2"}`)}, Err: errors.New("invalid"), Attempts: 3},
+	})
+	if len(rejected) != 1 || string(rejected[0].Message.Value) != `{"id": 2}` || rejected[0].Attempts != 3 {
+		t.Errorf("got %v, want the original message of partition 1", rejected)
+	}
+}
+
+// partition is an in-memory topic partition whose readers start from the
+// last committed offset, as readers of a consumer group do.
+type partition struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	committed int64
+	readers   int
+	closed    int
+}
+
+func newPartition(n int) *partition {
+	p := &partition{}
+	for i := 0; i < n; i++ {
+		p.msgs = append(p.msgs, kafka.Message{Offset: int64(i), Value: []byte(`{}`)})
+	}
+	return p
+}
+
+func (p *partition) newReader() reader {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers++
+	return &partitionReader{p: p, next: p.committed}
+}
+
+type partitionReader struct {
+	p    *partition
+	next int64
+}
+
+func (r *partitionReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.p.mu.Lock()
+	if r.next < int64(len(r.p.msgs)) {
+		msg := r.p.msgs[r.next]
+		r.next++
+		r.p.mu.Unlock()
+		return msg, nil
+	}
+	r.p.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *partitionReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	for _, msg := range msgs {
+		if msg.Offset >= r.p.committed {
+			r.p.committed = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *partitionReader) Close() error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.p.closed++
+	return nil
+}
+
+// queue is a dead-letter queue that fails the first failures calls.
+type queue struct {
+	entries  []deadletter.Entry
+	failures int
+}
+
+func (q *queue) Add(entries ...deadletter.Entry) error {
+	if q.failures > 0 {
+		q.failures--
+		return errors.New("unavailable")
+	}
+	q.entries = append(q.entries, entries...)
+	return nil
+}
+
+func offsets(msgs []kafka.Message) []int64 {
+	var out []int64
+	for _, msg := range msgs {
+		out = append(out, msg.Offset)
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	tests := []struct {
+		name string
+		// handle is called with the number of the call, from 1.
+		handle      func(call int, msgs []kafka.Message) ([]Rejection, error)
+		failures    int
+		batches     [][]int64
+		deadLetters []int64
+		committed   int64
+		readers     int
+	}{
+		{
+			name:      "commits delivered batches",
+			handle:    func(int, []kafka.Message) ([]Rejection, error) { return nil, nil },
+			batches:   [][]int64{{0, 1}, {2}},
+			committed: 3,
+			readers:   1,
+		},
+		{
+			name: "rewinds a failed batch",
+			handle: func(call int, msgs []kafka.Message) ([]Rejection, error) {
+				if call == 1 {
+					return nil, unavailable
+				}
+				return nil, nil
+			},
+			batches:   [][]int64{{0, 1}, {0, 1}, {2}},
+			committed: 3,
+			readers:   2,
+		},
+		{
+			name: "dead-letters rejections and commits",
+			handle: func(call int, msgs []kafka.Message) ([]Rejection, error) {
+				if call == 1 {
+					return []Rejection{{Message: msgs[1], Err: errors.New("invalid"), Attempts: 1}}, nil
+				}
+				return nil, nil
+			},
+			batches:     [][]int64{{0, 1}, {2}},
+			deadLetters: []int64{1},
+			committed:   3,
+			readers:     1,
+		},
+		{
+			name: "rewinds when rejections cannot be stored",
+			handle: func(call int, msgs []kafka.Message) ([]Rejection, error) {
+				if call <= 2 {
+					return []Rejection{{Message: msgs[0], Err: errors.New("invalid"), Attempts: 1}}, nil
+				}
+				return nil, nil
+			},
+			failures:    1,
+			batches:     [][]int64{{0, 1}, {0, 1}, {2}},
+			deadLetters: []int64{0},
+			committed:   3,
+			readers:     2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPartition(3)
+			q := &queue{failures: tt.failures}
+			c := &Consumer{
+				newReader:    p.newReader,
+				batchSize:    2,
+				batchTimeout: 10 * time.Millisecond,
+				deadLetters:  q,
+			}
+			c.reader = c.newReader()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var batches [][]int64
+			err := c.Run(ctx, func(ctx context.Context, msgs []kafka.Message) ([]Rejection, error) {
+				batches = append(batches, offsets(msgs))
+				if len(batches) == len(tt.batches) {
+					cancel()
+				}
+				return tt.handle(len(batches), msgs)
+			})
+			if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+				t.Fatalf("got error %v, want the cancellation", err)
+			}
+
+			if !reflect.DeepEqual(batches, tt.batches) {
+				t.Errorf("got batches %v, want %v", batches, tt.batches)
+			}
+			var deadLetters []int64
+			for _, e := range q.entries {
+				deadLetters = append(deadLetters, e.Offset)
+			}
+			if !reflect.DeepEqual(deadLetters, tt.deadLetters) {
+				t.Errorf("dead-lettered offsets %v, want %v", deadLetters, tt.deadLetters)
+			}
+			if p.committed != tt.committed {
+				t.Errorf("committed up to offset %d, want %d", p.committed, tt.committed)
+			}
+			if p.readers != tt.readers || p.closed != tt.readers {
+				t.Errorf("opened %d readers and closed %d, want %d", p.readers, p.closed, tt.readers)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package deadletter
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+)
+
+const table = "DeadLetters"
+
+// AttemptsHeader carries how many times a record has already been rejected,
+// so a replayed record that fails again is stored with an incremented count.
+const AttemptsHeader = "retl-attempts"
+
+// Entry is a record a destination rejected, stored with its original Kafka
+// envelope so it can be replayed once the cause is fixed.
+type Entry struct {
+	ID         string            `json:"id,omitempty"`
+	PipelineID string            `json:"pipeline_id"`
+	Error      string            `json:"error"`
+	Attempts   int               `json:"attempts"`
+	Topic      string            `json:"topic"`
+	Partition  int               `json:"partition"`
+	Offset     int64             `json:"offset"`
+	Key        string            `json:"key"`
+	Value      string            `json:"value"`
+	Headers    map[string]string `json:"headers"`
+	Replayed   bool              `json:"replayed"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// NewEntry records msg as rejected with cause after the given number of
+// delivery attempts in this run.
+func NewEntry(msg kafka.Message, cause error, attempts int) Entry {
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	previous, _ := strconv.Atoi(headers[AttemptsHeader])
+	if attempts < 1 {
+		attempts = 1
+	}
+	return Entry{
+		PipelineID: string(msg.Key),
+		Error:      cause.Error(),
+		Attempts:   previous + attempts,
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Key:        string(msg.Key),
+		Value:      string(msg.Value),
+		Headers:    headers,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// Message rebuilds the original envelope for replay.
+func (e Entry) Message() kafka.Message {
+	msg := kafka.Message{
+		Key:   []byte(e.Key),
+		Value: []byte(e.Value),
+	}
+	for k, v := range e.Headers {
+		if k == AttemptsHeader {
+			continue
+		}
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	msg.Headers = append(msg.Headers, kafka.Header{Key: AttemptsHeader, Value: []byte(strconv.Itoa(e.Attempts))})
+	return msg
+}
+
+type Queue struct {
+	client *supabase.Client
+}
+
+func New(client *supabase.Client) *Queue {
+	return &Queue{client: client}
+}
+
+func (q *Queue) Add(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, _, err := q.client.From(table).Insert(entries, false, "", "minimal", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to store %d dead letters: %v", len(entries), err)
+	}
+	return nil
+}
+
+// List returns the dead letters of a pipeline, oldest first. Replayed
+// entries are only included when includeReplayed is set.
+func (q *Queue) List(pipelineID string, includeReplayed bool) ([]Entry, error) {
+	fb := q.client.From(table).Select("*", "", false).Eq("pipeline_id", pipelineID)
+	if !includeReplayed {
+		fb = fb.Eq("replayed", "false")
+	}
+	var entries []Entry
+	_, err := fb.Order("created_at", &postgrest.OrderOpts{Ascending: true}).ExecuteTo(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %v", err)
+	}
+	return entries, nil
+}
+
+func (q *Queue) MarkReplayed(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, _, err := q.client.From(table).Update(map[string]interface{}{"replayed": true}, "minimal", "").In("id", ids).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to mark dead letters as replayed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Casts a field can convert its value to.
+const (
+	String  = "string"
+	Integer = "integer"
+	Number  = "number"
+	Boolean = "boolean"
+	// Timestamp renders times as RFC 3339 in UTC, UnixTimestamp as
+	// seconds since the epoch, which is what Algolia sorts and filters on.
+	Timestamp     = "timestamp"
+	UnixTimestamp = "unix_timestamp"
+)
+
+// Field fills one destination field, either from a source column or with
+// a constant.
+type Field struct {
+	// Target is the destination field. Dots nest it, as in geo.lat.
+	Target string `json:"target"`
+	// Source is the source column. Dots read into nested values, as in
+	// address.city.
+	Source string `json:"source,omitempty"`
+	// Constant is used when there is no source.
+	Constant interface{} `json:"constant,omitempty"`
+	// Type, when set, casts the value.
+	Type string `json:"type,omitempty"`
+	// Required rejects records where the value is missing or null.
+	// Otherwise such fields are left out.
+	Required bool `json:"required,omitempty"`
+}
+
+// Mapping builds destination records from source records. Source columns
+// that no field maps are left out.
+type Mapping struct {
+	Fields []Field
+}
+
+// Parse reads a mapping from its JSON form, a list of fields. An empty
+// config is no mapping, which leaves records as the input produced them.
+func Parse(config string) (*Mapping, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	var fields []Field
+	if err := json.Unmarshal([]byte(config), &fields); err != nil {
+		return nil, fmt.Errorf("invalid field mapping: %v", err)
+	}
+	m := &Mapping{Fields: fields}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// check finds mistakes that do not depend on the source or destination.
+func (m *Mapping) check() error {
+	targets := make(map[string]bool, len(m.Fields))
+	for i, f := range m.Fields {
+		if f.Target == "" {
+			return fmt.Errorf("field %d of the mapping has no target", i+1)
+		}
+		if targets[f.Target] {
+			return fmt.Errorf("field %s is mapped more than once", f.Target)
+		}
+		targets[f.Target] = true
+		if f.Source == "" && f.Constant == nil {
+			return fmt.Errorf("field %s needs a source or a constant", f.Target)
+		}
+		switch f.Type {
+		case "", String, Integer, Number, Boolean, Timestamp, UnixTimestamp:
+		default:
+			return fmt.Errorf("field %s has unknown type %q", f.Target, f.Type)
+		}
+	}
+	for target := range targets {
+		for prefix := target; strings.Contains(prefix, "."); {
+			prefix = prefix[:strings.LastIndexByte(prefix, '.')]
+			if targets[prefix] {
+				return fmt.Errorf("field %s is nested in field %s, which is also mapped", target, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply builds the destination record of a source record.
+func (m *Mapping) Apply(record map[string]interface{}) (map[string]interface{}, error) {
+	return m.apply(record, false)
+}
+
+// ApplyPatch builds the destination fields of a patch, which carries only
+// some of the source columns. Fields whose source column is not in the
+// record are left out rather than treated as missing.
+func (m *Mapping) ApplyPatch(record map[string]interface{}) (map[string]interface{}, error) {
+	return m.apply(record, true)
+}
+
+func (m *Mapping) apply(record map[string]interface{}, patch bool) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(m.Fields))
+	for _, f := range m.Fields {
+		v := f.Constant
+		if f.Source != "" {
+			if patch && !has(record, f.Source) {
+				continue
+			}
+			v = get(record, f.Source)
+		}
+		if v == nil {
+			if f.Required {
+				return nil, fmt.Errorf("required field %s is missing", f.Target)
+			}
+			continue
+		}
+		v, err := cast(v, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", f.Target, err)
+		}
+		set(out, f.Target, v)
+	}
+	return out, nil
+}
+
+func get(record map[string]interface{}, path string) interface{} {
+	// A column whose name contains dots wins over a nested value.
+	if v, ok := record[path]; ok {
+		return v
+	}
+	var v interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+func has(record map[string]interface{}, path string) bool {
+	if _, ok := record[path]; ok {
+		return true
+	}
+	var v interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func set(record map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := record[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			record[part] = next
+		}
+		record = next
+	}
+	record[parts[len(parts)-1]] = v
+}
+
+func cast(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "":
+		return v, nil
+	case String:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case float64:
+			// Whole numbers keep their digits rather than becoming
+			// 1.234567e+06.
+			if v == math.Trunc(v) && !math.IsInf(v, 0) {
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			}
+		case map[string]interface{}, []interface{}:
+			b, err := json.Marshal(v)
+			return string(b), err
+		}
+		return fmt.Sprint(v), nil
+	case Integer:
+		// Whole numbers beyond 2^53 do not survive a float64.
+		switch n := v.(type) {
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		f, err := number(v)
+		if err != nil {
+			return nil, err
+		}
+		if f != math.Trunc(f) {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, fmt.Errorf("%v is out of range for an integer", v)
+		}
+		return int64(f), nil
+	case Number:
+		return number(v)
+	case Boolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a boolean", v)
+			}
+			return b, nil
+		}
+		f, err := number(v)
+		if err != nil {
+			return nil, err
+		}
+		return f != 0, nil
+	case Timestamp, UnixTimestamp:
+		t, err := timestamp(v)
+		if err != nil {
+			return nil, err
+		}
+		if typ == UnixTimestamp {
+			return t.Unix(), nil
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+func number(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return f, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// timestamp reads the times inputs produce: RFC 3339 strings, dates, or
+// numbers of seconds since the epoch.
+func timestamp(v interface{}) (time.Time, error) {
+	if s, ok := v.(string); ok {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", time.DateOnly} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+	}
+	f, err := number(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v is not a timestamp", v)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
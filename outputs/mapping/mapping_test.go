@@ -0,0 +1,173 @@
+package mapping
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCast(t *testing.T) {
+	tests := []struct {
+		typ  string
+		in   interface{}
+		want interface{}
+		err  bool
+	}{
+		{typ: "", in: 1.5, want: 1.5},
+		{typ: String, in: "a", want: "a"},
+		{typ: String, in: 12.0, want: "12"},
+		{typ: String, in: 1234567.0, want: "1234567"},
+		{typ: String, in: 1.5, want: "1.5"},
+		{typ: String, in: json.Number("1234567"), want: "1234567"},
+		{typ: String, in: json.Number("12345678901234567890.5"), want: "12345678901234567890.5"},
+		{typ: String, in: true, want: "true"},
+		{typ: String, in: map[string]interface{}{"a": 1.0}, want: `{"a":1}`},
+		{typ: String, in: []interface{}{"x", 2.0}, want: `["x",2]`},
+		{typ: Integer, in: 3.0, want: int64(3)},
+		{typ: Integer, in: " 42 ", want: int64(42)},
+		{typ: Integer, in: json.Number("9007199254740993"), want: int64(9007199254740993)},
+		{typ: Integer, in: "9007199254740993", want: int64(9007199254740993)},
+		{typ: Integer, in: "1e3", want: int64(1000)},
+		{typ: Integer, in: 3.5, err: true},
+		{typ: Integer, in: json.Number("98765432109876543210"), err: true},
+		{typ: Integer, in: "three", err: true},
+		{typ: Number, in: "2.25", want: 2.25},
+		{typ: Number, in: json.Number("-1"), want: -1.0},
+		{typ: Number, in: true, want: 1.0},
+		{typ: Number, in: []interface{}{}, err: true},
+		{typ: Boolean, in: "true", want: true},
+		{typ: Boolean, in: "0", want: false},
+		{typ: Boolean, in: 2.0, want: true},
+		{typ: Boolean, in: "yes", err: true},
+		{typ: Timestamp, in: "2024-01-02T03:04:05+02:00", want: "2024-01-02T01:04:05Z"},
+		{typ: Timestamp, in: "2024-01-02 03:04:05.5", want: "2024-01-02T03:04:05.5Z"},
+		{typ: Timestamp, in: "2024-01-02", want: "2024-01-02T00:00:00Z"},
+		{typ: Timestamp, in: 1700000000.0, want: "2023-11-14T22:13:20Z"},
+		{typ: Timestamp, in: "next tuesday", err: true},
+		{typ: UnixTimestamp, in: "2023-11-14T22:13:20Z", want: int64(1700000000)},
+		{typ: UnixTimestamp, in: "1700000000", want: int64(1700000000)},
+		{typ: "uuid", in: "a", err: true},
+	}
+	for _, tt := range tests {
+		got, err := cast(tt.in, tt.typ)
+		if (err != nil) != tt.err {
+			t.Errorf("cast(%#v, %q) error = %v", tt.in, tt.typ, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("cast(%#v, %q) = %#v, want %#v", tt.in, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	m, err := Parse(`[
+		{"target": "objectID", "source": "id", "type": "string", "required": true},
+		{"target": "geo.lat", "source": "location.lat", "type": "number"},
+		{"target": "city", "source": "address.city"},
+		{"target": "kind", "constant": "user"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+		patch  bool
+		want   map[string]interface{}
+		err    string
+	}{
+		{
+			name: "nested source and target",
+			record: map[string]interface{}{
+				"id":       7.0,
+				"location": map[string]interface{}{"lat": "51.5"},
+				"address":  map[string]interface{}{"city": "London"},
+				"unmapped": true,
+			},
+			want: map[string]interface{}{
+				"objectID": "7",
+				"geo":      map[string]interface{}{"lat": 51.5},
+				"city":     "London",
+				"kind":     "user",
+			},
+		},
+		{
+			name:   "dotted column name wins over nesting",
+			record: map[string]interface{}{"id": "a", "address.city": "Paris", "address": map[string]interface{}{"city": "Rome"}},
+			want:   map[string]interface{}{"objectID": "a", "city": "Paris", "kind": "user"},
+		},
+		{
+			name:   "null optional field is left out",
+			record: map[string]interface{}{"id": "a", "address": nil},
+			want:   map[string]interface{}{"objectID": "a", "kind": "user"},
+		},
+		{
+			name:   "missing required field",
+			record: map[string]interface{}{"address": map[string]interface{}{"city": "Oslo"}},
+			err:    "required field objectID is missing",
+		},
+		{
+			name:   "failed cast",
+			record: map[string]interface{}{"id": "a", "location": map[string]interface{}{"lat": "north"}},
+			err:    "field geo.lat",
+		},
+		{
+			name:   "patch leaves out absent columns",
+			record: map[string]interface{}{"id": "a", "address": map[string]interface{}{"city": nil}},
+			patch:  true,
+			want:   map[string]interface{}{"objectID": "a", "kind": "user"},
+		},
+		{
+			name:   "patch without the required column",
+			record: map[string]interface{}{"location": map[string]interface{}{"lat": 1.0}},
+			patch:  true,
+			want:   map[string]interface{}{"geo": map[string]interface{}{"lat": 1.0}, "kind": "user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apply := m.Apply
+			if tt.patch {
+				apply = m.ApplyPatch
+			}
+			got, err := apply(tt.record)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{config: `[{"source": "a"}]`, err: "has no target"},
+		{config: `[{"target": "a", "source": "a"}, {"target": "a", "source": "b"}]`, err: "mapped more than once"},
+		{config: `[{"target": "a"}]`, err: "needs a source or a constant"},
+		{config: `[{"target": "a", "source": "a", "type": "date"}]`, err: "unknown type"},
+		{config: `[{"target": "a", "source": "a"}, {"target": "a.b", "source": "b"}]`, err: "nested in field a"},
+		{config: `{"target": "a"}`, err: "invalid field mapping"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%s) error = %v, want %q", tt.config, err, tt.err)
+		}
+	}
+	if m, err := Parse(""); m != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want no mapping", m, err)
+	}
+}
@@ -0,0 +1,104 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DestinationField is a field a destination knows about.
+type DestinationField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Catalogue lists the fields of a destination. Strict destinations only
+// accept the fields they list; for the others, such as schemaless search
+// indexes, targets outside the catalogue are only worth a warning.
+type Catalogue struct {
+	Fields []DestinationField `json:"fields"`
+	Strict bool               `json:"strict"`
+}
+
+// Validation is the outcome of checking a mapping against a source and a
+// destination. Errors make the mapping unusable; warnings point out likely
+// mistakes.
+type Validation struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// Validate checks that the mapping reads columns the source has and fills
+// the fields the destination has and requires. Without columns or a
+// catalogue, that side is not checked.
+func (m *Mapping) Validate(columns []string, catalogue *Catalogue) *Validation {
+	v := &Validation{Errors: []string{}, Warnings: []string{}}
+	if err := m.check(); err != nil {
+		v.Errors = append(v.Errors, err.Error())
+	}
+
+	if columns != nil {
+		known := make(map[string]bool, len(columns))
+		for _, col := range columns {
+			known[col] = true
+		}
+		for _, f := range m.Fields {
+			if f.Source != "" && !known[f.Source] && !known[strings.SplitN(f.Source, ".", 2)[0]] {
+				v.Errors = append(v.Errors, fmt.Sprintf("field %s reads column %s, which the source does not have", f.Target, f.Source))
+			}
+		}
+	}
+
+	if catalogue != nil && len(catalogue.Fields) > 0 {
+		problem := func(msg string) {
+			if catalogue.Strict {
+				v.Errors = append(v.Errors, msg)
+			} else {
+				v.Warnings = append(v.Warnings, msg)
+			}
+		}
+		for _, f := range m.Fields {
+			dest, ok := lookup(catalogue, f.Target)
+			if !ok {
+				problem(fmt.Sprintf("field %s is not a field of the destination", f.Target))
+				continue
+			}
+			if dest.Name == f.Target && dest.Type != "" && f.Type != "" && dest.Type != f.Type {
+				v.Errors = append(v.Errors, fmt.Sprintf("field %s is cast to %s, but the destination expects %s", f.Target, f.Type, dest.Type))
+			}
+		}
+		for _, dest := range catalogue.Fields {
+			if !dest.Required {
+				continue
+			}
+			if f, ok := m.field(dest.Name); !ok {
+				v.Errors = append(v.Errors, fmt.Sprintf("destination field %s is required but not mapped", dest.Name))
+			} else if !f.Required && f.Source != "" {
+				v.Warnings = append(v.Warnings, fmt.Sprintf("destination field %s is required, records without %s will be rejected by the destination", dest.Name, f.Source))
+			}
+		}
+	}
+	v.Valid = len(v.Errors) == 0
+	return v
+}
+
+// lookup finds the catalogue field a target fills, which may be nested in
+// it or contain nested fields of its own.
+func lookup(catalogue *Catalogue, target string) (DestinationField, bool) {
+	for _, dest := range catalogue.Fields {
+		if dest.Name == target || strings.HasPrefix(target, dest.Name+".") || strings.HasPrefix(dest.Name, target+".") {
+			return dest, true
+		}
+	}
+	return DestinationField{}, false
+}
+
+func (m *Mapping) field(target string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Target == target {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
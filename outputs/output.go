@@ -1,31 +1,58 @@
 package outputs
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"retl/outputs/algolia"
 	"retl/outputs/types"
 )
 
+func consumerSettings(getenv func(string) string, settings map[string]interface{}) map[string]interface{} {
+	settings["start_offset"] = getenv("KAFKA_START_OFFSET")
+	settings["batch_size"] = getenv("KAFKA_BATCH_SIZE")
+	settings["batch_timeout_ms"] = getenv("KAFKA_BATCH_TIMEOUT_MS")
+	settings["retry_max_attempts"] = getenv("RETRY_MAX_ATTEMPTS")
+	settings["retry_base_delay_ms"] = getenv("RETRY_BASE_DELAY_MS")
+	settings["retry_max_delay_ms"] = getenv("RETRY_MAX_DELAY_MS")
+	settings["requests_per_sec"] = getenv("RATE_LIMIT_REQUESTS_PER_SEC")
+	settings["records_per_sec"] = getenv("RATE_LIMIT_RECORDS_PER_SEC")
+	settings["burst"] = getenv("RATE_LIMIT_BURST")
+	settings["max_concurrency"] = getenv("MAX_CONCURRENCY")
+	settings["field_mapping"] = getenv("FIELD_MAPPING")
+	settings["transforms"] = getenv("TRANSFORMS")
+	return settings
+}
 
-
-func Start() {
+// New builds the named output, reading its configuration through getenv.
+// Pods pass os.Getenv; the API passes a lookup into a stored output config.
+func New(name string, getenv func(string) string) (Output, error) {
 	var outputs map[string]Output = map[string]Output{
 		"algolia": &algolia.Algolia{
 			Conf: &types.ConfigType{
-				Settings: map[string]interface{}{
-					"index": os.Getenv("ALGOLIA_INDEX"),
-				},
+				Settings: consumerSettings(getenv, map[string]interface{}{
+					"index": getenv("ALGOLIA_INDEX"),
+				}),
 				Secrets: map[string]interface{}{
-					"app_id": os.Getenv("ALGOLIA_APP_ID"),
-					"api_key": os.Getenv("ALGOLIA_API_KEY"),
+					"app_id":  getenv("ALGOLIA_APP_ID"),
+					"api_key": getenv("ALGOLIA_API_KEY"),
 				},
 			},
 		},
 	}
-	CONNECTOR_NAME := os.Getenv("CONNECTOR_NAME")
-	for key, value := range outputs {
-		if CONNECTOR_NAME == key {
-			value.Run()
-		}
+	if output, ok := outputs[name]; ok {
+		return output, nil
+	}
+	return nil, fmt.Errorf("unknown output %q", name)
+}
+
+func Start() {
+	name := os.Getenv("CONNECTOR_NAME")
+	output, err := New(name, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := output.Run(); err != nil {
+		log.Fatalf("%s output failed: %v", name, err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"retl/outputs/retry"
+	"retl/outputs/types"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Each throttling signal halves the allowed rates, and each success
+	// recovers a tenth of the configured rates, down to minFactor.
+	slowdownFactor = 0.5
+	recoveryStep   = 0.1
+	minFactor      = 0.05
+)
+
+// Limiter bounds the requests/sec, records/sec and concurrent requests sent
+// by one output connector instance. It is safe to share between all of the
+// output's goroutines.
+type Limiter struct {
+	requests *rate.Limiter
+	records  *rate.Limiter
+	slots    chan struct{}
+
+	mu             sync.Mutex
+	factor         float64
+	requestsPerSec rate.Limit
+	recordsPerSec  rate.Limit
+}
+
+// New reads requests_per_sec, records_per_sec, burst and max_concurrency
+// from conf. Unset or zero values mean unlimited.
+func New(conf *types.ConfigType) *Limiter {
+	burst := conf.SettingInt("burst", 0)
+	l := &Limiter{
+		requestsPerSec: limit(conf.SettingInt("requests_per_sec", 0)),
+		recordsPerSec:  limit(conf.SettingInt("records_per_sec", 0)),
+		factor:         1,
+	}
+	l.requests = rate.NewLimiter(l.requestsPerSec, burstFor(burst, conf.SettingInt("requests_per_sec", 0)))
+	l.records = rate.NewLimiter(l.recordsPerSec, burstFor(burst, conf.SettingInt("records_per_sec", 0)))
+	if n := conf.SettingInt("max_concurrency", 0); n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	return l
+}
+
+func limit(perSec int) rate.Limit {
+	if perSec <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(perSec)
+}
+
+func burstFor(burst, perSec int) int {
+	if burst > 0 {
+		return burst
+	}
+	if perSec > 0 {
+		return perSec
+	}
+	return 1
+}
+
+// Do waits for capacity to send a request carrying the given number of
+// records, then calls fn. A throttling response from the destination slows
+// the limiter down; successful requests gradually restore the configured
+// rates.
+func (l *Limiter) Do(ctx context.Context, records int, fn func() error) error {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-l.slots }()
+	}
+	if err := l.requests.Wait(ctx); err != nil {
+		return err
+	}
+	if err := l.waitRecords(ctx, records); err != nil {
+		return err
+	}
+
+	err := fn()
+	switch {
+	case retry.IsThrottled(err):
+		l.setFactor(func(f float64) float64 { return f * slowdownFactor })
+	case err == nil:
+		l.setFactor(func(f float64) float64 { return f + recoveryStep })
+	}
+	return err
+}
+
+// waitRecords reserves n records in chunks, since a single WaitN larger than
+// the burst would fail.
+func (l *Limiter) waitRecords(ctx context.Context, n int) error {
+	burst := l.records.Burst()
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := l.records.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// setFactor rescales the configured rates. Unlimited rates stay unlimited,
+// leaving throttling to the retry policy's backoff.
+func (l *Limiter) setFactor(next func(float64) float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.factor = next(l.factor)
+	if l.factor > 1 {
+		l.factor = 1
+	}
+	if l.factor < minFactor {
+		l.factor = minFactor
+	}
+	if l.requestsPerSec != rate.Inf {
+		l.requests.SetLimit(l.requestsPerSec * rate.Limit(l.factor))
+	}
+	if l.recordsPerSec != rate.Inf {
+		l.records.SetLimit(l.recordsPerSec * rate.Limit(l.factor))
+	}
+}
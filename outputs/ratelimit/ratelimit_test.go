@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"retl/outputs/retry"
+	"retl/outputs/types"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestFactor(t *testing.T) {
+	l := New(&types.ConfigType{Settings: map[string]interface{}{
+		"requests_per_sec": "100",
+		"burst":            "1000",
+	}})
+	throttled := &retry.StatusError{StatusCode: 429, Err: errors.New("slow down")}
+	invalid := &retry.StatusError{StatusCode: 400, Err: errors.New("invalid")}
+	ctx := context.Background()
+
+	steps := []struct {
+		name string
+		err  error
+		want float64
+	}{
+		{name: "success at full rate", want: 100},
+		{name: "throttled", err: throttled, want: 50},
+		{name: "throttled again", err: throttled, want: 25},
+		{name: "other errors keep the rate", err: invalid, want: 25},
+		{name: "success recovers", want: 35},
+		{name: "throttled", err: throttled, want: 17.5},
+		{name: "throttled", err: throttled, want: 8.75},
+		{name: "throttled", err: throttled, want: 5},
+		{name: "throttled down to the minimum", err: throttled, want: 5},
+		{name: "success recovers", want: 15},
+	}
+	for _, step := range steps {
+		if err := l.Do(ctx, 1, func() error { return step.err }); err != step.err {
+			t.Fatalf("%s: got error %v, want %v", step.name, err, step.err)
+		}
+		if got := float64(l.requests.Limit()); math.Abs(got-step.want) > 1e-9 {
+			t.Fatalf("%s: got %v requests/sec, want %v", step.name, got, step.want)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := l.Do(ctx, 1, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.requests.Limit(); got != 100 {
+		t.Errorf("recovered to %v requests/sec, want the configured 100", got)
+	}
+	if got := l.records.Limit(); got != rate.Inf {
+		t.Errorf("unlimited records/sec became %v", got)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	l := New(&types.ConfigType{Settings: map[string]interface{}{"max_concurrency": "1"}})
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- l.Do(context.Background(), 1, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	called := false
+	if err := l.Do(ctx, 1, func() error { called = true; return nil }); !errors.Is(err, context.DeadlineExceeded) || called {
+		t.Errorf("got error %v with the only slot taken, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Do(context.Background(), 1, func() error { return nil }); err != nil {
+		t.Errorf("got error %v once the slot was released", err)
+	}
+}
+
+func TestWaitRecords(t *testing.T) {
+	l := New(&types.ConfigType{Settings: map[string]interface{}{"records_per_sec": "1000", "burst": "10"}})
+	if err := l.Do(context.Background(), 25, func() error { return nil }); err != nil {
+		t.Errorf("got error %v for more records than the burst", err)
+	}
+}
@@ -0,0 +1,194 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"retl/outputs/types"
+	"strconv"
+	"time"
+)
+
+// StatusError is a destination error annotated with the HTTP status it was
+// returned with, and the delay the destination asked for, if any.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+type retryAfterKey struct{}
+
+// WithRetryAfter returns a context that records, in *after, the
+// Retry-After header of the last response to a request sent with it
+// through Transport. It is for clients whose errors do not carry the
+// response they were built from.
+func WithRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	after := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, after), after
+}
+
+// Transport records Retry-After headers for contexts from WithRetryAfter.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if after, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok && err == nil {
+		*after = ParseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return resp, err
+}
+
+// ParseRetryAfter accepts both forms of the header: a number of seconds or
+// an HTTP date.
+func ParseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ExhaustedError is a transient error that persisted through every
+// attempt of a policy. It is not retried again, so the records it affects
+// are dead-lettered instead of blocking the pipeline.
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// IsExhausted reports whether err is a transient error that ran out of
+// attempts.
+func IsExhausted(err error) bool {
+	var exhausted *ExhaustedError
+	return errors.As(err, &exhausted)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as never retryable, for records a destination client
+// refuses before sending them.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsRetryable reports whether err is transient. Throttling and server errors
+// are retried while other 4xx responses mean the record itself is invalid.
+// Timeouts, connection resets and anything unclassified are retried too, so
+// that records are only dead-lettered for a transient reason once it has
+// outlasted every attempt.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) || IsExhausted(err) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode
+		return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+	}
+	return true
+}
+
+// IsThrottled reports whether the destination rejected the request because
+// a rate limit or quota was exceeded.
+func IsThrottled(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsPermanent reports whether err means the destination will never accept
+// the request as sent.
+func IsPermanent(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !IsRetryable(err) && !IsExhausted(err)
+}
+
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewPolicy(conf *types.ConfigType) Policy {
+	return Policy{
+		MaxAttempts: conf.SettingInt("retry_max_attempts", 5),
+		BaseDelay:   time.Duration(conf.SettingInt("retry_base_delay_ms", 500)) * time.Millisecond,
+		MaxDelay:    time.Duration(conf.SettingInt("retry_max_delay_ms", 30000)) * time.Millisecond,
+	}
+}
+
+// Do calls fn until it succeeds, fails permanently or MaxAttempts is
+// reached, sleeping with jittered exponential backoff in between. A
+// Retry-After from the destination takes precedence when it is longer. It
+// returns the number of attempts made, and an ExhaustedError when fn was
+// still failing transiently after the last one.
+func (p Policy) Do(ctx context.Context, fn func() error) (int, error) {
+	var err error
+	attempt := 0
+	for attempt < p.MaxAttempts || attempt == 0 {
+		attempt++
+		err = fn()
+		if err == nil || !IsRetryable(err) {
+			break
+		}
+		if attempt >= p.MaxAttempts {
+			return attempt, &ExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		delay := p.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		}
+	}
+	return attempt, err
+}
+
+func (p Policy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
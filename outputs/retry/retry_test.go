@@ -0,0 +1,187 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		permanent bool
+	}{
+		{name: "nil", err: nil},
+		{name: "cancelled", err: context.Canceled},
+		{name: "wrapped cancellation", err: fmt.Errorf("send: %w", context.Canceled)},
+		{name: "too many requests", err: &StatusError{StatusCode: 429, Err: errors.New("slow down")}, retryable: true},
+		{name: "request timeout", err: &StatusError{StatusCode: 408, Err: errors.New("timeout")}, retryable: true},
+		{name: "server error", err: &StatusError{StatusCode: 503, Err: errors.New("unavailable")}, retryable: true},
+		{name: "wrapped server error", err: fmt.Errorf("send: %w", &StatusError{StatusCode: 500, Err: errors.New("oops")}), retryable: true},
+		{name: "bad request", err: &StatusError{StatusCode: 400, Err: errors.New("invalid")}, permanent: true},
+		{name: "not found", err: &StatusError{StatusCode: 404, Err: errors.New("missing")}, permanent: true},
+		{name: "unclassified", err: errors.New("connection reset"), retryable: true},
+		{name: "marked permanent", err: Permanent(errors.New("too large")), permanent: true},
+		{name: "permanent server error", err: Permanent(&StatusError{StatusCode: 500, Err: errors.New("oops")}), permanent: true},
+		{name: "exhausted", err: &ExhaustedError{Attempts: 3, Err: &StatusError{StatusCode: 503, Err: errors.New("unavailable")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+			}
+			if got := IsPermanent(tt.err); got != tt.permanent {
+				t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: ""},
+		{value: "0"},
+		{value: "-5"},
+		{value: "soon"},
+		{value: "7", min: 7 * time.Second, max: 7 * time.Second},
+		{value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), min: 58 * time.Minute, max: time.Hour},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("ParseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, after := WithRetryAfter(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if *after != 3*time.Second {
+		t.Errorf("recorded %v, want 3s", *after)
+	}
+}
+
+func TestDo(t *testing.T) {
+	unavailable := &StatusError{StatusCode: 503, Err: errors.New("unavailable")}
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		calls := 0
+		attempts, err := policy.Do(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return unavailable
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("got %d attempts and error %v, want 3 and none", attempts, err)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		calls := 0
+		attempts, err := policy.Do(context.Background(), func() error {
+			calls++
+			return unavailable
+		})
+		var exhausted *ExhaustedError
+		if !errors.As(err, &exhausted) || exhausted.Attempts != 3 || !errors.Is(err, unavailable) {
+			t.Fatalf("got error %v, want it to wrap %v after 3 attempts", err, unavailable)
+		}
+		if attempts != 3 || calls != 3 {
+			t.Errorf("got %d attempts and %d calls, want 3", attempts, calls)
+		}
+		if IsRetryable(err) || IsPermanent(err) {
+			t.Errorf("an exhausted error is reported as retryable or permanent")
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		invalid := &StatusError{StatusCode: 400, Err: errors.New("invalid")}
+		calls := 0
+		attempts, err := policy.Do(context.Background(), func() error {
+			calls++
+			return invalid
+		})
+		if err != invalid || attempts != 1 || calls != 1 {
+			t.Errorf("got %d attempts, %d calls and error %v, want a single attempt returning %v", attempts, calls, err, invalid)
+		}
+	})
+
+	t.Run("retry after wins over the backoff", func(t *testing.T) {
+		calls := 0
+		start := time.Now()
+		_, err := policy.Do(context.Background(), func() error {
+			calls++
+			if calls == 1 {
+				return &StatusError{StatusCode: 429, RetryAfter: 50 * time.Millisecond, Err: errors.New("slow down")}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("retried after %v, before the requested 50ms", elapsed)
+		}
+	})
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+		attempts, err := slow.Do(ctx, func() error {
+			cancel()
+			return unavailable
+		})
+		if !errors.Is(err, context.Canceled) || attempts != 1 {
+			t.Errorf("got %d attempts and error %v, want 1 and %v", attempts, err, context.Canceled)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 100 * time.Millisecond},
+		{attempt: 3, max: 400 * time.Millisecond},
+		{attempt: 5, max: time.Second},
+		{attempt: 80, max: time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
@@ -1,6 +1,19 @@
 package outputs
 
+import (
+	"context"
+
+	"retl/outputs/mapping"
+)
+
 type Output interface {
 	Run() error
 }
 
+// Cataloguer is implemented by outputs that can list the fields their
+// destination knows about, so field mappings can be validated against
+// them.
+type Cataloguer interface {
+	Catalogue(ctx context.Context) (*mapping.Catalogue, error)
+}
+
@@ -1,6 +1,36 @@
 package types
 
+import (
+	"fmt"
+	"strconv"
+)
+
 type ConfigType struct {
 	Settings map[string]interface{}
-	Secrets map[string]interface{}
-}
\ No newline at end of file
+	Secrets  map[string]interface{}
+}
+
+func (c *ConfigType) Setting(key string) string {
+	return lookup(c.Settings, key)
+}
+
+func (c *ConfigType) Secret(key string) string {
+	return lookup(c.Secrets, key)
+}
+
+// SettingInt returns the setting parsed as an integer, or def when it is
+// unset or malformed.
+func (c *ConfigType) SettingInt(key string, def int) int {
+	n, err := strconv.Atoi(c.Setting(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func lookup(m map[string]interface{}, key string) string {
+	if m == nil || m[key] == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", m[key])
+}
@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// functions adds what CEL and its extensions lack for reshaping records.
+// String functions pass nulls through, since source columns often are.
+//
+//	lower(s), upper(s), trim(s)
+//	md5(s), sha1(s), sha256(s)        hex digests
+//	coalesce(a, b, ...)               the first argument that is not null
+//	now()                             the current time
+//	formatTime(t, layout)             t in a Go time layout, in UTC
+//	parseTime(s, layout)              s read with a Go time layout
+//	date(t)                           the day of t as 2006-01-02
+func functions() []cel.EnvOption {
+	return []cel.EnvOption{
+		stringFunction("lower", strings.ToLower),
+		stringFunction("upper", strings.ToUpper),
+		stringFunction("trim", strings.TrimSpace),
+		stringFunction("md5", digest(md5.New)),
+		stringFunction("sha1", digest(sha1.New)),
+		stringFunction("sha256", digest(sha256.New)),
+		cel.Function("coalesce",
+			cel.Overload("coalesce_2", []*cel.Type{cel.DynType, cel.DynType}, cel.DynType),
+			cel.Overload("coalesce_3", []*cel.Type{cel.DynType, cel.DynType, cel.DynType}, cel.DynType),
+			cel.Overload("coalesce_4", []*cel.Type{cel.DynType, cel.DynType, cel.DynType, cel.DynType}, cel.DynType),
+			cel.SingletonFunctionBinding(func(args ...ref.Val) ref.Val {
+				for _, arg := range args {
+					if arg.Type() != types.NullType {
+						return arg
+					}
+				}
+				return types.NullValue
+			}, 0)),
+		cel.Function("now",
+			cel.Overload("now", nil, cel.TimestampType,
+				cel.FunctionBinding(func(...ref.Val) ref.Val {
+					return types.Timestamp{Time: time.Now().UTC()}
+				}))),
+		cel.Function("formatTime",
+			cel.Overload("format_time", []*cel.Type{cel.TimestampType, cel.StringType}, cel.StringType,
+				cel.BinaryBinding(func(t, layout ref.Val) ref.Val {
+					ts, ok := t.(types.Timestamp)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(t)
+					}
+					return types.String(ts.Time.UTC().Format(string(layout.(types.String))))
+				}))),
+		cel.Function("parseTime",
+			cel.Overload("parse_time", []*cel.Type{cel.StringType, cel.StringType}, cel.TimestampType,
+				cel.BinaryBinding(func(s, layout ref.Val) ref.Val {
+					str, ok := s.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(s)
+					}
+					t, err := time.Parse(string(layout.(types.String)), string(str))
+					if err != nil {
+						return types.WrapErr(err)
+					}
+					return types.Timestamp{Time: t}
+				}))),
+		cel.Function("date",
+			cel.Overload("date_timestamp", []*cel.Type{cel.TimestampType}, cel.StringType,
+				cel.UnaryBinding(func(t ref.Val) ref.Val {
+					ts, ok := t.(types.Timestamp)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(t)
+					}
+					return types.String(ts.Time.UTC().Format(time.DateOnly))
+				}))),
+	}
+}
+
+// stringFunction declares a function of one string that returns null for
+// null.
+func stringFunction(name string, fn func(string) string) cel.EnvOption {
+	return cel.Function(name,
+		cel.Overload(name+"_dyn", []*cel.Type{cel.DynType}, cel.DynType,
+			cel.UnaryBinding(func(v ref.Val) ref.Val {
+				switch v := v.(type) {
+				case types.String:
+					return types.String(fn(string(v)))
+				case types.Null:
+					return types.NullValue
+				}
+				return types.MaybeNoSuchOverloadErr(v)
+			})))
+}
+
+func digest(h func() hash.Hash) func(string) string {
+	return func(s string) string {
+		sum := h()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+}
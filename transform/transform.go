@@ -0,0 +1,231 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+)
+
+// costLimit bounds the work of a single expression on a single record, so
+// a runaway comprehension cannot stall the pipeline.
+const costLimit = 1000000
+
+// Step is one stage of a pipeline's transformation: either an expression
+// whose result is written to Field, or a Filter that drops the records it
+// is false for.
+type Step struct {
+	Field      string `json:"field,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Filter     string `json:"filter,omitempty"`
+}
+
+type step struct {
+	Step
+	program cel.Program
+}
+
+// Transform runs its steps in order on each record. Expressions are CEL
+// and see the record's fields by name, as well as the whole record as
+// record, which helps with fields whose names are not identifiers.
+// Every step sees the fields set by the steps before it.
+type Transform struct {
+	steps []step
+}
+
+// Parse compiles the steps of a transformation from their JSON form, a
+// list of steps. An empty config is no transformation.
+func Parse(config string) (*Transform, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	var steps []Step
+	if err := json.Unmarshal([]byte(config), &steps); err != nil {
+		return nil, fmt.Errorf("invalid transforms: %v", err)
+	}
+	return New(steps)
+}
+
+func New(steps []Step) (*Transform, error) {
+	env, err := environment()
+	if err != nil {
+		return nil, err
+	}
+	t := &Transform{}
+	for i, s := range steps {
+		source := s.Expression
+		switch {
+		case s.Filter != "" && (s.Field != "" || s.Expression != ""):
+			return nil, fmt.Errorf("step %d is both a filter and an expression", i+1)
+		case s.Filter != "":
+			source = s.Filter
+		case s.Field == "" || s.Expression == "":
+			return nil, fmt.Errorf("step %d needs a field and an expression, or a filter", i+1)
+		}
+		// Records have no fixed schema, so expressions are parsed but not
+		// type-checked; type errors surface when a record is evaluated.
+		ast, issues := env.Parse(source)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, issues.Err())
+		}
+		program, err := env.Program(ast, cel.CostLimit(costLimit), cel.EvalOptions(cel.OptOptimize))
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		t.steps = append(t.steps, step{Step: s, program: program})
+	}
+	return t, nil
+}
+
+// Apply transforms a record in place. keep is false when a filter dropped
+// the record.
+func (t *Transform) Apply(record map[string]interface{}) (keep bool, err error) {
+	vars := variables(record)
+	for i, s := range t.steps {
+		out, _, err := s.program.Eval(map[string]interface{}(vars))
+		if err != nil {
+			return false, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		if s.Filter != "" {
+			pass, ok := out.(types.Bool)
+			if !ok {
+				return false, fmt.Errorf("step %d: filter returned %s, not a bool", i+1, out.Type().TypeName())
+			}
+			if !pass {
+				return false, nil
+			}
+			continue
+		}
+		v, err := native(out)
+		if err != nil {
+			return false, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		vars.set(record, s.Field, v)
+	}
+	return true, nil
+}
+
+// Fields runs only the steps that set fields, for deletes, which must reach
+// the destination whatever the filters say. Deletes carry only the key
+// columns, so a step that fails, typically because it reads another
+// column, is skipped and leaves its field as it was.
+func (t *Transform) Fields(record map[string]interface{}) {
+	vars := variables(record)
+	for _, s := range t.steps {
+		if s.Filter != "" {
+			continue
+		}
+		out, _, err := s.program.Eval(map[string]interface{}(vars))
+		if err != nil {
+			continue
+		}
+		if v, err := native(out); err == nil {
+			vars.set(record, s.Field, v)
+		}
+	}
+}
+
+// vars are what expressions see of a record: its fields by name and the
+// whole record as record, with numbers converted for CEL. The record
+// itself keeps its json.Number values, so fields no step sets are written
+// back exactly as they were read.
+type vars map[string]interface{}
+
+func variables(record map[string]interface{}) vars {
+	converted := celValue(record).(map[string]interface{})
+	v := make(vars, len(converted)+1)
+	for k, e := range converted {
+		v[k] = e
+	}
+	v["record"] = converted
+	return v
+}
+
+// set writes a step's result to both the record and what later steps see.
+func (v vars) set(record map[string]interface{}, field string, value interface{}) {
+	record[field] = value
+	v[field] = value
+	v["record"].(map[string]interface{})[field] = value
+}
+
+// Decode reads a JSON record keeping its numbers as json.Number, which
+// expressions see as ints when they are whole and doubles otherwise.
+func Decode(value []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var record map[string]interface{}
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// celValue copies a value with its json.Number values converted to the
+// ints and doubles CEL works with.
+func celValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = celValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = celValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+var (
+	listType = reflect.TypeOf([]interface{}{})
+	mapType  = reflect.TypeOf(map[string]interface{}{})
+)
+
+// native converts an expression result into a value that encodes as JSON.
+// Timestamps are written as RFC 3339 in UTC and durations as strings such
+// as 1h30m.
+func native(v ref.Val) (interface{}, error) {
+	switch v := v.(type) {
+	case types.Null:
+		return nil, nil
+	case types.Timestamp:
+		return v.Time.UTC().Format(time.RFC3339Nano), nil
+	case types.Duration:
+		return v.Duration.String(), nil
+	case traits.Lister:
+		return v.ConvertToNative(listType)
+	case traits.Mapper:
+		return v.ConvertToNative(mapType)
+	}
+	return v.Value(), nil
+}
+
+func environment() (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+		ext.Math(),
+		ext.Encoders(),
+		ext.Lists(),
+	}
+	opts = append(opts, functions()...)
+	return cel.NewEnv(opts...)
+}
@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []Step
+		record string
+		want   map[string]interface{}
+		keep   bool
+		err    string
+	}{
+		{
+			name:   "set a field from others",
+			steps:  []Step{{Field: "name", Expression: `first + " " + last`}},
+			record: `{"first": "Ada", "last": "Lovelace"}`,
+			want:   map[string]interface{}{"first": "Ada", "last": "Lovelace", "name": "Ada Lovelace"},
+			keep:   true,
+		},
+		{
+			name: "later steps see earlier fields",
+			steps: []Step{
+				{Field: "total", Expression: "price * quantity"},
+				{Field: "expensive", Expression: "total > 100"},
+			},
+			record: `{"price": 30, "quantity": 4}`,
+			want:   map[string]interface{}{"price": json.Number("30"), "quantity": json.Number("4"), "total": int64(120), "expensive": true},
+			keep:   true,
+		},
+		{
+			name:   "field names that are not identifiers",
+			steps:  []Step{{Field: "slug", Expression: `lower(record["Product Name"])`}},
+			record: `{"Product Name": "Lamp"}`,
+			want:   map[string]interface{}{"Product Name": "Lamp", "slug": "lamp"},
+			keep:   true,
+		},
+		{
+			name:   "mixed numbers compare",
+			steps:  []Step{{Filter: "price > 9"}},
+			record: `{"price": 9.5}`,
+			want:   map[string]interface{}{"price": json.Number("9.5")},
+			keep:   true,
+		},
+		{
+			name:   "untouched numbers stay exact",
+			steps:  []Step{{Field: "big", Expression: "amount > 1.0"}},
+			record: `{"amount": 12345678901234567890.123, "id": 98765432109876543210}`,
+			want:   map[string]interface{}{"amount": json.Number("12345678901234567890.123"), "id": json.Number("98765432109876543210"), "big": true},
+			keep:   true,
+		},
+		{
+			name:   "filter drops the record",
+			steps:  []Step{{Filter: `status == "active"`}, {Field: "never", Expression: "1"}},
+			record: `{"status": "archived"}`,
+			keep:   false,
+		},
+		{
+			name:   "null-tolerant functions",
+			steps:  []Step{{Field: "email", Expression: "trim(lower(email))"}, {Field: "nick", Expression: `coalesce(nick, name, "anonymous")`}},
+			record: `{"email": null, "nick": null, "name": null}`,
+			want:   map[string]interface{}{"email": nil, "nick": "anonymous", "name": nil},
+			keep:   true,
+		},
+		{
+			name:   "time functions",
+			steps:  []Step{{Field: "day", Expression: `date(parseTime(created, "2006-01-02 15:04"))`}},
+			record: `{"created": "2024-05-06 07:08"}`,
+			want:   map[string]interface{}{"created": "2024-05-06 07:08", "day": "2024-05-06"},
+			keep:   true,
+		},
+		{
+			name:   "lists and maps",
+			steps:  []Step{{Field: "tags", Expression: `tags.map(t, upper(t))`}, {Field: "meta", Expression: `{"n": size(tags)}`}},
+			record: `{"tags": ["a", "b"]}`,
+			want:   map[string]interface{}{"tags": []interface{}{"A", "B"}, "meta": map[string]interface{}{"n": int64(2)}},
+			keep:   true,
+		},
+		{
+			name:   "missing column",
+			steps:  []Step{{Field: "x", Expression: "missing + 1"}},
+			record: `{}`,
+			err:    "step 1",
+		},
+		{
+			name:   "filter that is not a bool",
+			steps:  []Step{{Filter: "1"}},
+			record: `{}`,
+			err:    "not a bool",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := New(tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record, err := Decode([]byte(tt.record))
+			if err != nil {
+				t.Fatal(err)
+			}
+			keep, err := transform.Apply(record)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keep != tt.keep {
+				t.Fatalf("keep = %v, want %v", keep, tt.keep)
+			}
+			if keep && !reflect.DeepEqual(record, tt.want) {
+				t.Errorf("got %#v, want %#v", record, tt.want)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	transform, err := New([]Step{
+		{Filter: `status == "active"`},
+		{Field: "objectID", Expression: `"user-" + string(id)`},
+		{Field: "name", Expression: `first + " " + last`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A delete carries only the key columns: the filter and the step that
+	// reads other columns must not stop it.
+	record, err := Decode([]byte(`{"id": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transform.Fields(record)
+	want := map[string]interface{}{"id": json.Number("7"), "objectID": "user-7"}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got %#v, want %#v", record, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+		err   string
+	}{
+		{name: "filter and expression", steps: []Step{{Field: "a", Expression: "1", Filter: "true"}}, err: "both a filter and an expression"},
+		{name: "expression without field", steps: []Step{{Expression: "1"}}, err: "needs a field"},
+		{name: "syntax error", steps: []Step{{Field: "a", Expression: "1 +"}}, err: "step 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.steps)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+	if transform, err := Parse(" "); transform != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want no transform", transform, err)
+	}
+}